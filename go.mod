@@ -3,11 +3,13 @@ module content-service-api
 go 1.15
 
 require (
-	github.com/adrg/go-wkhtmltopdf v0.2.2 // indirect
+	github.com/aws/aws-sdk-go v1.34.28
 	github.com/gabriel-vasile/mimetype v1.2.0
 	github.com/gorilla/handlers v1.5.1
 	github.com/gorilla/mux v1.8.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/testify v1.6.1
 	go.mongodb.org/mongo-driver v1.5.0
+	golang.org/x/image v0.0.0-20210220032944-ac19c3e999fb
+	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
 )
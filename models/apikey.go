@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Scopes an API key can be granted. Read, write and delete cover requests made with the matching
+// HTTP methods; admin grants everything, including the admin role.
+const (
+	ScopeRead   = "read"
+	ScopeWrite  = "write"
+	ScopeDelete = "delete"
+	ScopeAdmin  = "admin"
+)
+
+// APIKeyRequest asks for a new API key. ExpiresIn is in seconds, and 0 creates a key that never expires.
+type APIKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int64    `json:"expiresIn"`
+}
+
+// APIKey lets a service authenticate without a user token. Only a hash of the key is stored; Key holds
+// the key itself and is only filled in when the key is created.
+type APIKey struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	Prefix    string             `json:"prefix" bson:"prefix"`
+	Hash      string             `json:"-" bson:"hash"`
+	Scopes    []string           `json:"scopes" bson:"scopes"`
+	CreatedBy string             `json:"createdBy" bson:"createdBy"`
+	Created   time.Time          `json:"created" bson:"created"`
+	Expires   *time.Time         `json:"expires,omitempty" bson:"expires,omitempty"`
+	LastUsed  *time.Time         `json:"lastUsed,omitempty" bson:"lastUsed,omitempty"`
+	Key       string             `json:"key,omitempty" bson:"-"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// ArchiveRequest selects the files to download as a single archive, either by ID or with the same filter
+// parameters GET /files accepts. Format is "zip", the default, or "tar.gz".
+type ArchiveRequest struct {
+	IDs    []string          `json:"ids"`
+	Filter map[string]string `json:"filter"`
+	Format string            `json:"format"`
+}
+
+// ArchiveManifest is added to an archive as manifest.json when some of the requested files could not be
+// included.
+type ArchiveManifest struct {
+	Missing []ArchiveMissing `json:"missing"`
+}
+
+// ArchiveMissing is a requested file that is not in the archive, along with the reason why.
+type ArchiveMissing struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error"`
+}
+
+// ArchiveEntry is a file stored inside a zip or tar archive.
+type ArchiveEntry struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// ExplodeResponse reports the folder an archive was extracted into and the outcome for each entry.
+type ExplodeResponse struct {
+	Folder *FolderResponse `json:"folder"`
+	Files  []UploadResult  `json:"files"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Derived is content generated from a file, such as a thumbnail, and stored as a blob of its own. It
+// belongs to the revision whose hash it was generated from, and Variant tells apart the different
+// renditions of the same Kind, e.g. thumbnails of different sizes.
+type Derived struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	FileID      primitive.ObjectID `json:"fileId" bson:"fileId"`
+	SourceHash  string             `json:"sourceHash" bson:"sourceHash"`
+	Kind        string             `json:"kind" bson:"kind"`
+	Variant     string             `json:"variant" bson:"variant"`
+	BlobID      primitive.ObjectID `json:"blobId" bson:"blobId"`
+	Size        int64              `json:"size" bson:"size"`
+	ContentType string             `json:"contentType" bson:"contentType"`
+	Created     time.Time          `json:"created" bson:"created"`
+}
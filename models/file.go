@@ -7,12 +7,21 @@ import (
 )
 
 type FileRequest struct {
-	Name      string             `json:"name" bson:"name"`
-	Timestamp time.Time          `json:"timestamp" bson:"timestamp"`
-	Extension string             `json:"extension" bson:"extension"`
-	Size      int64              `json:"size" bson:"size"`
-	FileID    primitive.ObjectID `json:"fileBytes" bson:"fileBytes"`
-	Hidden	  bool				 `json:"hidden" bson:"hidden"`
+	Name        string              `json:"name" bson:"name"`
+	Timestamp   time.Time           `json:"timestamp" bson:"timestamp"`
+	Extension   string              `json:"extension" bson:"extension"`
+	Size        int64               `json:"size" bson:"size"`
+	ContentType string              `json:"contentType" bson:"contentType"`
+	FileID      primitive.ObjectID  `json:"fileBytes" bson:"fileBytes"`
+	Hash        string              `json:"hash" bson:"hash"`
+	Hidden      bool                `json:"hidden" bson:"hidden"`
+	Parent      *primitive.ObjectID `json:"parent" bson:"parent"`
+	Tags        []string            `json:"tags" bson:"tags"`
+	Metadata    map[string]string   `json:"metadata" bson:"metadata"`
+	Owner       string              `json:"owner" bson:"owner"`
+	Grants      []string            `json:"grants" bson:"grants"`
+	Version     int                 `json:"version" bson:"version"`
+	Versions    []FileVersion       `json:"versions" bson:"versions"`
 }
 
 type FileUpdateRequest struct {
@@ -20,15 +29,83 @@ type FileUpdateRequest struct {
 	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
 	Extension string    `json:"extension" bson:"extension"`
 	Size      int64     `json:"size" bson:"size"`
-	Hidden	  bool	    `json:"hidden" bson:"hidden"`
+	Hidden    bool      `json:"hidden" bson:"hidden"`
 }
 
 type FileResponse struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id"`
-	Name      string             `json:"name" bson:"name"`
-	Timestamp time.Time          `json:"timestamp" bson:"timestamp"`
-	Extension string             `json:"extension" bson:"extension"`
-	Size      int64              `json:"size" bson:"size"`
-	FileID    primitive.ObjectID `json:"fileBytes" bson:"fileBytes"`
-	Hidden	  bool				 `json:"hidden" bson:"hidden"`
+	ID          primitive.ObjectID  `json:"id" bson:"_id"`
+	Name        string              `json:"name" bson:"name"`
+	Timestamp   time.Time           `json:"timestamp" bson:"timestamp"`
+	Extension   string              `json:"extension" bson:"extension"`
+	Size        int64               `json:"size" bson:"size"`
+	ContentType string              `json:"contentType" bson:"contentType"`
+	FileID      primitive.ObjectID  `json:"fileBytes" bson:"fileBytes"`
+	Hash        string              `json:"hash" bson:"hash"`
+	Hidden      bool                `json:"hidden" bson:"hidden"`
+	Parent      *primitive.ObjectID `json:"parent" bson:"parent"`
+	Tags        []string            `json:"tags" bson:"tags"`
+	Metadata    map[string]string   `json:"metadata" bson:"metadata"`
+	Owner       string              `json:"owner" bson:"owner"`
+	Grants      []string            `json:"grants" bson:"grants"`
+	Version     int                 `json:"version" bson:"version"`
+}
+
+// FileVersion is a single revision of a file. Every revision points at its own GridFS object, which
+// may be shared with other revisions or files that have identical content.
+type FileVersion struct {
+	Version     int                `json:"version" bson:"version"`
+	Name        string             `json:"name" bson:"name"`
+	Timestamp   time.Time          `json:"timestamp" bson:"timestamp"`
+	Extension   string             `json:"extension" bson:"extension"`
+	Size        int64              `json:"size" bson:"size"`
+	ContentType string             `json:"contentType" bson:"contentType"`
+	FileID      primitive.ObjectID `json:"fileBytes" bson:"fileBytes"`
+	Hash        string             `json:"hash" bson:"hash"`
+}
+
+// FilePage is one page of a file listing. Next is empty on the last page.
+type FilePage struct {
+	Files []FileResponse `json:"files"`
+	Total int64          `json:"total"`
+	Next  string         `json:"next,omitempty"`
+}
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// ListOptions controls paging, ordering and projection of a file listing. Fields are named as they
+// appear in API responses, e.g. "id" rather than "_id".
+type ListOptions struct {
+	Limit  int64
+	Sort   []SortField
+	Fields []string
+	Next   string
+}
+
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// FileACL changes who can access a file. Grants replaces the list of users the file is shared with,
+// and a non-empty Owner transfers ownership.
+type FileACL struct {
+	Owner  string   `json:"owner"`
+	Grants []string `json:"grants"`
+}
+
+// UploadResult is the outcome of storing one file of a batch upload. ID is set if the file was stored,
+// and Error if it was not.
+type UploadResult struct {
+	Name   string              `json:"name"`
+	ID     *primitive.ObjectID `json:"id,omitempty"`
+	Status int                 `json:"status"`
+	Error  string              `json:"error,omitempty"`
+}
+
+// BatchUploadResponse lists the outcome of a batch upload per file, in the order the files were sent.
+type BatchUploadResponse struct {
+	Files []UploadResult `json:"files"`
 }
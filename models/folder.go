@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FolderRequest describes a folder to create. Owner is the user who created it; folders created before
+// ownership was recorded have none.
+type FolderRequest struct {
+	Name      string              `json:"name" bson:"name"`
+	Parent    *primitive.ObjectID `json:"parent" bson:"parent"`
+	Timestamp time.Time           `json:"timestamp" bson:"timestamp"`
+	Owner     string              `json:"owner" bson:"owner"`
+}
+
+type FolderResponse struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id"`
+	Name      string              `json:"name" bson:"name"`
+	Parent    *primitive.ObjectID `json:"parent" bson:"parent"`
+	Timestamp time.Time           `json:"timestamp" bson:"timestamp"`
+	Owner     string              `json:"owner" bson:"owner"`
+}
+
+// FolderContents lists the direct children of a folder, or of the root when Folder is nil.
+type FolderContents struct {
+	Folder  *FolderResponse  `json:"folder"`
+	Folders []FolderResponse `json:"folders"`
+	Files   []FileResponse   `json:"files"`
+}
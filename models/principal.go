@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// AdminRole grants access to every file regardless of who owns it.
+const AdminRole = "admin"
+
+// Principal is the user a request is made on behalf of, as identified by the login service. Scopes
+// are only set when the token was issued by an OAuth2 provider or is an API key, and ExpiresAt only
+// when the validator knows when the token stops being valid. APIKeyID is set when the request was
+// authenticated with an API key rather than a user's token, in which case UserID is the user who
+// created the key.
+type Principal struct {
+	UserID    string    `json:"userId"`
+	Roles     []string  `json:"roles"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	ExpiresAt time.Time `json:"-"`
+	APIKeyID  string    `json:"-"`
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) IsAdmin() bool {
+	return p.HasRole(AdminRole)
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ShareRequest asks for a link to a file that can be downloaded without logging in. ExpiresIn is in
+// seconds, and a MaxDownloads of 0 leaves the number of downloads unlimited.
+type ShareRequest struct {
+	ExpiresIn    int64 `json:"expiresIn"`
+	MaxDownloads int   `json:"maxDownloads"`
+}
+
+// Share is a link to a file that can be downloaded without logging in until it expires, runs out of
+// downloads or is revoked. URL is filled in when shares are returned to their creator, and never stored.
+type Share struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	FileID       primitive.ObjectID `json:"fileId" bson:"fileId"`
+	CreatedBy    string             `json:"createdBy" bson:"createdBy"`
+	Created      time.Time          `json:"created" bson:"created"`
+	Expires      time.Time          `json:"expires" bson:"expires"`
+	MaxDownloads int                `json:"maxDownloads" bson:"maxDownloads"`
+	Downloads    int                `json:"downloads" bson:"downloads"`
+	URL          string             `json:"url,omitempty" bson:"-"`
+}
+
+// Active reports whether the share can still be used at now: it has not expired and has downloads left.
+func (s *Share) Active(now time.Time) bool {
+	return s.Expires.After(now) && (s.MaxDownloads <= 0 || s.Downloads < s.MaxDownloads)
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Upload is a resumable upload in progress. The bytes received so far are stored as a sequence of
+// chunks, one per request, and File describes the file that is created once Offset reaches Length.
+// FileID is the ID of that file, set once the upload has completed.
+type Upload struct {
+	ID         primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Length     int64               `json:"length" bson:"length"`
+	Offset     int64               `json:"offset" bson:"offset"`
+	Chunks     []UploadChunk       `json:"-" bson:"chunks"`
+	File       FileRequest         `json:"file" bson:"file"`
+	Created    time.Time           `json:"created" bson:"created"`
+	Expires    time.Time           `json:"expires" bson:"expires"`
+	Completing *time.Time          `json:"-" bson:"completing,omitempty"`
+	Completed  bool                `json:"completed" bson:"completed"`
+	FileID     *primitive.ObjectID `json:"fileId,omitempty" bson:"fileId,omitempty"`
+}
+
+type UploadChunk struct {
+	BlobID primitive.ObjectID `json:"blobId" bson:"blobId"`
+	Size   int64              `json:"size" bson:"size"`
+}
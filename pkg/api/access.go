@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/external"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	errForbidden       = errors.New("you do not have access to this file")
+	errFolderForbidden = errors.New("you do not have access to this folder")
+)
+
+// updateFileACL replaces the list of users a file is shared with and optionally transfers its ownership.
+// Only the file's owner and admins can do either.
+func updateFileACL(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		file, err := dbHandler.GetFileInfo(ctx, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving file info")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		if !canManage(principal, file) {
+			respondWithError(w, http.StatusForbidden, "only the file's owner can change who has access to it")
+			return
+		}
+
+		var aclRequest models.FileACL
+		if err := json.NewDecoder(r.Body).Decode(&aclRequest); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		grants := make([]string, 0, len(aclRequest.Grants))
+		seen := make(map[string]bool)
+		for _, grant := range aclRequest.Grants {
+			if grant == "" {
+				respondWithError(w, http.StatusBadRequest, "grants cannot contain empty user IDs")
+				return
+			} else if !seen[grant] {
+				seen[grant] = true
+				grants = append(grants, grant)
+			}
+		}
+
+		updateRequest := map[string]interface{}{"grants": grants}
+		if aclRequest.Owner != "" {
+			updateRequest["owner"] = aclRequest.Owner
+		}
+
+		if err := dbHandler.UpdateFileInfo(ctx, id, updateRequest); err != nil {
+			logrus.WithError(err).Error("Error updating file access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		logrus.Info("File access updated successfully")
+		respondWithSuccess(w, http.StatusOK, "File access updated successfully")
+		return
+	}
+}
+
+// canAccess reports whether a principal may read and modify a file: admins can access every file, and
+// other users the files they own or have been granted. Files uploaded before ownership was recorded
+// have no owner and stay accessible to every user, as they were before.
+func canAccess(principal *models.Principal, file *models.FileResponse) bool {
+	if principal.IsAdmin() || file.Owner == "" || file.Owner == principal.UserID {
+		return true
+	}
+
+	for _, grant := range file.Grants {
+		if grant == principal.UserID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canManage reports whether a principal may change who has access to a file, which only its owner and
+// admins can do.
+func canManage(principal *models.Principal, file *models.FileResponse) bool {
+	return principal.IsAdmin() || (file.Owner != "" && file.Owner == principal.UserID)
+}
+
+// accessFilter returns the alternatives of an $or condition matching the files a principal can access,
+// mirroring canAccess, or nil for admins who can access everything.
+func accessFilter(principal *models.Principal) []interface{} {
+	if principal.IsAdmin() {
+		return nil
+	}
+
+	return []interface{}{
+		map[string]interface{}{"owner": principal.UserID},
+		map[string]interface{}{"grants": principal.UserID},
+		map[string]interface{}{"owner": map[string]interface{}{"$in": []interface{}{nil, ""}}},
+	}
+}
+
+// accessibleFiles returns the files from a listing that a principal can access.
+func accessibleFiles(principal *models.Principal, files []models.FileResponse) []models.FileResponse {
+	accessible := make([]models.FileResponse, 0, len(files))
+	for _, file := range files {
+		if canAccess(principal, &file) {
+			accessible = append(accessible, file)
+		}
+	}
+	return accessible
+}
+
+// authorizeFile retrieves a file's metadata, returning errForbidden if the principal cannot access it.
+func authorizeFile(ctx context.Context, dbHandler dao.DBHandler, principal *models.Principal, id primitive.ObjectID) (*models.FileResponse, error) {
+	file, err := dbHandler.GetFileInfo(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canAccess(principal, file) {
+		return nil, errForbidden
+	}
+
+	return file, nil
+}
+
+// canAccessFolder reports whether a principal may change a folder or what it contains: admins can change
+// every folder, and other users the folders they own. As with files, folders created before ownership was
+// recorded stay accessible to every user.
+func canAccessFolder(principal *models.Principal, folder *models.FolderResponse) bool {
+	return principal.IsAdmin() || folder.Owner == "" || folder.Owner == principal.UserID
+}
+
+// authorizeFolder retrieves a folder, returning errFolderForbidden if the principal cannot access it.
+func authorizeFolder(ctx context.Context, dbHandler dao.DBHandler, principal *models.Principal, id primitive.ObjectID) (*models.FolderResponse, error) {
+	folder, err := dbHandler.GetFolder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canAccessFolder(principal, folder) {
+		return nil, errFolderForbidden
+	}
+
+	return folder, nil
+}
+
+// authorizeParent checks that the principal may add to a folder, where nil stands for the root, to which
+// everyone may.
+func authorizeParent(ctx context.Context, dbHandler dao.DBHandler, principal *models.Principal, parent *primitive.ObjectID) error {
+	if parent == nil {
+		return nil
+	}
+
+	_, err := authorizeFolder(ctx, dbHandler, principal, *parent)
+	return err
+}
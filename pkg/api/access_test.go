@@ -0,0 +1,314 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"content-service-api/models"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_UploadFile_ShouldRecordOwner(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("UploadFile", mock.Anything, mock.MatchedBy(func(uploadRequest *models.FileRequest) bool {
+		return uploadRequest.Owner == "owner"
+	}), mock.Anything).Return(&models.FileResponse{ID: primitive.NewObjectID()}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "owner"}, nil)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "test.txt")
+	require.Nil(t, err)
+
+	_, err = io.Copy(part, strings.NewReader("test"))
+	require.Nil(t, err)
+	require.Nil(t, writer.Close())
+
+	req, err := http.NewRequest(http.MethodPost, "/upload", body)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+}
+
+func TestApi_DownloadFile_ShouldEnforceOwnership(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		principal *models.Principal
+		code      int
+	}{
+		{name: "owner", principal: &models.Principal{UserID: "owner"}, code: http.StatusOK},
+		{name: "grantee", principal: &models.Principal{UserID: "grantee"}, code: http.StatusOK},
+		{name: "admin", principal: &models.Principal{UserID: "admin", Roles: []string{models.AdminRole}}, code: http.StatusOK},
+		{name: "other user", principal: &models.Principal{UserID: "other"}, code: http.StatusForbidden},
+	} {
+		dbHandler := &mocks.DBHandler{}
+		extHandler := &mocks.ExtHandler{}
+		dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{
+			Name:   "test.txt",
+			Hash:   "test",
+			Owner:  "owner",
+			Grants: []string{"grantee"},
+		}, nil)
+		dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("test"), nil)
+		extHandler.On("ValidateToken", mock.Anything).Return(tc.principal, nil)
+
+		req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
+		require.Nil(t, err)
+		req.Header.Add("Authorization", "Bearer test")
+		req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+		recorder := httptest.NewRecorder()
+		httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+		httpHandler.ServeHTTP(recorder, req)
+		require.Equal(t, tc.code, recorder.Code, tc.name)
+	}
+}
+
+func TestApi_DeleteFile_ShouldReturn403IfFileBelongsToAnotherUser(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Owner: "owner"}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "other"}, nil)
+
+	req, err := http.NewRequest(http.MethodDelete, "/file/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(deleteFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	dbHandler.AssertNotCalled(t, "DeleteFile", mock.Anything, mock.Anything)
+}
+
+func TestApi_UpdateFileInfo_ShouldReturn400IfOwnerIsGiven(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Owner: "owner"}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "owner"}, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/file/5df25cc42d811e3b6b945c08", strings.NewReader(`{"owner": "other"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(updateFileInfo(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_UpdateFileInfo_ShouldReturn400IfAccessIsSetThroughDottedPaths(t *testing.T) {
+	for _, body := range []string{`{"grants.0": "other"}`, `{"owner.x": "other"}`, `{"grants": ["other"]}`} {
+		dbHandler := &mocks.DBHandler{}
+		extHandler := &mocks.ExtHandler{}
+		dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Owner: "owner"}, nil)
+		extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "owner"}, nil)
+
+		req, err := http.NewRequest(http.MethodPut, "/file/5df25cc42d811e3b6b945c08", strings.NewReader(body))
+		require.Nil(t, err)
+		req.Header.Add("Authorization", "Bearer test")
+		req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+		recorder := httptest.NewRecorder()
+		httpHandler := http.HandlerFunc(updateFileInfo(dbHandler, extHandler))
+		httpHandler.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusBadRequest, recorder.Code, body)
+		require.Contains(t, recorder.Body.String(), "/file/{id}/acl", body)
+		dbHandler.AssertNotCalled(t, "UpdateFileInfo", mock.Anything, mock.Anything, mock.Anything)
+	}
+}
+
+func TestApi_GetFiles_ShouldOnlyListAccessibleFilesForNonAdmins(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFiles", mock.Anything, map[string]interface{}{
+		"$or": []interface{}{
+			map[string]interface{}{"owner": "test"},
+			map[string]interface{}{"grants": "test"},
+			map[string]interface{}{"owner": map[string]interface{}{"$in": []interface{}{nil, ""}}},
+		},
+	}, mock.Anything).Return(&models.FilePage{Files: []models.FileResponse{}}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/files", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getFiles(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_GetFolderContents_ShouldHideInaccessibleFiles(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFolderContents", mock.Anything, mock.Anything).Return(&models.FolderContents{
+		Folders: []models.FolderResponse{},
+		Files:   []models.FileResponse{{Name: "mine", Owner: "test"}, {Name: "theirs", Owner: "other"}, {Name: "legacy"}},
+	}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/folders", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getFolderContents(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var contents models.FolderContents
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&contents))
+	require.Len(t, contents.Files, 2)
+	require.Equal(t, "mine", contents.Files[0].Name)
+	require.Equal(t, "legacy", contents.Files[1].Name)
+}
+
+func TestApi_DeleteFolder_ShouldReturn403IfRecursiveDeleteIsNotFromAnAdmin(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFolder", mock.Anything, mock.Anything).Return(&models.FolderResponse{Owner: "test"}, nil)
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodDelete, "/folder/5df25cc42d811e3b6b945c08?recursive=true", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(deleteFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestApi_UpdateFolder_ShouldReturn403IfNotOwner(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFolder", mock.Anything, mock.Anything).Return(&models.FolderResponse{Owner: "other"}, nil)
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/folder/5df25cc42d811e3b6b945c08", strings.NewReader(`{"name":"renamed"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(updateFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	dbHandler.AssertNotCalled(t, "RenameFolder", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_UpdateFolder_ShouldReturn403WhenMovingIntoOtherUsersFolder(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	own, _ := primitive.ObjectIDFromHex("5df25cc42d811e3b6b945c08")
+	other, _ := primitive.ObjectIDFromHex("5df25cc42d811e3b6b945c09")
+	dbHandler.On("GetFolder", mock.Anything, own).Return(&models.FolderResponse{ID: own, Owner: "test"}, nil)
+	dbHandler.On("GetFolder", mock.Anything, other).Return(&models.FolderResponse{ID: other, Owner: "other"}, nil)
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/folder/5df25cc42d811e3b6b945c08", strings.NewReader(`{"parent":"5df25cc42d811e3b6b945c09"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(updateFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	dbHandler.AssertNotCalled(t, "MoveFolder", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_DeleteFolder_ShouldReturn403IfNotOwner(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFolder", mock.Anything, mock.Anything).Return(&models.FolderResponse{Owner: "other"}, nil)
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodDelete, "/folder/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(deleteFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	dbHandler.AssertNotCalled(t, "DeleteFolder", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_CreateFolder_ShouldReturn403InOtherUsersFolder(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFolder", mock.Anything, mock.Anything).Return(&models.FolderResponse{Owner: "other"}, nil)
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/folders", strings.NewReader(`{"name":"reports","parent":"5df25cc42d811e3b6b945c08"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	dbHandler.AssertNotCalled(t, "CreateFolder", mock.Anything, mock.Anything)
+}
+
+func TestApi_UpdateFileACL_ShouldReturn403IfNotOwner(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Owner: "owner", Grants: []string{"grantee"}}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "grantee"}, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/file/5df25cc42d811e3b6b945c08/acl", strings.NewReader(`{"grants": ["grantee", "other"]}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(updateFileACL(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestApi_UpdateFileACL_ShouldReplaceGrants(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Owner: "owner"}, nil)
+	dbHandler.On("UpdateFileInfo", mock.Anything, mock.Anything, map[string]interface{}{
+		"grants": []string{"a", "b"},
+		"owner":  "new-owner",
+	}).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "owner"}, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/file/5df25cc42d811e3b6b945c08/acl", strings.NewReader(`{"owner": "new-owner", "grants": ["a", "b", "a"]}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(updateFileACL(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
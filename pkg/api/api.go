@@ -1,25 +1,24 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"content-service-api/models"
+	"content-service-api/pkg/convert"
 	"content-service-api/pkg/dao"
 	"content-service-api/pkg/external"
+	"content-service-api/pkg/filter"
 
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/gorilla/handlers"
@@ -30,21 +29,41 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const (
+	// maxUploadMemory is the most of a multipart upload held in memory; anything larger is spooled
+	// to temporary files on disk by the multipart reader and streamed from there.
+	maxUploadMemory = 8 << 20
+	// mimeSniffLength is the number of leading bytes mimetype inspects when detecting content type.
+	mimeSniffLength = 3072
+	// requestTimeout bounds the time taken by requests that do not stream file content. Streaming
+	// routes are exempt, since how long they take depends on the size of the file and the client.
+	requestTimeout = 20 * time.Second
+)
+
 func ListenAndServe() error {
-	headers := handlers.AllowedHeaders([]string{"X-Requested-With", "Access-Control-Allow-Origin", "Content-Type"})
+	headers := handlers.AllowedHeaders([]string{
+		"X-Requested-With", "Access-Control-Allow-Origin", "Content-Type", "Range",
+		"Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset",
+	})
+	exposed := handlers.ExposedHeaders([]string{
+		"Accept-Ranges", "Content-Range", "Content-Length", "Content-Disposition",
+		"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires",
+	})
 	origins := handlers.AllowedOrigins([]string{"*"})
-	methods := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS", "DELETE"})
+	methods := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "PATCH", "OPTIONS", "DELETE"})
 
 	router, err := route()
 	if err != nil {
 		return err
 	}
 
+	// The server sets no read or write timeout, which would cut off large uploads and downloads.
+	// Other requests are limited to requestTimeout by limitDuration instead.
 	server := &http.Server{
-		Handler:      handlers.CORS(headers, origins, methods)(router),
-		Addr:         ":8005",
-		WriteTimeout: 20 * time.Second,
-		ReadTimeout:  20 * time.Second,
+		Handler:           handlers.CORS(headers, exposed, origins, methods)(router),
+		Addr:              ":8005",
+		ReadHeaderTimeout: requestTimeout,
+		IdleTimeout:       2 * time.Minute,
 	}
 	shutdownGracefully(server)
 
@@ -52,6 +71,24 @@ func ListenAndServe() error {
 	return server.ListenAndServe()
 }
 
+// streaming marks the handler of a route that transfers file content, exempting it from requestTimeout.
+type streaming http.HandlerFunc
+
+func (s streaming) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s(w, r)
+}
+
+// limitDuration answers requests with 503 if their handler takes longer than timeout, except for
+// streaming routes. It must be the last middleware so that it sees the route's own handler.
+func limitDuration(timeout time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if _, ok := next.(streaming); ok {
+			return next
+		}
+		return http.TimeoutHandler(next, timeout, `{"error":"request timed out"}`)
+	}
+}
+
 func route() (*mux.Router, error) {
 	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(os.Getenv("MONGO_URI")))
 	if err != nil {
@@ -59,32 +96,136 @@ func route() (*mux.Router, error) {
 		return nil, err
 	}
 
+	blobStore, err := newBlobStore(client)
+	if err != nil {
+		logrus.WithError(err).Error("Error creating blob store")
+		return nil, err
+	}
+
 	dbHandler := dao.Handler{
-		Client:          client,
-		Database:        os.Getenv("DATABASE"),
-		FileCollection:  os.Getenv("FILE_COLLECTION"),
-		FsCollection:    os.Getenv("FS_COLLECTION"),
-		ChunkCollection: os.Getenv("CHUNK_COLLECTION"),
+		Client:            client,
+		Database:          os.Getenv("DATABASE"),
+		FileCollection:    os.Getenv("FILE_COLLECTION"),
+		FolderCollection:  os.Getenv("FOLDER_COLLECTION"),
+		ShareCollection:   os.Getenv("SHARE_COLLECTION"),
+		APIKeyCollection:  os.Getenv("API_KEY_COLLECTION"),
+		UploadCollection:  os.Getenv("UPLOAD_COLLECTION"),
+		DerivedCollection: os.Getenv("DERIVED_COLLECTION"),
+		ContentCollection: os.Getenv("CONTENT_COLLECTION"),
+		BlobStore:         blobStore,
 	}
 
-	extHandler := external.Handler{
-		HttpClient:      &http.Client{Timeout: 5 * time.Second},
-		LoginServiceURL: os.Getenv("LOGIN_SERVICE_URL"),
+	if err := dbHandler.CreateIndexes(context.Background()); err != nil {
+		logrus.WithError(err).Error("Error creating database indexes")
+		return nil, err
+	}
+	go cleanUpUploads(context.Background(), &dbHandler, uploadCleanupInterval)
+
+	tokenValidator, err := newExtHandler()
+	if err != nil {
+		logrus.WithError(err).Error("Error creating token validator")
+		return nil, err
+	}
+	extHandler := &apiKeyValidator{dbHandler: &dbHandler, next: tokenValidator}
+
+	signer, err := newShareSigner(os.Getenv("SHARE_SIGNING_KEY"), os.Getenv("PUBLIC_URL"))
+	if err != nil {
+		logrus.WithError(err).Error("Error creating share link signer")
+		return nil, err
+	}
+
+	converters, err := newConverters()
+	if err != nil {
+		logrus.WithError(err).Error("Error creating converters")
+		return nil, err
 	}
 
 	r := mux.NewRouter()
+	r.Use(requireKeyScopes(extHandler))
+	r.Use(limitDuration(requestTimeout))
 
 	r.HandleFunc("/health", checkHealth(&dbHandler)).Methods(http.MethodGet)
-	r.HandleFunc("/upload", uploadFile(&dbHandler, &extHandler)).Methods(http.MethodPost)
-	r.HandleFunc("/file/{id}", downloadFile(&dbHandler, &extHandler)).Methods(http.MethodGet)
-	r.HandleFunc("/file/{id}", deleteFile(&dbHandler, &extHandler)).Methods(http.MethodDelete)
-	r.HandleFunc("/file/{id}", updateFileInfo(&dbHandler, &extHandler)).Methods(http.MethodPut)
-	r.HandleFunc("/files", getFiles(&dbHandler, &extHandler)).Methods(http.MethodGet)
-	r.HandleFunc("/preview/{id}", generatePreview(&dbHandler, &extHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/debug/vars", getDebugVars(extHandler)).Methods(http.MethodGet)
+	r.Handle("/upload", streaming(uploadFile(&dbHandler, extHandler))).Methods(http.MethodPost)
+	r.HandleFunc("/uploads", tusOptions).Methods(http.MethodOptions)
+	r.HandleFunc("/uploads", createUpload(&dbHandler, extHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/uploads/{id}", getUploadOffset(&dbHandler, extHandler)).Methods(http.MethodHead)
+	r.Handle("/uploads/{id}", streaming(appendUpload(&dbHandler, extHandler))).Methods(http.MethodPatch)
+	r.HandleFunc("/uploads/{id}", terminateUpload(&dbHandler, extHandler)).Methods(http.MethodDelete)
+	r.Handle("/file/{id}", streaming(downloadFile(&dbHandler, extHandler))).Methods(http.MethodGet)
+	r.HandleFunc("/file/{id}", deleteFile(&dbHandler, extHandler)).Methods(http.MethodDelete)
+	r.HandleFunc("/file/{id}", updateFileInfo(&dbHandler, extHandler)).Methods(http.MethodPut)
+	r.Handle("/file/{id}", streaming(uploadFileVersion(&dbHandler, extHandler))).Methods(http.MethodPost)
+	r.HandleFunc("/file/{id}/versions", getFileVersions(&dbHandler, extHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/file/{id}/entries", getArchiveEntries(&dbHandler, extHandler)).Methods(http.MethodGet)
+	r.Handle("/file/{id}/entries/{path:.*}", streaming(getArchiveEntry(&dbHandler, extHandler))).Methods(http.MethodGet)
+	r.Handle("/file/{id}/explode", streaming(explodeArchive(&dbHandler, extHandler))).Methods(http.MethodPost)
+	r.HandleFunc("/file/{id}/versions/{version}/restore", restoreFileVersion(&dbHandler, extHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/files", getFiles(&dbHandler, extHandler)).Methods(http.MethodGet)
+	r.Handle("/files/archive", streaming(downloadArchive(&dbHandler, extHandler))).Methods(http.MethodPost)
+	r.Handle("/preview/{id}", streaming(generatePreview(&dbHandler, extHandler, converters))).Methods(http.MethodGet)
+	r.Handle("/convert/{id}", streaming(convertFile(&dbHandler, extHandler, converters))).Methods(http.MethodGet)
+	r.Handle("/thumbnail/{id}", streaming(getThumbnail(&dbHandler, extHandler))).Methods(http.MethodGet)
+	r.HandleFunc("/file/{id}/move", moveFile(&dbHandler, extHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/file/{id}/acl", updateFileACL(&dbHandler, extHandler)).Methods(http.MethodPut)
+	r.HandleFunc("/file/{id}/share", createShare(&dbHandler, extHandler, signer)).Methods(http.MethodPost)
+	r.HandleFunc("/file/{id}/shares", getShares(&dbHandler, extHandler, signer)).Methods(http.MethodGet)
+	r.HandleFunc("/file/{id}/shares/{shareId}", revokeShare(&dbHandler, extHandler)).Methods(http.MethodDelete)
+	r.Handle("/shared/{id}", streaming(downloadSharedFile(&dbHandler, signer))).Methods(http.MethodGet)
+	r.HandleFunc("/folders", createFolder(&dbHandler, extHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/folders", getFolderContents(&dbHandler, extHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/folder/{id}/children", getFolderContents(&dbHandler, extHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/folder/{id}", updateFolder(&dbHandler, extHandler)).Methods(http.MethodPut)
+	r.HandleFunc("/folder/{id}", deleteFolder(&dbHandler, extHandler)).Methods(http.MethodDelete)
+	r.Handle("/fs/{path:.*}", streaming(getByPath(&dbHandler, extHandler))).Methods(http.MethodGet)
+	r.HandleFunc("/apikeys", createAPIKey(&dbHandler, extHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/apikeys", getAPIKeys(&dbHandler, extHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/apikey/{id}", revokeAPIKey(&dbHandler, extHandler)).Methods(http.MethodDelete)
 
 	return r, nil
 }
 
+// newBlobStore creates the content store selected by STORAGE_BACKEND, which defaults to GridFS.
+func newBlobStore(client *mongo.Client) (dao.BlobStore, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "gridfs":
+		return dao.NewGridFSStore(client, os.Getenv("DATABASE"), os.Getenv("FS_COLLECTION"), os.Getenv("CHUNK_COLLECTION"))
+	case "local":
+		return dao.NewLocalStore(os.Getenv("STORAGE_PATH"))
+	case "s3":
+		return dao.NewS3Store(dao.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			Prefix:          os.Getenv("S3_PREFIX"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       os.Getenv("S3_PATH_STYLE") == "true",
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend '%v'", backend)
+	}
+}
+
+// newConverters creates the registry of built in converters. At most PREVIEW_WORKERS conversions run
+// at once, each limited to PREVIEW_TIMEOUT.
+func newConverters() (*convert.Registry, error) {
+	timeout, err := durationFromEnv("PREVIEW_TIMEOUT")
+	if err != nil {
+		return nil, err
+	}
+
+	workers := 0
+	if value := os.Getenv("PREVIEW_WORKERS"); value != "" {
+		if workers, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("invalid PREVIEW_WORKERS: %v", err)
+		}
+	}
+
+	pool := convert.NewPool(convert.PoolConfig{Workers: workers, Timeout: timeout})
+	return convert.NewDefaultRegistry(pool), nil
+}
+
 func checkHealth(handler dao.DBHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer closeRequestBody(r)
@@ -97,6 +238,36 @@ func checkHealth(handler dao.DBHandler) http.HandlerFunc {
 	}
 }
 
+// getDebugVars serves the published expvar metrics, which describe the service's internals, to admins.
+func getDebugVars(extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if !principal.IsAdmin() {
+			respondWithError(w, http.StatusForbidden, "only admins can read debug variables")
+			return
+		}
+
+		expvar.Handler().ServeHTTP(w, r)
+	}
+}
+
+// uploadFile stores the files sent as "file" parts of a multipart form. A request with several of them
+// is handled as a batch by uploadBatch.
 func uploadFile(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -109,47 +280,73 @@ func uploadFile(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.Ha
 			return
 		}
 
-		if err := extHandler.ValidateToken(token); err != nil {
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
 			logrus.WithError(err).Error("Error validating token")
 			respondWithError(w, http.StatusUnauthorized, err.Error())
 			return
 		}
 
-		file, header, err := r.FormFile("file")
-		if err != nil {
-			logrus.WithError(err).Error("Error getting file from request")
+		if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+			logrus.WithError(err).Error("Error parsing multipart form")
 			respondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
 		defer func() {
-			if err := file.Close(); err != nil {
-				logrus.WithError(err).Error("Error closing file")
+			if err := r.MultipartForm.RemoveAll(); err != nil {
+				logrus.WithError(err).Error("Error removing temporary multipart files")
 			}
 		}()
 
-		buf := bytes.NewBuffer(nil)
-		if _, err := io.Copy(buf, file); err != nil {
-			logrus.WithError(err).Error("Error reading file")
+		files := r.MultipartForm.File["file"]
+		if len(files) == 0 {
+			logrus.WithError(http.ErrMissingFile).Error("Error getting file from request")
+			respondWithError(w, http.StatusBadRequest, http.ErrMissingFile.Error())
+			return
+		}
+
+		// Tags, metadata and the parent folder apply to every file in the request.
+		template := models.FileRequest{Owner: principal.UserID}
+
+		template.Tags, template.Metadata, err = parseFormLabels(r.MultipartForm.Value)
+		if err != nil {
+			logrus.WithError(err).Error("Error parsing tags and metadata")
 			respondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		uploadRequest := models.FileRequest{
-			Name:      header.Filename,
-			Timestamp: time.Now(),
-			Extension: filepath.Ext(header.Filename),
-			Size:      header.Size,
+		if parent := r.FormValue("parent"); parent != "" {
+			parentID, err := primitive.ObjectIDFromHex(parent)
+			if err != nil {
+				logrus.WithError(err).Error("Error converting parent to ObjectID")
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			template.Parent = &parentID
+		}
+
+		if err := authorizeParent(ctx, dbHandler, principal, template.Parent); err != nil {
+			logrus.WithError(err).Error("Error authorizing parent folder access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
 		}
 
-		if err := dbHandler.UploadFile(ctx, &uploadRequest, buf.Bytes()); err != nil {
+		if len(files) > 1 {
+			uploadBatch(ctx, w, r, dbHandler, files, template)
+			return
+		}
+
+		file, err := storeUploadedFile(ctx, dbHandler, files[0], template)
+		if err != nil {
 			logrus.WithError(err).Error("Error uploading file")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithError(w, statusForError(err), err.Error())
 			return
 		}
 
 		logrus.Info("File uploaded successfully")
-		respondWithSuccess(w, http.StatusOK, "File uploaded successfully")
+		w.Header().Set("Location", "/file/"+file.ID.Hex())
+		respondWithSuccess(w, http.StatusCreated, file)
 		return
 	}
 }
@@ -166,7 +363,8 @@ func downloadFile(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.
 			return
 		}
 
-		if err := extHandler.ValidateToken(token); err != nil {
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
 			logrus.WithError(err).Error("Error validating token")
 			respondWithError(w, http.StatusUnauthorized, err.Error())
 			return
@@ -179,22 +377,14 @@ func downloadFile(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.
 			return
 		}
 
-		fileBytes, err := dbHandler.GetFile(ctx, id)
+		file, err := authorizeFile(ctx, dbHandler, principal, id)
 		if err != nil {
-			logrus.WithError(err).Error("Error downloading file")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			logrus.WithError(err).Error("Error authorizing file access")
+			respondWithError(w, statusForError(err), err.Error())
 			return
 		}
 
-		w.Header().Set("Content-Type", mimetype.Detect(fileBytes).String())
-
-		if _, err := io.Copy(w, bytes.NewBuffer(fileBytes)); err != nil {
-			logrus.WithError(err).Error("Error writing file to response")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-
-		logrus.Info("File successfully retrieved")
+		serveFile(w, r, dbHandler, file)
 		return
 	}
 }
@@ -211,7 +401,8 @@ func deleteFile(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.Ha
 			return
 		}
 
-		if err := extHandler.ValidateToken(token); err != nil {
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
 			logrus.WithError(err).Error("Error validating token")
 			respondWithError(w, http.StatusUnauthorized, err.Error())
 			return
@@ -224,6 +415,12 @@ func deleteFile(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.Ha
 			return
 		}
 
+		if _, err := authorizeFile(ctx, dbHandler, principal, id); err != nil {
+			logrus.WithError(err).Error("Error authorizing file access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
 		if err := dbHandler.DeleteFile(ctx, id); err != nil {
 			logrus.WithError(err).Error("Error downloading file")
 			respondWithError(w, http.StatusInternalServerError, err.Error())
@@ -248,7 +445,8 @@ func updateFileInfo(dbHandler dao.DBHandler, extHandler external.ExtHandler) htt
 			return
 		}
 
-		if err := extHandler.ValidateToken(token); err != nil {
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
 			logrus.WithError(err).Error("Error validating token")
 			respondWithError(w, http.StatusUnauthorized, err.Error())
 			return
@@ -261,6 +459,12 @@ func updateFileInfo(dbHandler dao.DBHandler, extHandler external.ExtHandler) htt
 			return
 		}
 
+		if _, err := authorizeFile(ctx, dbHandler, principal, id); err != nil {
+			logrus.WithError(err).Error("Error authorizing file access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
 		var updateRequest map[string]interface{}
 		if err := json.NewDecoder(r.Body).Decode(&updateRequest); err != nil {
 			logrus.WithError(err).Error("Error decoding request body")
@@ -268,9 +472,31 @@ func updateFileInfo(dbHandler dao.DBHandler, extHandler external.ExtHandler) htt
 			return
 		}
 
+		if setsField(updateRequest, "parent") {
+			respondWithError(w, http.StatusBadRequest, "files are moved between folders through /file/{id}/move")
+			return
+		}
+
+		if setsField(updateRequest, "owner") || setsField(updateRequest, "grants") {
+			respondWithError(w, http.StatusBadRequest, "file access is changed through /file/{id}/acl")
+			return
+		}
+
+		if err := validateFileUpdate(updateRequest); err != nil {
+			logrus.WithError(err).Error("Error validating file update")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := normalizeLabelUpdates(updateRequest); err != nil {
+			logrus.WithError(err).Error("Error validating tags and metadata")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
 		if err := dbHandler.UpdateFileInfo(ctx, id, updateRequest); err != nil {
 			logrus.WithError(err).Error("Error updating file info")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithError(w, statusForError(err), err.Error())
 			return
 		}
 
@@ -280,6 +506,42 @@ func updateFileInfo(dbHandler dao.DBHandler, extHandler external.ExtHandler) htt
 	}
 }
 
+// setsField reports whether an update body sets field or, through a dotted path, any part of it.
+func setsField(updateRequest map[string]interface{}, field string) bool {
+	for key := range updateRequest {
+		if key == field || strings.HasPrefix(key, field+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// updatableFields are the fields of a file PUT /file/{id} may set. Metadata entries can also be set
+// one at a time as "metadata.<key>". Everything else is either changed through its own endpoint or
+// derived from the file's content, and must not be written by clients.
+var updatableFields = map[string]bool{"name": true, "hidden": true, "tags": true, "metadata": true}
+
+// validateFileUpdate rejects a PUT /file/{id} body that sets anything but the updatable fields.
+func validateFileUpdate(updateRequest map[string]interface{}) error {
+	for key := range updateRequest {
+		if updatableFields[key] {
+			continue
+		} else if !strings.HasPrefix(key, "metadata.") {
+			return fmt.Errorf("field '%v' cannot be updated", key)
+		} else if _, ok := updateRequest["metadata"]; ok {
+			return errors.New("metadata cannot be replaced and updated by key in the same request")
+		}
+	}
+
+	if hidden, ok := updateRequest["hidden"]; ok {
+		if _, ok := hidden.(bool); !ok {
+			return errors.New("hidden must be a boolean")
+		}
+	}
+
+	return nil
+}
+
 func getFiles(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -292,40 +554,59 @@ func getFiles(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.Hand
 			return
 		}
 
-		if err := extHandler.ValidateToken(token); err != nil {
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
 			logrus.WithError(err).Error("Error validating token")
 			respondWithError(w, http.StatusUnauthorized, err.Error())
 			return
 		}
 
-		query := make(map[string]interface{})
-		for key, val := range r.URL.Query() {
-			if key == "size" {
-				v, err := strconv.Atoi(val[0])
-				if err != nil {
-					logrus.WithError(err).Warn("Error converting 'size' query parameter to int, skipping this parameter")
-					continue
-				}
-				query[key] = v
-				continue
-			}
-			query[key] = val[0]
+		query, err := filter.Parse(r.URL.Query(), filter.ListParams...)
+		if err != nil {
+			logrus.WithError(err).Error("Error parsing filter")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
 		}
 
-		results, err := dbHandler.GetFiles(ctx, query)
+		listOptions, err := filter.ParseListOptions(r.URL.Query())
+		if err != nil {
+			logrus.WithError(err).Error("Error parsing list options")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if access := accessFilter(principal); access != nil {
+			query["$or"] = access
+		}
+
+		page, err := dbHandler.GetFiles(ctx, query, listOptions)
 		if err != nil {
 			logrus.WithError(err).Error("Error retrieving files from database")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		if len(listOptions.Fields) > 0 {
+			projected, err := projectPage(page, listOptions.Fields)
+			if err != nil {
+				logrus.WithError(err).Error("Error projecting files")
+				respondWithError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			logrus.Info("Files retrieved successfully")
+			respondWithSuccess(w, http.StatusOK, projected)
 			return
 		}
 
 		logrus.Info("Files retrieved successfully")
-		respondWithSuccess(w, http.StatusOK, results)
+		respondWithSuccess(w, http.StatusOK, page)
 		return
 	}
 }
 
-func generatePreview(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+// generatePreview serves a PDF rendering of a file, converted and cached as by serveConversion.
+func generatePreview(dbHandler dao.DBHandler, extHandler external.ExtHandler, converters *convert.Registry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		defer closeRequestBody(r)
@@ -337,7 +618,8 @@ func generatePreview(dbHandler dao.DBHandler, extHandler external.ExtHandler) ht
 			return
 		}
 
-		if err := extHandler.ValidateToken(token); err != nil {
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
 			logrus.WithError(err).Error("Error validating token")
 			respondWithError(w, http.StatusUnauthorized, err.Error())
 			return
@@ -350,69 +632,110 @@ func generatePreview(dbHandler dao.DBHandler, extHandler external.ExtHandler) ht
 			return
 		}
 
-		fileBytes, err := dbHandler.GetFile(ctx, id)
+		file, err := authorizeFile(ctx, dbHandler, principal, id)
 		if err != nil {
-			logrus.WithError(err).Error("Error downloading file")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			logrus.WithError(err).Error("Error authorizing file access")
+			respondWithError(w, statusForError(err), err.Error())
 			return
 		}
 
-		path := "./tmp"
-		dst, err := os.Create(path)
+		version, err := requestedVersion(r)
 		if err != nil {
-			logrus.WithError(err).Error("Error creating temporary file")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			logrus.WithError(err).Error("Error parsing requested version")
+			respondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		defer func() {
-			if err := dst.Close(); err != nil {
-				logrus.WithError(err).Error("Error closing temporary file location")
-			}
-			if err := os.Remove(path); err != nil {
-				logrus.WithError(err).Error("Error deleting temporary file")
-			}
-		}()
-
-		if _, err := io.Copy(dst, bytes.NewReader(fileBytes)); err != nil {
-			logrus.WithError(err).Error("Error copying bytes to temporary file")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+		revision, err := getRevision(ctx, dbHandler, file, version)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving file info")
+			respondWithError(w, statusForError(err), err.Error())
 			return
 		}
 
-		if _, err = exec.Command("soffice", "--invisible", "--convert-to", "pdf:writer_pdf_Export", path).Output(); err != nil {
-			logrus.WithError(err).Error("Error converting bytes to PDF")
-			if _, err = exec.Command("libreoffice", "--invisible", "--convert-to", "pdf:writer_pdf_Export", path).Output(); err != nil {
-				logrus.WithError(err).Error("Error converting bytes to PDF")
-				respondWithError(w, http.StatusInternalServerError, err.Error())
-				return
-			}
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+		etag := strongETag(revision.Hash, "preview")
+		setValidators(w, etag, revision.Timestamp)
+		if notModified(r, etag, revision.Timestamp) {
+			w.WriteHeader(http.StatusNotModified)
 			return
 		}
 
-		defer func() {
-			if err := os.Remove(fmt.Sprintf("%v.pdf", path)); err != nil {
-				logrus.WithError(err).Error("Error deleting temporary file")
-			}
-		}()
+		serveConversion(w, r, dbHandler, converters, id, version, revision, convert.FormatPDF)
+	}
+}
 
-		out, err := ioutil.ReadFile(fmt.Sprintf("%v.pdf", path))
-		if err != nil {
-			logrus.WithError(err).Error("Error reading output file")
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+// serveFile writes the current revision of a file, or the one selected by the "version" query
+// parameter, honouring conditional and range request headers.
+func serveFile(w http.ResponseWriter, r *http.Request, dbHandler dao.DBHandler, file *models.FileResponse) {
+	version, err := requestedVersion(r)
+	if err != nil {
+		logrus.WithError(err).Error("Error parsing requested version")
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	serveRevision(w, r, dbHandler, file, version, nil)
+}
+
+// serveRevision writes the given revision of a file, or its current revision when version is 0. A non-nil
+// claim is called once the request is known to need content rather than a 304, and told whether only
+// part of the content is sent; the response is aborted if it fails.
+func serveRevision(w http.ResponseWriter, r *http.Request, dbHandler dao.DBHandler, file *models.FileResponse, version int,
+	claim func(partial bool) error) {
+	ctx := r.Context()
+
+	revision, err := getRevision(ctx, dbHandler, file, version)
+	if err != nil {
+		logrus.WithError(err).Error("Error retrieving file info")
+		respondWithError(w, statusForError(err), err.Error())
+		return
+	}
+
+	etag := strongETag(revision.Hash, "")
+	setValidators(w, etag, revision.Timestamp)
+	if notModified(r, etag, revision.Timestamp) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if claim != nil {
+		if err := claim(rangeRequested(r, etag, revision.Timestamp)); err != nil {
+			logrus.WithError(err).Error("Error claiming download")
+			respondWithError(w, statusForError(err), err.Error())
 			return
 		}
+	}
+
+	stream, err := openRevision(ctx, dbHandler, file.ID, version)
+	if err != nil {
+		logrus.WithError(err).Error("Error downloading file")
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer func() {
+		if err := stream.Close(); err != nil {
+			logrus.WithError(err).Error("Error closing download stream")
+		}
+	}()
 
-		if _, err := io.Copy(w, bytes.NewBuffer(out)); err != nil {
-			logrus.WithError(err).Error("Error writing file to response")
+	// Revisions stored before content types were recorded are sniffed on every download instead.
+	contentType := revision.ContentType
+	if contentType == "" {
+		contentType, err = detectContentType(stream)
+		if err != nil {
+			logrus.WithError(err).Error("Error reading file")
 			respondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
-
-		logrus.Info("File successfully retrieved")
-		return
 	}
+
+	// ServeContent takes care of Range and If-Range handling, including multipart/byteranges
+	// responses, seeking the stream to each requested range rather than reading the whole file.
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, r, "", revision.Timestamp, stream)
+
+	logrus.Info("File successfully retrieved")
 }
 
 func shutdownGracefully(server *http.Server) {
@@ -457,6 +780,20 @@ func respondWithError(w http.ResponseWriter, code int, message string) {
 	}
 }
 
+func detectContentType(stream io.ReadSeeker) (string, error) {
+	head := make([]byte, mimeSniffLength)
+	n, err := io.ReadFull(stream, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	if _, err := stream.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return mimetype.Detect(head[:n]).String(), nil
+}
+
 func closeRequestBody(req *http.Request) {
 	if req.Body == nil {
 		return
@@ -468,9 +805,13 @@ func closeRequestBody(req *http.Request) {
 	return
 }
 
+// getAuthToken returns the bearer token from the Authorization header. Services may instead send an
+// API key in the X-API-Key header.
 func getAuthToken(r *http.Request) (string, error) {
 	tokenHeader := r.Header.Get("Authorization")
-	if tokenHeader == "" {
+	if tokenHeader == "" && r.Header.Get("X-API-Key") != "" {
+		return r.Header.Get("X-API-Key"), nil
+	} else if tokenHeader == "" {
 		return "", errors.New("no authorization header found")
 	} else if (len(tokenHeader) >= 7 && tokenHeader[:7] != "Bearer ") || len(strings.Split(tokenHeader, " ")) != 2 {
 		return "", errors.New("authorization header must be in format 'Bearer' <token>")
@@ -2,22 +2,42 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"content-service-api/models"
+	"content-service-api/pkg/convert"
 	"content-service-api/pkg/testhelper/mocks"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+type fileStream struct {
+	*strings.Reader
+}
+
+func (f *fileStream) Close() error {
+	return nil
+}
+
+func newFileStream(content string) *fileStream {
+	return &fileStream{Reader: strings.NewReader(content)}
+}
+
 func TestApi_CheckHealth_ShouldReturn500IfUnableToConnectToDatabase(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	dbHandler.On("Ping", mock.Anything).Return(errors.New("test"))
@@ -60,7 +80,7 @@ func TestApi_UploadFile_ShouldReturn400OnNoAuthorizationTokenFound(t *testing.T)
 func TestApi_UploadFile_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything).Return(errors.New("test"))
+	extHandler.On("ValidateToken", mock.Anything).Return(nil, errors.New("test"))
 
 	req, err := http.NewRequest(http.MethodPost, "/upload", nil)
 	require.Nil(t, err)
@@ -75,7 +95,7 @@ func TestApi_UploadFile_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T
 func TestApi_UploadFile_ShouldReturn400IfErrorOccursParsingForm(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	req, err := http.NewRequest(http.MethodPost, "/upload", nil)
 	require.Nil(t, err)
@@ -90,7 +110,7 @@ func TestApi_UploadFile_ShouldReturn400IfErrorOccursParsingForm(t *testing.T) {
 func TestApi_UploadFile_ShouldReturn400IfNoFormFieldWithKeyFileFound(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	req, err := http.NewRequest(http.MethodPost, "/upload", strings.NewReader("{}"))
 	require.Nil(t, err)
@@ -105,8 +125,8 @@ func TestApi_UploadFile_ShouldReturn400IfNoFormFieldWithKeyFileFound(t *testing.
 func TestApi_UploadFile_ShouldReturn500OnDbHandlerError(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("UploadFile", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	dbHandler.On("UploadFile", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
@@ -129,11 +149,21 @@ func TestApi_UploadFile_ShouldReturn500OnDbHandlerError(t *testing.T) {
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
-func TestApi_UploadFile_ShouldReturn200OnSuccess(t *testing.T) {
+func TestApi_UploadFile_ShouldReturn201WithCreatedFile(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("UploadFile", mock.Anything, mock.Anything, mock.Anything).Return(nil)
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	created := &models.FileResponse{
+		ID:          primitive.NewObjectID(),
+		Name:        "test.png",
+		Extension:   ".png",
+		Size:        4,
+		ContentType: "text/plain; charset=utf-8",
+		Hash:        "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		Owner:       "test",
+		Version:     1,
+	}
+	dbHandler.On("UploadFile", mock.Anything, mock.Anything, mock.Anything).Return(created, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
@@ -153,7 +183,49 @@ func TestApi_UploadFile_ShouldReturn200OnSuccess(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	httpHandler := http.HandlerFunc(uploadFile(dbHandler, extHandler))
 	httpHandler.ServeHTTP(recorder, req)
-	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	require.Equal(t, "/file/"+created.ID.Hex(), recorder.Header().Get("Location"))
+
+	var response models.FileResponse
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Equal(t, created.ID, response.ID)
+	require.Equal(t, created.ContentType, response.ContentType)
+	require.Equal(t, created.Size, response.Size)
+	require.Equal(t, created.Hash, response.Hash)
+}
+
+func TestApi_UploadFile_ShouldStreamFileContentToDbHandler(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	var uploaded []byte
+	dbHandler.On("UploadFile", mock.Anything, mock.Anything, mock.Anything).Return(&models.FileResponse{ID: primitive.NewObjectID()}, nil).Run(func(args mock.Arguments) {
+		content, err := ioutil.ReadAll(args.Get(2).(io.Reader))
+		require.Nil(t, err)
+		uploaded = content
+	})
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "test.txt")
+	require.Nil(t, err)
+
+	_, err = io.Copy(part, bytes.NewBuffer([]byte("test content")))
+	require.Nil(t, err)
+
+	require.Nil(t, writer.Close())
+
+	req, err := http.NewRequest(http.MethodPost, "/upload", body)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	require.Equal(t, "test content", string(uploaded))
 }
 
 func TestApi_DownloadFile_ShouldReturn400OnNoAuthorizationTokenFound(t *testing.T) {
@@ -172,7 +244,7 @@ func TestApi_DownloadFile_ShouldReturn400OnNoAuthorizationTokenFound(t *testing.
 func TestApi_DownloadFile_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything).Return(errors.New("test"))
+	extHandler.On("ValidateToken", mock.Anything).Return(nil, errors.New("test"))
 
 	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
 	require.Nil(t, err)
@@ -187,7 +259,7 @@ func TestApi_DownloadFile_ShouldReturn401IfErrorOccursValidatingToken(t *testing
 func TestApi_DownloadFile_ShouldReturn400IfUnableToCreateObjectIDFromGivenIDVar(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
 	require.Nil(t, err)
@@ -202,8 +274,9 @@ func TestApi_DownloadFile_ShouldReturn400IfUnableToCreateObjectIDFromGivenIDVar(
 func TestApi_DownloadFile_ShouldReturn500OnHandlerError(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("GetFile", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "test"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
 	require.Nil(t, err)
@@ -216,17 +289,219 @@ func TestApi_DownloadFile_ShouldReturn500OnHandlerError(t *testing.T) {
 	require.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
-func TestApi_DownloadFile_ShouldReturn200OnHandlerError(t *testing.T) {
+func TestApi_DownloadFile_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "test"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("test"), nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "test", recorder.Body.String())
+	require.Equal(t, "text/plain; charset=utf-8", recorder.Header().Get("Content-Type"))
+}
+
+func TestApi_DownloadFile_ShouldUseStoredContentType(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("GetFile", mock.Anything, mock.Anything).Return([]byte{}, nil)
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "test", ContentType: "application/pdf"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("test"), nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
 	require.Nil(t, err)
 	req.Header.Add("Authorization", "Bearer test")
 	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
 
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/pdf", recorder.Header().Get("Content-Type"))
+}
+
+func TestApi_DownloadFile_ShouldReturn206ForSingleRange(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "test"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("0123456789"), nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("Range", "bytes=2-5")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusPartialContent, recorder.Code)
+	require.Equal(t, "2345", recorder.Body.String())
+	require.Equal(t, "bytes", recorder.Header().Get("Accept-Ranges"))
+	require.Equal(t, "bytes 2-5/10", recorder.Header().Get("Content-Range"))
+}
+
+func TestApi_DownloadFile_ShouldReturnMultipartResponseForMultipleRanges(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "test"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("0123456789"), nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("Range", "bytes=0-1,8-")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusPartialContent, recorder.Code)
+	require.True(t, strings.HasPrefix(recorder.Header().Get("Content-Type"), "multipart/byteranges"))
+	require.Contains(t, recorder.Body.String(), "Content-Range: bytes 0-1/10")
+	require.Contains(t, recorder.Body.String(), "Content-Range: bytes 8-9/10")
+}
+
+func TestApi_DownloadFile_ShouldReturn416ForUnsatisfiableRange(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "test"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("0123456789"), nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("Range", "bytes=20-30")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusRequestedRangeNotSatisfiable, recorder.Code)
+}
+
+func TestApi_DownloadFile_ShouldReturn500IfErrorOccursRetrievingFileInfo(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+func TestApi_DownloadFile_ShouldSetValidatorHeaders(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	timestamp := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "abc", Timestamp: timestamp}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("test"), nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, `"abc"`, recorder.Header().Get("ETag"))
+	require.Equal(t, "Mon, 01 Mar 2021 12:00:00 GMT", recorder.Header().Get("Last-Modified"))
+}
+
+func TestApi_DownloadFile_ShouldReturn304IfETagMatches(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "abc"}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("If-None-Match", `"xyz", "abc"`)
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotModified, recorder.Code)
+	require.Equal(t, 0, recorder.Body.Len())
+	dbHandler.AssertNotCalled(t, "OpenFile", mock.Anything, mock.Anything)
+}
+
+func TestApi_DownloadFile_ShouldReturn200IfETagDoesNotMatch(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "abc"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("test"), nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("If-None-Match", `"xyz"`)
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "test", recorder.Body.String())
+}
+
+func TestApi_DownloadFile_ShouldReturn304IfNotModifiedSince(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	timestamp := time.Date(2021, time.March, 1, 12, 0, 0, 500, time.UTC)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "abc", Timestamp: timestamp}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("If-Modified-Since", "Mon, 01 Mar 2021 12:00:00 GMT")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotModified, recorder.Code)
+}
+
+func TestApi_DownloadFile_ShouldReturn200IfModifiedSince(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	timestamp := time.Date(2021, time.March, 2, 12, 0, 0, 0, time.UTC)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "abc", Timestamp: timestamp}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("test"), nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("If-Modified-Since", "Mon, 01 Mar 2021 12:00:00 GMT")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
 	recorder := httptest.NewRecorder()
 	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
 	httpHandler.ServeHTTP(recorder, req)
@@ -249,7 +524,7 @@ func TestApi_DeleteFile_ShouldReturn400OnNoAuthorizationTokenFound(t *testing.T)
 func TestApi_DeleteFile_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything).Return(errors.New("test"))
+	extHandler.On("ValidateToken", mock.Anything).Return(nil, errors.New("test"))
 
 	req, err := http.NewRequest(http.MethodDelete, "/file/5df25cc42d811e3b6b945c08", nil)
 	require.Nil(t, err)
@@ -264,7 +539,7 @@ func TestApi_DeleteFile_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T
 func TestApi_DeleteFile_ShouldReturn400IfUnableToCreateObjectIDFromGivenIDVar(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	req, err := http.NewRequest(http.MethodDelete, "/file/5df25cc42d811e3b6b945c08", nil)
 	require.Nil(t, err)
@@ -278,9 +553,10 @@ func TestApi_DeleteFile_ShouldReturn400IfUnableToCreateObjectIDFromGivenIDVar(t
 
 func TestApi_DeleteFile_ShouldReturn500OnDbHandlerError(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
 	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("DeleteFile", mock.Anything, mock.Anything).Return(errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	req, err := http.NewRequest(http.MethodDelete, "/file/5df25cc42d811e3b6b945c08", nil)
 	require.Nil(t, err)
@@ -295,9 +571,10 @@ func TestApi_DeleteFile_ShouldReturn500OnDbHandlerError(t *testing.T) {
 
 func TestApi_DeleteFile_ShouldReturn200OnSuccess(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
 	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("DeleteFile", mock.Anything, mock.Anything).Return(nil)
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	req, err := http.NewRequest(http.MethodDelete, "/file/5df25cc42d811e3b6b945c08", nil)
 	require.Nil(t, err)
@@ -326,7 +603,7 @@ func TestApi_UpdateFileInfo_ShouldReturn400OnNoAuthorizationTokenFound(t *testin
 func TestApi_UpdateFileInfo_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything).Return(errors.New("test"))
+	extHandler.On("ValidateToken", mock.Anything).Return(nil, errors.New("test"))
 
 	req, err := http.NewRequest(http.MethodPut, "/file/5df25cc42d811e3b6b945c08", nil)
 	require.Nil(t, err)
@@ -341,7 +618,7 @@ func TestApi_UpdateFileInfo_ShouldReturn401IfErrorOccursValidatingToken(t *testi
 func TestApi_UpdateFileInfo_ShouldReturn400IfUnableToCreateObjectIDFromGivenIDVar(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	req, err := http.NewRequest(http.MethodPut, "/file/5df25cc42d811e3b6b945c08", nil)
 	require.Nil(t, err)
@@ -355,8 +632,9 @@ func TestApi_UpdateFileInfo_ShouldReturn400IfUnableToCreateObjectIDFromGivenIDVa
 
 func TestApi_UpdateFileInfo_ShouldReturn400IfErrorsOccursDecodingRequestBody(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
 	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	req, err := http.NewRequest(http.MethodPut, "/file/5df25cc42d811e3b6b945c08", strings.NewReader(""))
 	require.Nil(t, err)
@@ -371,9 +649,10 @@ func TestApi_UpdateFileInfo_ShouldReturn400IfErrorsOccursDecodingRequestBody(t *
 
 func TestApi_UpdateFileInfo_ShouldReturn500OnDbHandlerError(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
 	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("UpdateFileInfo", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	req, err := http.NewRequest(http.MethodPut, "/file/5df25cc42d811e3b6b945c08", strings.NewReader("{}"))
 	require.Nil(t, err)
@@ -388,9 +667,10 @@ func TestApi_UpdateFileInfo_ShouldReturn500OnDbHandlerError(t *testing.T) {
 
 func TestApi_UpdateFileInfo_ShouldReturn200OnSuccess(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
 	extHandler := &mocks.ExtHandler{}
 	dbHandler.On("UpdateFileInfo", mock.Anything, mock.Anything, mock.Anything).Return(nil)
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
 	req, err := http.NewRequest(http.MethodPut, "/file/5df25cc42d811e3b6b945c08", strings.NewReader("{}"))
 	require.Nil(t, err)
@@ -403,6 +683,61 @@ func TestApi_UpdateFileInfo_ShouldReturn200OnSuccess(t *testing.T) {
 	require.Equal(t, http.StatusOK, recorder.Code)
 }
 
+func TestApi_UpdateFileInfo_ShouldReturn400OnFieldsThatAreNotUpdatable(t *testing.T) {
+	bodies := []string{
+		`{"hash":"abc"}`,
+		`{"fileBytes":"abc"}`,
+		`{"versions":[]}`,
+		`{"versions.0.hash":"abc"}`,
+		`{"version":2}`,
+		`{"size":1}`,
+		`{"contentType":"text/html"}`,
+		`{"name.first":"test"}`,
+		`{"hidden":"yes"}`,
+		`{"metadata.customer":1}`,
+		`{"metadata.a.b":"test"}`,
+		`{"metadata":{},"metadata.customer":"acme"}`,
+	}
+	for _, body := range bodies {
+		dbHandler := &mocks.DBHandler{}
+		dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+		extHandler := &mocks.ExtHandler{}
+		extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+		req, err := http.NewRequest(http.MethodPut, "/file/5df25cc42d811e3b6b945c08", strings.NewReader(body))
+		require.Nil(t, err)
+		req.Header.Add("Authorization", "Bearer test")
+		req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+		recorder := httptest.NewRecorder()
+		httpHandler := http.HandlerFunc(updateFileInfo(dbHandler, extHandler))
+		httpHandler.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusBadRequest, recorder.Code, body)
+		dbHandler.AssertNotCalled(t, "UpdateFileInfo", mock.Anything, mock.Anything, mock.Anything)
+	}
+}
+
+func TestApi_UpdateFileInfo_ShouldUpdateMetadataByKey(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	dbHandler.On("UpdateFileInfo", mock.Anything, mock.Anything, map[string]interface{}{
+		"hidden":            true,
+		"metadata.customer": "acme",
+	}).Return(nil)
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/file/5df25cc42d811e3b6b945c08", strings.NewReader(`{"hidden":true,"metadata.customer":"acme"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(updateFileInfo(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
 func TestApi_GetFiles_ShouldReturn400OnNoAuthorizationTokenFound(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
@@ -419,7 +754,7 @@ func TestApi_GetFiles_ShouldReturn400OnNoAuthorizationTokenFound(t *testing.T) {
 func TestApi_GetFiles_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	extHandler.On("ValidateToken", mock.Anything).Return(errors.New("test"))
+	extHandler.On("ValidateToken", mock.Anything).Return(nil, errors.New("test"))
 
 	req, err := http.NewRequest(http.MethodGet, "/files", nil)
 	require.Nil(t, err)
@@ -434,10 +769,10 @@ func TestApi_GetFiles_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T)
 func TestApi_GetFiles_ShouldReturn500OnDbHandlerError(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("GetFiles", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	dbHandler.On("GetFiles", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
-	req, err := http.NewRequest(http.MethodGet, "/files?size=test", nil)
+	req, err := http.NewRequest(http.MethodGet, "/files?size=1234", nil)
 	require.Nil(t, err)
 	req.Header.Add("Authorization", "Bearer test")
 
@@ -450,15 +785,219 @@ func TestApi_GetFiles_ShouldReturn500OnDbHandlerError(t *testing.T) {
 func TestApi_GetFiles_ShouldReturn200OnSuccess(t *testing.T) {
 	dbHandler := &mocks.DBHandler{}
 	extHandler := &mocks.ExtHandler{}
-	dbHandler.On("GetFiles", mock.Anything, mock.Anything).Return([]models.FileResponse{{}}, nil)
-	extHandler.On("ValidateToken", mock.Anything).Return(nil)
+	dbHandler.On("GetFiles", mock.Anything, mock.Anything, mock.Anything).Return(&models.FilePage{Files: []models.FileResponse{{}}, Total: 1}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/files?size=1234&name=test", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getFiles(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_GeneratePreview_ShouldReturn304IfETagMatches(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "abc"}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/preview/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("If-None-Match", `"preview-abc"`)
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(generatePreview(dbHandler, extHandler, newTestPreviews(writePDF)))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotModified, recorder.Code)
+	require.Equal(t, `"preview-abc"`, recorder.Header().Get("ETag"))
+	dbHandler.AssertNotCalled(t, "OpenFile", mock.Anything, mock.Anything)
+}
+
+func TestApi_GeneratePreview_ShouldNotMatchETagOfOriginalFile(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "abc"}, nil)
+	dbHandler.On("GetDerived", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
 
-	req, err := http.NewRequest(http.MethodGet, "/files?size=1234&test=test", nil)
+	req, err := http.NewRequest(http.MethodGet, "/preview/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("If-None-Match", `"abc"`)
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(generatePreview(dbHandler, extHandler, newTestPreviews(writePDF)))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+const docxType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+func newTestPreviews(converter convert.ConverterFunc) *convert.Registry {
+	registry := convert.NewRegistry(convert.NewPool(convert.PoolConfig{Workers: 1, Timeout: 50 * time.Millisecond}))
+	registry.Register(convert.FormatPDF, converter, docxType)
+	return registry
+}
+
+func writePDF(ctx context.Context, dir string, input string) (string, error) {
+	path := filepath.Join(dir, "source.pdf")
+	return path, ioutil.WriteFile(path, []byte("%PDF-1.4 test"), 0600)
+}
+
+func newPreviewRequest(t *testing.T) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, "/preview/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	return mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+}
+
+func TestApi_GeneratePreview_ShouldConvertAndCachePreview(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Name: "test.docx", ContentType: docxType, Hash: "abc"}, nil)
+	dbHandler.On("GetDerived", mock.Anything, mock.Anything, "abc", derivedConversion, convert.FormatPDF).Return(nil, mongo.ErrNoDocuments)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("document"), nil)
+	dbHandler.On("StoreDerived", mock.Anything, mock.MatchedBy(func(derived *models.Derived) bool {
+		return derived.SourceHash == "abc" && derived.Kind == derivedConversion && derived.ContentType == "application/pdf"
+	}), mock.Anything).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	var input string
+	converter := func(ctx context.Context, dir string, path string) (string, error) {
+		content, err := ioutil.ReadFile(path)
+		require.Nil(t, err)
+		input = filepath.Base(path) + ":" + string(content)
+		return writePDF(ctx, dir, path)
+	}
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(generatePreview(dbHandler, extHandler, newTestPreviews(converter)))
+	httpHandler.ServeHTTP(recorder, newPreviewRequest(t))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/pdf", recorder.Header().Get("Content-Type"))
+	require.Equal(t, "%PDF-1.4 test", recorder.Body.String())
+	require.Equal(t, "source.docx:document", input)
+	dbHandler.AssertCalled(t, "StoreDerived", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_GeneratePreview_ShouldServeCachedPreview(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	derived := &models.Derived{Kind: derivedConversion, Variant: convert.FormatPDF, ContentType: "application/pdf"}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "abc"}, nil)
+	dbHandler.On("GetDerived", mock.Anything, mock.Anything, "abc", derivedConversion, convert.FormatPDF).Return(derived, nil)
+	dbHandler.On("OpenDerived", mock.Anything, derived).Return(newFileStream("%PDF-1.4 cached"), nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	converter := func(ctx context.Context, dir string, path string) (string, error) {
+		t.Fatal("cached preview should not be converted again")
+		return "", nil
+	}
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(generatePreview(dbHandler, extHandler, newTestPreviews(converter)))
+	httpHandler.ServeHTTP(recorder, newPreviewRequest(t))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "%PDF-1.4 cached", recorder.Body.String())
+	dbHandler.AssertNotCalled(t, "OpenFile", mock.Anything, mock.Anything)
+}
+
+func TestApi_GeneratePreview_ShouldReturn504IfConversionTimesOut(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{ContentType: docxType, Hash: "abc"}, nil)
+	dbHandler.On("GetDerived", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("document"), nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	converter := func(ctx context.Context, dir string, path string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(generatePreview(dbHandler, extHandler, newTestPreviews(converter)))
+	httpHandler.ServeHTTP(recorder, newPreviewRequest(t))
+	require.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+	dbHandler.AssertNotCalled(t, "StoreDerived", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_GetFiles_ShouldReturn400OnUnknownFilterField(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/files?test=test", nil)
 	require.Nil(t, err)
 	req.Header.Add("Authorization", "Bearer test")
 
 	recorder := httptest.NewRecorder()
 	httpHandler := http.HandlerFunc(getFiles(dbHandler, extHandler))
 	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	dbHandler.AssertNotCalled(t, "GetFiles", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_GetFiles_ShouldReturn400OnInvalidFilterValue(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/files?size=test", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getFiles(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_GetDebugVars_ShouldOnlyServeAdmins(t *testing.T) {
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", "user").Return(&models.Principal{UserID: "user"}, nil)
+	extHandler.On("ValidateToken", "admin").Return(&models.Principal{UserID: "admin", Roles: []string{models.AdminRole}}, nil)
+
+	for token, code := range map[string]int{"": http.StatusBadRequest, "user": http.StatusForbidden, "admin": http.StatusOK} {
+		req, err := http.NewRequest(http.MethodGet, "/debug/vars", nil)
+		require.Nil(t, err)
+		if token != "" {
+			req.Header.Add("Authorization", "Bearer "+token)
+		}
+
+		recorder := httptest.NewRecorder()
+		httpHandler := http.HandlerFunc(getDebugVars(extHandler))
+		httpHandler.ServeHTTP(recorder, req)
+		require.Equal(t, code, recorder.Code, token)
+		if code == http.StatusOK {
+			require.Contains(t, recorder.Body.String(), `"memstats"`)
+		}
+	}
+}
+
+func TestApi_LimitDuration_ShouldOnlyLimitNonStreamingRoutes(t *testing.T) {
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	r := mux.NewRouter()
+	r.Use(limitDuration(10 * time.Millisecond))
+	r.HandleFunc("/files", slow)
+	r.Handle("/file", streaming(slow))
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/files", nil))
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/file", nil))
 	require.Equal(t, http.StatusOK, recorder.Code)
 }
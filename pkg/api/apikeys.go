@@ -0,0 +1,318 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/external"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// apiKeyPrefix marks a token as an API key, so it can be told apart from user tokens without a lookup.
+	apiKeyPrefix        = "csk_"
+	apiKeyDisplayLength = len(apiKeyPrefix) + 6
+	apiKeyLookupTimeout = 5 * time.Second
+)
+
+var apiKeyScopes = map[string]bool{
+	models.ScopeRead:   true,
+	models.ScopeWrite:  true,
+	models.ScopeDelete: true,
+	models.ScopeAdmin:  true,
+}
+
+// apiKeyValidator accepts API keys in place of user tokens and hands every other token to next. Keys
+// are looked up on every request rather than cached, so revoking one takes effect immediately.
+type apiKeyValidator struct {
+	dbHandler dao.DBHandler
+	next      external.ExtHandler
+}
+
+func (v *apiKeyValidator) ValidateToken(token string) (*models.Principal, error) {
+	if !strings.HasPrefix(token, apiKeyPrefix) {
+		return v.next.ValidateToken(token)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiKeyLookupTimeout)
+	defer cancel()
+
+	key, err := v.dbHandler.UseAPIKey(ctx, hashAPIKey(token))
+	if err == mongo.ErrNoDocuments {
+		return nil, &external.TokenError{Reason: "unknown or expired api key"}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Keys act on behalf of the user who created them, so that what they upload stays owned by that user
+	// after the key is revoked.
+	principal := &models.Principal{
+		UserID:   key.CreatedBy,
+		Scopes:   key.Scopes,
+		APIKeyID: key.ID.Hex(),
+	}
+	if principal.UserID == "" {
+		principal.UserID = "apikey:" + key.ID.Hex()
+	}
+	if key.HasScope(models.ScopeAdmin) {
+		principal.Roles = []string{models.AdminRole}
+	}
+	if key.Expires != nil {
+		principal.ExpiresAt = *key.Expires
+	}
+
+	return principal, nil
+}
+
+// principalKey is the request context key under which requireKeyScopes stores the principal of an API key.
+type principalKey struct{}
+
+// validateToken returns the principal a request's token belongs to. API keys have already been validated
+// by requireKeyScopes, whose principal is reused rather than looking the key up a second time.
+func validateToken(r *http.Request, extHandler external.ExtHandler, token string) (*models.Principal, error) {
+	if principal, ok := r.Context().Value(principalKey{}).(*models.Principal); ok {
+		return principal, nil
+	}
+	return extHandler.ValidateToken(token)
+}
+
+// requireKeyScopes rejects requests made with an API key that lacks the scope for the request's method,
+// and otherwise passes the key's principal on to the handlers in the request context. Requests with user
+// tokens are passed through untouched and authenticated by the handlers.
+func requireKeyScopes(extHandler external.ExtHandler) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := getAuthToken(r)
+			if err != nil || !strings.HasPrefix(token, apiKeyPrefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal, err := extHandler.ValidateToken(token)
+			if err != nil {
+				logrus.WithError(err).Error("Error validating api key")
+				respondWithError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			scope := scopeForRequest(r)
+			if !principal.HasScope(scope) && !principal.HasScope(models.ScopeAdmin) {
+				respondWithError(w, http.StatusForbidden, fmt.Sprintf("api key does not have the '%v' scope", scope))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+		})
+	}
+}
+
+func scopeForRequest(r *http.Request) string {
+	// Archives are requested with POST since the selection may be long, but only read files.
+	if r.Method == http.MethodPost && r.URL.Path == "/files/archive" {
+		return models.ScopeRead
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return models.ScopeRead
+	case http.MethodDelete:
+		return models.ScopeDelete
+	default:
+		return models.ScopeWrite
+	}
+}
+
+// generateAPIKey returns a new random key along with the hash it is stored under.
+func generateAPIKey() (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, hashAPIKey(key), nil
+}
+
+// hashAPIKey hashes a key for storage. Keys are long and random, so a fast unsalted hash is enough to
+// keep them from being usable if the collection leaks, and lets keys be looked up by their hash.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func createAPIKey(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if !principal.IsAdmin() {
+			respondWithError(w, http.StatusForbidden, "only admins can manage api keys")
+			return
+		}
+
+		var keyRequest models.APIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&keyRequest); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if strings.TrimSpace(keyRequest.Name) == "" {
+			respondWithError(w, http.StatusBadRequest, "api keys must have a name")
+			return
+		} else if len(keyRequest.Scopes) == 0 {
+			respondWithError(w, http.StatusBadRequest, "api keys must have at least one scope")
+			return
+		} else if keyRequest.ExpiresIn < 0 {
+			respondWithError(w, http.StatusBadRequest, "expiresIn cannot be negative")
+			return
+		}
+
+		for _, scope := range keyRequest.Scopes {
+			if !apiKeyScopes[scope] {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("unknown scope '%v'", scope))
+				return
+			}
+		}
+
+		secret, hash, err := generateAPIKey()
+		if err != nil {
+			logrus.WithError(err).Error("Error generating api key")
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		now := time.Now()
+		key := models.APIKey{
+			Name:      keyRequest.Name,
+			Prefix:    secret[:apiKeyDisplayLength],
+			Hash:      hash,
+			Scopes:    keyRequest.Scopes,
+			CreatedBy: principal.UserID,
+			Created:   now,
+		}
+		if keyRequest.ExpiresIn > 0 {
+			expires := now.Add(time.Duration(keyRequest.ExpiresIn) * time.Second)
+			key.Expires = &expires
+		}
+
+		if err := dbHandler.CreateAPIKey(ctx, &key); err != nil {
+			logrus.WithError(err).Error("Error creating api key")
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		key.Key = secret
+
+		logrus.Info("API key created successfully")
+		respondWithSuccess(w, http.StatusOK, key)
+		return
+	}
+}
+
+func getAPIKeys(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if !principal.IsAdmin() {
+			respondWithError(w, http.StatusForbidden, "only admins can manage api keys")
+			return
+		}
+
+		keys, err := dbHandler.GetAPIKeys(ctx)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving api keys")
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		logrus.Info("API keys retrieved successfully")
+		respondWithSuccess(w, http.StatusOK, keys)
+		return
+	}
+}
+
+func revokeAPIKey(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if !principal.IsAdmin() {
+			respondWithError(w, http.StatusForbidden, "only admins can manage api keys")
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := dbHandler.DeleteAPIKey(ctx, id); err != nil {
+			logrus.WithError(err).Error("Error revoking api key")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		logrus.Info("API key revoked successfully")
+		respondWithSuccess(w, http.StatusOK, "API key revoked successfully")
+		return
+	}
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"content-service-api/models"
+	"content-service-api/pkg/external"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestApi_APIKeyValidator_ShouldDelegateUserTokens(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", "test").Return(&models.Principal{UserID: "test"}, nil)
+
+	validator := &apiKeyValidator{dbHandler: dbHandler, next: extHandler}
+
+	principal, err := validator.ValidateToken("test")
+	require.Nil(t, err)
+	require.Equal(t, "test", principal.UserID)
+	dbHandler.AssertNotCalled(t, "UseAPIKey", mock.Anything, mock.Anything)
+}
+
+func TestApi_APIKeyValidator_ShouldLookUpKeysByHash(t *testing.T) {
+	key, hash, err := generateAPIKey()
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(key, apiKeyPrefix))
+
+	keyID := primitive.NewObjectID()
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("UseAPIKey", mock.Anything, hash).Return(&models.APIKey{ID: keyID, Scopes: []string{models.ScopeAdmin}, CreatedBy: "creator"}, nil)
+
+	validator := &apiKeyValidator{dbHandler: dbHandler, next: &mocks.ExtHandler{}}
+
+	principal, err := validator.ValidateToken(key)
+	require.Nil(t, err)
+	require.Equal(t, "creator", principal.UserID)
+	require.Equal(t, keyID.Hex(), principal.APIKeyID)
+	require.True(t, principal.IsAdmin())
+}
+
+func TestApi_APIKeyValidator_ShouldRejectUnknownKeys(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("UseAPIKey", mock.Anything, mock.Anything).Return(nil, mongo.ErrNoDocuments)
+
+	validator := &apiKeyValidator{dbHandler: dbHandler, next: &mocks.ExtHandler{}}
+
+	_, err := validator.ValidateToken(apiKeyPrefix + "test")
+	require.NotNil(t, err)
+	require.True(t, external.IsRejected(err))
+}
+
+func TestApi_RequireKeyScopes_ShouldEnforceScopesForAPIKeys(t *testing.T) {
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", apiKeyPrefix+"read").Return(&models.Principal{Scopes: []string{models.ScopeRead}}, nil)
+	extHandler.On("ValidateToken", apiKeyPrefix+"admin").Return(&models.Principal{Scopes: []string{models.ScopeAdmin}}, nil)
+	extHandler.On("ValidateToken", apiKeyPrefix+"revoked").Return(nil, errors.New("test"))
+
+	handler := requireKeyScopes(extHandler)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		method string
+		token  string
+		header string
+		code   int
+	}{
+		{http.MethodGet, apiKeyPrefix + "read", "X-API-Key", http.StatusNoContent},
+		{http.MethodGet, "Bearer " + apiKeyPrefix + "read", "Authorization", http.StatusNoContent},
+		{http.MethodDelete, apiKeyPrefix + "read", "X-API-Key", http.StatusForbidden},
+		{http.MethodPost, apiKeyPrefix + "read", "X-API-Key", http.StatusForbidden},
+		{http.MethodDelete, apiKeyPrefix + "admin", "X-API-Key", http.StatusNoContent},
+		{http.MethodGet, apiKeyPrefix + "revoked", "X-API-Key", http.StatusUnauthorized},
+		{http.MethodDelete, "Bearer test", "Authorization", http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, "/file/5df25cc42d811e3b6b945c08", nil)
+		require.Nil(t, err)
+		req.Header.Add(test.header, test.token)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		require.Equal(t, test.code, recorder.Code, "%v %v", test.method, test.token)
+	}
+	extHandler.AssertNotCalled(t, "ValidateToken", "test")
+}
+
+func TestApi_RequireKeyScopes_ShouldOnlyValidateKeysOnce(t *testing.T) {
+	key, hash, err := generateAPIKey()
+	require.Nil(t, err)
+
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("UseAPIKey", mock.Anything, hash).Return(&models.APIKey{ID: primitive.NewObjectID(), Scopes: []string{models.ScopeWrite}, CreatedBy: "creator"}, nil)
+	dbHandler.On("UploadFile", mock.Anything, mock.MatchedBy(func(uploadRequest *models.FileRequest) bool {
+		return uploadRequest.Owner == "creator"
+	}), mock.Anything).Return(&models.FileResponse{}, nil)
+	validator := &apiKeyValidator{dbHandler: dbHandler, next: &mocks.ExtHandler{}}
+
+	req := newBatchUploadRequest(t, nil, "test.txt")
+	req.Header.Del("Authorization")
+	req.Header.Add("X-API-Key", key)
+
+	recorder := httptest.NewRecorder()
+	handler := requireKeyScopes(validator)(http.HandlerFunc(uploadFile(dbHandler, validator)))
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	dbHandler.AssertNumberOfCalls(t, "UseAPIKey", 1)
+}
+
+func TestApi_RequireKeyScopes_ShouldTreatArchivesAsReads(t *testing.T) {
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", apiKeyPrefix+"read").Return(&models.Principal{Scopes: []string{models.ScopeRead}}, nil)
+
+	handler := requireKeyScopes(extHandler)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req, err := http.NewRequest(http.MethodPost, "/files/archive", nil)
+	require.Nil(t, err)
+	req.Header.Add("X-API-Key", apiKeyPrefix+"read")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+}
+
+func TestApi_CreateAPIKey_ShouldReturn403IfNotAdmin(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/apikeys", strings.NewReader(`{"name": "test", "scopes": ["read"]}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createAPIKey(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestApi_CreateAPIKey_ShouldReturn400OnUnknownScope(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test", Roles: []string{models.AdminRole}}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/apikeys", strings.NewReader(`{"name": "test", "scopes": ["everything"]}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createAPIKey(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_CreateAPIKey_ShouldReturnKeyOnceAndStoreItsHash(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test", Roles: []string{models.AdminRole}}, nil)
+
+	var stored *models.APIKey
+	dbHandler.On("CreateAPIKey", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(*models.APIKey)
+	})
+
+	req, err := http.NewRequest(http.MethodPost, "/apikeys", strings.NewReader(`{"name": "test", "scopes": ["read", "write"], "expiresIn": 3600}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createAPIKey(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response map[string]interface{}
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.NotContains(t, response, "hash")
+
+	key := response["key"].(string)
+	require.Equal(t, hashAPIKey(key), stored.Hash)
+	require.Equal(t, key[:apiKeyDisplayLength], response["prefix"])
+	require.Equal(t, "test", stored.CreatedBy)
+	require.NotNil(t, stored.Expires)
+}
+
+func TestApi_RevokeAPIKey_ShouldReturn404IfKeyNotFound(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test", Roles: []string{models.AdminRole}}, nil)
+	dbHandler.On("DeleteAPIKey", mock.Anything, mock.Anything).Return(mongo.ErrNoDocuments)
+
+	req, err := http.NewRequest(http.MethodDelete, "/apikey/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(revokeAPIKey(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
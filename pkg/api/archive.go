@@ -0,0 +1,323 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/external"
+	"content-service-api/pkg/filter"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	archiveFormatZip   = "zip"
+	archiveFormatTarGz = "tar.gz"
+	// maxArchiveFiles is the most files a single archive may contain.
+	maxArchiveFiles = 1000
+	// archiveManifestName is the entry listing the requested files that are missing from an archive.
+	archiveManifestName = "manifest.json"
+)
+
+var (
+	errArchiveTooLarge      = fmt.Errorf("an archive cannot contain more than %v files", maxArchiveFiles)
+	errArchiveSelection     = errors.New("either ids or filter can be given, not both")
+	errUnknownArchiveFormat = fmt.Errorf("format must be '%v' or '%v'", archiveFormatZip, archiveFormatTarGz)
+)
+
+// archiveWriter writes the entries of an archive one after another.
+type archiveWriter interface {
+	// add starts a new entry, whose content is then written to the returned writer.
+	add(name string, size int64, modified time.Time) (io.Writer, error)
+	Close() error
+}
+
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (z *zipArchive) add(name string, size int64, modified time.Time) (io.Writer, error) {
+	return z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+}
+
+type tarArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func newTarArchive(w io.Writer) *tarArchive {
+	gz := gzip.NewWriter(w)
+	return &tarArchive{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+func (t *tarArchive) add(name string, size int64, modified time.Time) (io.Writer, error) {
+	header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0644, ModTime: modified}
+	if err := t.tw.WriteHeader(header); err != nil {
+		return nil, err
+	}
+	return t.tw, nil
+}
+
+func (t *tarArchive) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
+
+// archiveNames hands out entry names, renaming duplicates the way desktop file managers do. Names are
+// compared case insensitively so that the archive also extracts cleanly on case insensitive file systems.
+type archiveNames map[string]bool
+
+func (n archiveNames) unique(name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 1; n[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%v (%v)%v", base, i, ext)
+	}
+
+	n[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// downloadArchive streams the selected files as a single zip or gzipped tar archive. Entries are written
+// as they are read from the blob store, so nothing is buffered beyond what the archive formats need.
+// Requested files that cannot be included are listed in a manifest entry at the end of the archive.
+func downloadArchive(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		var archiveRequest models.ArchiveRequest
+		if err := json.NewDecoder(r.Body).Decode(&archiveRequest); err != nil {
+			logrus.WithError(err).Error("Error decoding archive request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if archiveRequest.Format == "" {
+			archiveRequest.Format = archiveFormatZip
+		} else if archiveRequest.Format != archiveFormatZip && archiveRequest.Format != archiveFormatTarGz {
+			logrus.WithError(errUnknownArchiveFormat).Error("Error parsing archive format")
+			respondWithError(w, http.StatusBadRequest, errUnknownArchiveFormat.Error())
+			return
+		}
+
+		if len(archiveRequest.IDs) > 0 && len(archiveRequest.Filter) > 0 {
+			logrus.WithError(errArchiveSelection).Error("Error parsing archive request")
+			respondWithError(w, http.StatusBadRequest, errArchiveSelection.Error())
+			return
+		}
+
+		var files []models.FileResponse
+		var missing []models.ArchiveMissing
+		if len(archiveRequest.IDs) > 0 {
+			if len(archiveRequest.IDs) > maxArchiveFiles {
+				logrus.WithError(errArchiveTooLarge).Error("Error parsing archive request")
+				respondWithError(w, http.StatusBadRequest, errArchiveTooLarge.Error())
+				return
+			}
+
+			ids := make([]primitive.ObjectID, 0, len(archiveRequest.IDs))
+			for _, hex := range archiveRequest.IDs {
+				id, err := primitive.ObjectIDFromHex(hex)
+				if err != nil {
+					logrus.WithError(err).Error("Error converting ID to ObjectID")
+					respondWithError(w, http.StatusBadRequest, err.Error())
+					return
+				}
+				ids = append(ids, id)
+			}
+
+			files, missing, err = archiveFilesByID(ctx, dbHandler, principal, ids)
+		} else {
+			values := url.Values{}
+			for key, value := range archiveRequest.Filter {
+				values.Set(key, value)
+			}
+
+			var query map[string]interface{}
+			query, err = filter.Parse(values, filter.ListParams...)
+			if err != nil {
+				logrus.WithError(err).Error("Error parsing filter")
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			files, err = archiveFilesByFilter(ctx, dbHandler, principal, query)
+		}
+		if err != nil {
+			logrus.WithError(err).Error("Error selecting files for archive")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		var archive archiveWriter
+		if archiveRequest.Format == archiveFormatTarGz {
+			w.Header().Set("Content-Type", "application/gzip")
+			archive = newTarArchive(w)
+		} else {
+			w.Header().Set("Content-Type", "application/zip")
+			archive = &zipArchive{zip.NewWriter(w)}
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"files.%v\"", archiveRequest.Format))
+		w.WriteHeader(http.StatusOK)
+
+		// From here on the status has been sent, so failures can only be reported by cutting the archive
+		// short, which clients detect as a corrupt download.
+		names := archiveNames{}
+		for i := range files {
+			file := &files[i]
+
+			stream, err := dbHandler.OpenFile(ctx, file.ID)
+			if err != nil {
+				logrus.WithError(err).WithField("id", file.ID.Hex()).Error("Error opening file for archive")
+				missing = append(missing, models.ArchiveMissing{ID: file.ID.Hex(), Name: file.Name, Error: err.Error()})
+				continue
+			}
+
+			err = writeArchiveEntry(archive, names.unique(archiveEntryName(file)), file.Timestamp, stream)
+			if closeErr := stream.Close(); closeErr != nil {
+				logrus.WithError(closeErr).Error("Error closing download stream")
+			}
+			if err != nil {
+				logrus.WithError(err).WithField("id", file.ID.Hex()).Error("Error writing archive entry")
+				return
+			}
+		}
+
+		if len(missing) > 0 {
+			manifest, err := json.MarshalIndent(models.ArchiveManifest{Missing: missing}, "", "  ")
+			if err != nil {
+				logrus.WithError(err).Error("Error encoding archive manifest")
+				return
+			}
+
+			entry, err := archive.add(names.unique(archiveManifestName), int64(len(manifest)), time.Now())
+			if err == nil {
+				_, err = entry.Write(manifest)
+			}
+			if err != nil {
+				logrus.WithError(err).Error("Error writing archive manifest")
+				return
+			}
+		}
+
+		if err := archive.Close(); err != nil {
+			logrus.WithError(err).Error("Error finishing archive")
+			return
+		}
+
+		logrus.WithField("count", len(files)).Info("Archive created successfully")
+	}
+}
+
+// archiveFilesByID looks up the requested files, reporting the ones that do not exist or that the
+// principal cannot access as missing. IDs given more than once are only included once.
+func archiveFilesByID(ctx context.Context, dbHandler dao.DBHandler, principal *models.Principal, ids []primitive.ObjectID) ([]models.FileResponse, []models.ArchiveMissing, error) {
+	files := make([]models.FileResponse, 0, len(ids))
+	missing := []models.ArchiveMissing{}
+	seen := make(map[primitive.ObjectID]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		file, err := authorizeFile(ctx, dbHandler, principal, id)
+		if dao.IsNotFound(err) || err == errForbidden {
+			missing = append(missing, models.ArchiveMissing{ID: id.Hex(), Error: err.Error()})
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		files = append(files, *file)
+	}
+
+	return files, missing, nil
+}
+
+// archiveFilesByFilter lists every file matching query that the principal can access.
+func archiveFilesByFilter(ctx context.Context, dbHandler dao.DBHandler, principal *models.Principal, query map[string]interface{}) ([]models.FileResponse, error) {
+	if access := accessFilter(principal); access != nil {
+		query["$or"] = access
+	}
+
+	files := []models.FileResponse{}
+	listOptions := &models.ListOptions{Limit: models.MaxPageSize}
+	for {
+		page, err := dbHandler.GetFiles(ctx, query, listOptions)
+		if err != nil {
+			return nil, err
+		} else if page.Total > maxArchiveFiles {
+			return nil, errArchiveTooLarge
+		}
+
+		files = append(files, page.Files...)
+		if page.Next == "" {
+			return files, nil
+		}
+		listOptions.Next = page.Next
+	}
+}
+
+// writeArchiveEntry copies a stored file into a new archive entry. The size is taken from the stream
+// rather than the file's metadata since tar headers must match the content exactly.
+func writeArchiveEntry(archive archiveWriter, name string, modified time.Time, stream dao.FileStream) error {
+	size, err := stream.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := stream.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	entry, err := archive.add(name, size, modified)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, stream)
+	return err
+}
+
+// archiveEntryName returns a file's name as a single path element, so that no entry can be extracted
+// outside the directory the archive is extracted into.
+func archiveEntryName(file *models.FileResponse) string {
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(file.Name)
+	if name == "" || name == "." || name == ".." {
+		return file.ID.Hex()
+	}
+	return name
+}
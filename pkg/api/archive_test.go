@@ -0,0 +1,156 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"content-service-api/models"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func newArchiveRequest(t *testing.T, body string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, "/files/archive", strings.NewReader(body))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	return req
+}
+
+func readZip(t *testing.T, body []byte) map[string]string {
+	reader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.Nil(t, err)
+
+	entries := make(map[string]string)
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		require.Nil(t, err)
+		content, err := ioutil.ReadAll(rc)
+		require.Nil(t, err)
+		require.Nil(t, rc.Close())
+		entries[file.Name] = string(content)
+	}
+	return entries
+}
+
+func TestApi_DownloadArchive_ShouldZipRequestedFilesAndReportMissingOnes(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	first, second, missing, forbidden := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	dbHandler.On("GetFileInfo", mock.Anything, first).Return(&models.FileResponse{ID: first, Name: "report.txt"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, second).Return(&models.FileResponse{ID: second, Name: "Report.txt"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, missing).Return(nil, mongo.ErrNoDocuments)
+	dbHandler.On("GetFileInfo", mock.Anything, forbidden).Return(&models.FileResponse{ID: forbidden, Owner: "other"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, first).Return(newFileStream("first"), nil)
+	dbHandler.On("OpenFile", mock.Anything, second).Return(newFileStream("second"), nil)
+
+	body := `{"ids": ["` + first.Hex() + `", "` + second.Hex() + `", "` + missing.Hex() + `", "` + forbidden.Hex() + `", "` + first.Hex() + `"]}`
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadArchive(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, newArchiveRequest(t, body))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/zip", recorder.Header().Get("Content-Type"))
+
+	entries := readZip(t, recorder.Body.Bytes())
+	require.Len(t, entries, 3)
+	require.Equal(t, "first", entries["report.txt"])
+	require.Equal(t, "second", entries["Report (1).txt"])
+
+	var manifest models.ArchiveManifest
+	require.Nil(t, json.Unmarshal([]byte(entries[archiveManifestName]), &manifest))
+	require.Len(t, manifest.Missing, 2)
+	require.Equal(t, missing.Hex(), manifest.Missing[0].ID)
+	require.Equal(t, forbidden.Hex(), manifest.Missing[1].ID)
+	require.Equal(t, errForbidden.Error(), manifest.Missing[1].Error)
+	dbHandler.AssertNumberOfCalls(t, "OpenFile", 2)
+}
+
+func TestApi_DownloadArchive_ShouldTarFilesMatchingFilter(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	dbHandler.On("GetFiles", mock.Anything, mock.MatchedBy(func(query map[string]interface{}) bool {
+		return query["tags"] != nil && query["$or"] != nil
+	}), mock.MatchedBy(func(listOptions *models.ListOptions) bool {
+		return listOptions.Next == ""
+	})).Return(&models.FilePage{Files: []models.FileResponse{{ID: first, Name: "a/b.txt"}}, Total: 2, Next: "next"}, nil).Once()
+	dbHandler.On("GetFiles", mock.Anything, mock.Anything, mock.MatchedBy(func(listOptions *models.ListOptions) bool {
+		return listOptions.Next == "next"
+	})).Return(&models.FilePage{Files: []models.FileResponse{{ID: second, Name: ".."}}, Total: 2}, nil).Once()
+	dbHandler.On("OpenFile", mock.Anything, first).Return(newFileStream("first"), nil)
+	dbHandler.On("OpenFile", mock.Anything, second).Return(newFileStream("second"), nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadArchive(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, newArchiveRequest(t, `{"filter": {"tag": "invoice"}, "format": "tar.gz"}`))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/gzip", recorder.Header().Get("Content-Type"))
+
+	gz, err := gzip.NewReader(recorder.Body)
+	require.Nil(t, err)
+	reader := tar.NewReader(gz)
+
+	entries := make(map[string]string)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		content, err := ioutil.ReadAll(reader)
+		require.Nil(t, err)
+		entries[header.Name] = string(content)
+	}
+
+	require.Equal(t, map[string]string{"a_b.txt": "first", second.Hex(): "second"}, entries)
+}
+
+func TestApi_DownloadArchive_ShouldReturn400IfFilterMatchesTooManyFiles(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+	dbHandler.On("GetFiles", mock.Anything, mock.Anything, mock.Anything).Return(&models.FilePage{Total: maxArchiveFiles + 1}, nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadArchive(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, newArchiveRequest(t, `{}`))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	dbHandler.AssertNotCalled(t, "OpenFile", mock.Anything, mock.Anything)
+}
+
+func TestApi_DownloadArchive_ShouldReturn400OnInvalidRequest(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	for _, body := range []string{
+		`{"ids": ["test"]}`,
+		`{"ids": ["5df25cc42d811e3b6b945c08"], "filter": {"tag": "invoice"}}`,
+		`{"filter": {"$where": "true"}}`,
+		`{"format": "rar"}`,
+		`not json`,
+	} {
+		recorder := httptest.NewRecorder()
+		httpHandler := http.HandlerFunc(downloadArchive(dbHandler, extHandler))
+		httpHandler.ServeHTTP(recorder, newArchiveRequest(t, body))
+		require.Equal(t, http.StatusBadRequest, recorder.Code, body)
+	}
+	dbHandler.AssertNotCalled(t, "GetFiles", mock.Anything, mock.Anything, mock.Anything)
+}
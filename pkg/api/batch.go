@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+
+	"github.com/sirupsen/logrus"
+)
+
+var errBatchRolledBack = errors.New("not stored because another file in the batch failed")
+
+// uploadBatch stores every file of a multi-file upload and reports the outcome of each. By default
+// files are stored independently and the response is 207 Multi-Status if any of them failed. With the
+// form field atomic=true the first failure stops the batch and the files already stored are deleted
+// again, so that either all of the files are stored or none are.
+func uploadBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, dbHandler dao.DBHandler, files []*multipart.FileHeader, template models.FileRequest) {
+	atomic := false
+	if value := r.FormValue("atomic"); value != "" {
+		var err error
+		if atomic, err = strconv.ParseBool(value); err != nil {
+			respondWithError(w, http.StatusBadRequest, "atomic must be true or false")
+			return
+		}
+	}
+
+	response := models.BatchUploadResponse{Files: make([]models.UploadResult, 0, len(files))}
+	var firstErr error
+	for _, header := range files {
+		result := models.UploadResult{Name: header.Filename}
+
+		if atomic && firstErr != nil {
+			result.Status, result.Error = http.StatusFailedDependency, errBatchRolledBack.Error()
+			response.Files = append(response.Files, result)
+			continue
+		}
+
+		file, err := storeUploadedFile(ctx, dbHandler, header, template)
+		if err != nil {
+			logrus.WithError(err).WithField("name", header.Filename).Error("Error uploading file")
+			result.Status, result.Error = statusForError(err), err.Error()
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			result.Status, result.ID = http.StatusCreated, &file.ID
+		}
+		response.Files = append(response.Files, result)
+	}
+
+	if firstErr == nil {
+		logrus.WithField("count", len(files)).Info("Files uploaded successfully")
+		respondWithSuccess(w, http.StatusOK, response)
+		return
+	}
+
+	if !atomic {
+		logrus.Warn("Some files of the batch could not be uploaded")
+		respondWithSuccess(w, http.StatusMultiStatus, response)
+		return
+	}
+
+	for i, result := range response.Files {
+		if result.ID == nil {
+			continue
+		}
+
+		if err := dbHandler.DeleteFile(ctx, *result.ID); err != nil {
+			logrus.WithError(err).WithField("id", result.ID.Hex()).Error("Error rolling back batch upload")
+			continue
+		}
+		response.Files[i] = models.UploadResult{
+			Name:   result.Name,
+			Status: http.StatusFailedDependency,
+			Error:  errBatchRolledBack.Error(),
+		}
+	}
+
+	respondWithSuccess(w, statusForError(firstErr), response)
+}
+
+// storeUploadedFile stores one file of a multipart upload, with the owner, labels and parent folder
+// given by template.
+func storeUploadedFile(ctx context.Context, dbHandler dao.DBHandler, header *multipart.FileHeader, template models.FileRequest) (*models.FileResponse, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			logrus.WithError(err).Error("Error closing file")
+		}
+	}()
+
+	uploadRequest := template
+	uploadRequest.Name = header.Filename
+	uploadRequest.Timestamp = time.Now()
+	uploadRequest.Extension = filepath.Ext(header.Filename)
+	uploadRequest.Size = header.Size
+
+	return dbHandler.UploadFile(ctx, &uploadRequest, file)
+}
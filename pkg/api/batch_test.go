@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newBatchUploadRequest(t *testing.T, fields map[string]string, names ...string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		require.Nil(t, writer.WriteField(key, value))
+	}
+	for _, name := range names {
+		part, err := writer.CreateFormFile("file", name)
+		require.Nil(t, err)
+		_, err = io.Copy(part, strings.NewReader("test "+name))
+		require.Nil(t, err)
+	}
+	require.Nil(t, writer.Close())
+
+	req, err := http.NewRequest(http.MethodPost, "/upload", body)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func uploadNamed(name string) interface{} {
+	return mock.MatchedBy(func(uploadRequest *models.FileRequest) bool {
+		return uploadRequest.Name == name
+	})
+}
+
+func TestApi_UploadFile_ShouldStoreEveryFileOfABatch(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+	dbHandler.On("UploadFile", mock.Anything, mock.MatchedBy(func(uploadRequest *models.FileRequest) bool {
+		return uploadRequest.Name == "a.txt" && uploadRequest.Owner == "test" && uploadRequest.Tags[0] == "batch"
+	}), mock.Anything).Return(&models.FileResponse{ID: ids[0]}, nil)
+	dbHandler.On("UploadFile", mock.Anything, uploadNamed("b.txt"), mock.Anything).Return(&models.FileResponse{ID: ids[1]}, nil)
+
+	req := newBatchUploadRequest(t, map[string]string{"tags": "batch"}, "a.txt", "b.txt")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response models.BatchUploadResponse
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Len(t, response.Files, 2)
+	for i, name := range []string{"a.txt", "b.txt"} {
+		require.Equal(t, name, response.Files[i].Name)
+		require.Equal(t, http.StatusCreated, response.Files[i].Status)
+		require.Equal(t, ids[i], *response.Files[i].ID)
+	}
+}
+
+func TestApi_UploadFile_ShouldReportPartialSuccess(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	dbHandler.On("UploadFile", mock.Anything, uploadNamed("a.txt"), mock.Anything).Return(&models.FileResponse{ID: primitive.NewObjectID()}, nil)
+	dbHandler.On("UploadFile", mock.Anything, uploadNamed("b.txt"), mock.Anything).Return(nil, dao.ErrNameConflict)
+	dbHandler.On("UploadFile", mock.Anything, uploadNamed("c.txt"), mock.Anything).Return(&models.FileResponse{ID: primitive.NewObjectID()}, nil)
+
+	req := newBatchUploadRequest(t, nil, "a.txt", "b.txt", "c.txt")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusMultiStatus, recorder.Code)
+
+	var response models.BatchUploadResponse
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Len(t, response.Files, 3)
+	require.NotNil(t, response.Files[0].ID)
+	require.Nil(t, response.Files[1].ID)
+	require.Equal(t, http.StatusConflict, response.Files[1].Status)
+	require.Equal(t, dao.ErrNameConflict.Error(), response.Files[1].Error)
+	require.NotNil(t, response.Files[2].ID)
+	dbHandler.AssertNotCalled(t, "DeleteFile", mock.Anything, mock.Anything)
+}
+
+func TestApi_UploadFile_ShouldRollBackAtomicBatchOnFailure(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	stored := primitive.NewObjectID()
+	dbHandler.On("UploadFile", mock.Anything, uploadNamed("a.txt"), mock.Anything).Return(&models.FileResponse{ID: stored}, nil)
+	dbHandler.On("UploadFile", mock.Anything, uploadNamed("b.txt"), mock.Anything).Return(nil, dao.ErrNameConflict)
+	dbHandler.On("DeleteFile", mock.Anything, stored).Return(nil)
+
+	req := newBatchUploadRequest(t, map[string]string{"atomic": "true"}, "a.txt", "b.txt", "c.txt")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+
+	var response models.BatchUploadResponse
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Len(t, response.Files, 3)
+	for _, result := range response.Files {
+		require.Nil(t, result.ID)
+		require.NotEmpty(t, result.Error)
+	}
+	require.Equal(t, http.StatusConflict, response.Files[1].Status)
+	require.Equal(t, http.StatusFailedDependency, response.Files[2].Status)
+	dbHandler.AssertCalled(t, "DeleteFile", mock.Anything, stored)
+	dbHandler.AssertNotCalled(t, "UploadFile", mock.Anything, uploadNamed("c.txt"), mock.Anything)
+}
+
+func TestApi_UploadFile_ShouldReturn400OnInvalidAtomicFlag(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req := newBatchUploadRequest(t, map[string]string{"atomic": "maybe"}, "a.txt", "b.txt")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	dbHandler.AssertNotCalled(t, "UploadFile", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// strongETag builds a strong entity tag from a content hash, optionally qualified by the
+// representation it identifies so that e.g. a file and its preview never share a tag.
+func strongETag(hash string, representation string) string {
+	if representation == "" {
+		return fmt.Sprintf("%q", hash)
+	}
+	return fmt.Sprintf("%q", fmt.Sprintf("%v-%v", representation, hash))
+}
+
+// setValidators writes the ETag and Last-Modified headers for a response. Responses are private
+// since every route requires authorization, and must be revalidated before a cached copy is reused.
+func setValidators(w http.ResponseWriter, etag string, modified time.Time) {
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", etag)
+	if !isZeroTime(modified) {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified evaluates If-None-Match and If-Modified-Since as described in RFC 7232. If-None-Match
+// takes precedence when both are present, and If-Modified-Since only applies to GET and HEAD.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagListMatches(inm, etag)
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || isZeroTime(modified) {
+		return false
+	}
+
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// rangeRequested reports whether http.ServeContent will answer r with part of the content rather than
+// all of it, that is whether r has a Range header and any If-Range precondition holds. If-Range takes a
+// strong entity tag or an exact modification date.
+func rangeRequested(r *http.Request, etag string, modified time.Time) bool {
+	if r.Header.Get("Range") == "" {
+		return false
+	}
+
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	} else if strings.HasPrefix(ir, `"`) {
+		return ir == etag
+	}
+
+	date, err := http.ParseTime(ir)
+	return err == nil && !isZeroTime(modified) && modified.Truncate(time.Second).Equal(date)
+}
+
+// etagListMatches performs the weak comparison If-None-Match calls for against a comma separated
+// list of entity tags.
+func etagListMatches(list string, etag string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func isZeroTime(t time.Time) bool {
+	return t.IsZero() || t.Equal(time.Unix(0, 0))
+}
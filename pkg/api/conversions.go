@@ -0,0 +1,160 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"content-service-api/models"
+	"content-service-api/pkg/convert"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/external"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// derivedConversion is the kind converted files are stored under as derived content, with the format
+// they were converted to as the variant. Previews are conversions to PDF and share the stored copies.
+const derivedConversion = "conversion"
+
+// convertFile serves a file converted to the format given by the "to" query parameter, or 415 if there
+// is no converter from the file's content type to that format.
+func convertFile(dbHandler dao.DBHandler, extHandler external.ExtHandler, converters *convert.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting given ID to objectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		format := r.URL.Query().Get("to")
+		if _, ok := convert.Formats[format]; !ok {
+			err := fmt.Errorf("unknown format '%v', must be one of pdf, png, html or txt", format)
+			logrus.WithError(err).Error("Error parsing conversion format")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		file, err := authorizeFile(ctx, dbHandler, principal, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error authorizing file access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		version, err := requestedVersion(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error parsing requested version")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		revision, err := getRevision(ctx, dbHandler, file, version)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving file info")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		etag := strongETag(revision.Hash, "convert-"+format)
+		setValidators(w, etag, revision.Timestamp)
+		if notModified(r, etag, revision.Timestamp) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		serveConversion(w, r, dbHandler, converters, id, version, revision, format)
+	}
+}
+
+// serveConversion writes a revision of a file converted to format. Conversions are made on first
+// request and stored as derived content of the revision, from where later requests are served. Files
+// already in the format are served as they are.
+func serveConversion(w http.ResponseWriter, r *http.Request, dbHandler dao.DBHandler, converters *convert.Registry,
+	id primitive.ObjectID, version int, revision *models.FileVersion, format string) {
+	ctx := r.Context()
+
+	derived, err := dbHandler.GetDerived(ctx, id, revision.Hash, derivedConversion, format)
+	if err == nil {
+		if served := serveDerived(w, r, dbHandler, derived); served {
+			logrus.Info("Conversion retrieved from cache")
+			return
+		}
+	} else if !dao.IsNotFound(err) {
+		logrus.WithError(err).Error("Error looking up cached conversion")
+	}
+
+	stream, err := openRevision(ctx, dbHandler, id, version)
+	if err != nil {
+		logrus.WithError(err).Error("Error downloading file")
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer closeStream(stream)
+
+	contentType := revision.ContentType
+	if contentType == "" {
+		contentType, err = detectContentType(stream)
+		if err != nil {
+			logrus.WithError(err).Error("Error reading file")
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if convert.IsFormat(contentType, revision.Name, format) {
+		w.Header().Set("Content-Type", contentType)
+		http.ServeContent(w, r, "", time.Time{}, stream)
+		logrus.Info("File already in requested format, served unconverted")
+		return
+	}
+
+	err = converters.Convert(ctx, contentType, format, stream, revision.Name, func(result *os.File) error {
+		derived = &models.Derived{
+			FileID:      id,
+			SourceHash:  revision.Hash,
+			Kind:        derivedConversion,
+			Variant:     format,
+			ContentType: convert.Formats[format],
+		}
+		if err := dbHandler.StoreDerived(ctx, derived, result); err != nil {
+			logrus.WithError(err).Error("Error caching conversion")
+		}
+		if _, err := result.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		w.Header().Set("Content-Type", derived.ContentType)
+		http.ServeContent(w, r, "", time.Time{}, result)
+		return nil
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Error converting file")
+		respondWithError(w, statusForError(err), err.Error())
+		return
+	}
+
+	logrus.Info("File converted successfully")
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"content-service-api/models"
+	"content-service-api/pkg/convert"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func newConvertRequest(t *testing.T, query string) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, "/convert/5df25cc42d811e3b6b945c08?"+query, nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	return mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+}
+
+func newTestConverters() *convert.Registry {
+	return convert.NewDefaultRegistry(convert.NewPool(convert.PoolConfig{}))
+}
+
+func TestApi_ConvertFile_ShouldConvertAndCacheFile(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Name: "README.md", ContentType: "text/plain; charset=utf-8", Hash: "abc"}, nil)
+	dbHandler.On("GetDerived", mock.Anything, mock.Anything, "abc", derivedConversion, convert.FormatHTML).Return(nil, mongo.ErrNoDocuments)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("# Hello"), nil)
+	dbHandler.On("StoreDerived", mock.Anything, mock.MatchedBy(func(derived *models.Derived) bool {
+		return derived.Kind == derivedConversion && derived.Variant == convert.FormatHTML && derived.ContentType == "text/html; charset=utf-8"
+	}), mock.Anything).Return(nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(convertFile(dbHandler, extHandler, newTestConverters()))
+	httpHandler.ServeHTTP(recorder, newConvertRequest(t, "to=html"))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+	require.Equal(t, `"convert-html-abc"`, recorder.Header().Get("ETag"))
+	require.Contains(t, recorder.Body.String(), "<h1>Hello</h1>")
+	dbHandler.AssertCalled(t, "StoreDerived", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_ConvertFile_ShouldServeFilesAlreadyInFormat(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Name: "test.png", ContentType: "image/png", Hash: "abc"}, nil)
+	dbHandler.On("GetDerived", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("png content"), nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(convertFile(dbHandler, extHandler, newTestConverters()))
+	httpHandler.ServeHTTP(recorder, newConvertRequest(t, "to=png"))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "image/png", recorder.Header().Get("Content-Type"))
+	require.Equal(t, "png content", recorder.Body.String())
+	dbHandler.AssertNotCalled(t, "StoreDerived", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_ConvertFile_ShouldReturn415WithoutConverter(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Name: "test.zip", ContentType: "application/zip", Hash: "abc"}, nil)
+	dbHandler.On("GetDerived", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("PK"), nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(convertFile(dbHandler, extHandler, newTestConverters()))
+	httpHandler.ServeHTTP(recorder, newConvertRequest(t, "to=pdf"))
+	require.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+	dbHandler.AssertNotCalled(t, "StoreDerived", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_ConvertFile_ShouldReturn400OnUnknownFormat(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(convertFile(dbHandler, extHandler, newTestConverters()))
+	httpHandler.ServeHTTP(recorder, newConvertRequest(t, "to=docx"))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	dbHandler.AssertNotCalled(t, "GetFileInfo", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,333 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/external"
+	"content-service-api/pkg/unpack"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// archiveExtensions are stripped from an archive's name to name the folder it is exploded into.
+var archiveExtensions = []string{".tar.gz", ".tgz", ".tar", ".zip"}
+
+// getArchiveEntries lists the files inside a stored zip, tar or tar.gz archive.
+func getArchiveEntries(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if _, err := authorizeFile(ctx, dbHandler, principal, id); err != nil {
+			logrus.WithError(err).Error("Error authorizing file access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		reader, stream, err := openArchive(ctx, dbHandler, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error opening archive")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+		defer closeStream(stream)
+
+		entries, err := reader.Entries()
+		if err != nil {
+			logrus.WithError(err).Error("Error listing archive entries")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		logrus.Info("Archive entries retrieved successfully")
+		respondWithSuccess(w, http.StatusOK, entries)
+		return
+	}
+}
+
+// getArchiveEntry streams a single file out of a stored archive.
+func getArchiveEntry(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if _, err := authorizeFile(ctx, dbHandler, principal, id); err != nil {
+			logrus.WithError(err).Error("Error authorizing file access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		reader, stream, err := openArchive(ctx, dbHandler, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error opening archive")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+		defer closeStream(stream)
+
+		// Entries are streamed straight out of the archive, so once the status is sent a failure can only
+		// be reported by cutting the response short.
+		sent := false
+		err = reader.Find(mux.Vars(r)["path"], func(entry models.ArchiveEntry, content io.Reader) error {
+			buffered := bufio.NewReaderSize(content, mimeSniffLength)
+			head, err := buffered.Peek(mimeSniffLength)
+			if err != nil && err != io.EOF {
+				return err
+			}
+
+			w.Header().Set("Content-Type", mimetype.Detect(head).String())
+			w.Header().Set("Content-Length", strconv.FormatInt(entry.Size, 10))
+			w.WriteHeader(http.StatusOK)
+			sent = true
+
+			_, err = io.Copy(w, buffered)
+			return err
+		})
+		if err != nil && sent {
+			logrus.WithError(err).Error("Error streaming archive entry")
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error extracting archive entry")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		logrus.Info("Archive entry retrieved successfully")
+	}
+}
+
+// explodeArchive imports every file of a stored archive as a file of its own. The files are placed in a
+// new folder next to the archive, named after it, with the archive's directories recreated as folders.
+func explodeArchive(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		file, err := authorizeFile(ctx, dbHandler, principal, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error authorizing file access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		if err := authorizeParent(ctx, dbHandler, principal, file.Parent); err != nil {
+			logrus.WithError(err).Error("Error authorizing parent folder access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		reader, stream, err := openArchive(ctx, dbHandler, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error opening archive")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+		defer closeStream(stream)
+
+		// Listing walks the whole archive against the limits, so nothing is imported from an archive
+		// that would break them part way through.
+		if _, err := reader.Entries(); err != nil {
+			logrus.WithError(err).Error("Error listing archive entries")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		folder, err := dbHandler.CreateFolder(ctx, &models.FolderRequest{
+			Name:      explodedFolderName(file),
+			Parent:    file.Parent,
+			Timestamp: time.Now(),
+			Owner:     principal.UserID,
+		})
+		if err != nil {
+			logrus.WithError(err).Error("Error creating folder for archive")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		response := models.ExplodeResponse{Folder: folder, Files: []models.UploadResult{}}
+		folders := map[string]primitive.ObjectID{".": folder.ID}
+		failed := false
+		err = reader.Walk(func(entry models.ArchiveEntry, content io.Reader) error {
+			result := models.UploadResult{Name: entry.Name}
+
+			created, err := importArchiveEntry(ctx, dbHandler, principal, folders, entry, content)
+			if err != nil {
+				logrus.WithError(err).WithField("name", entry.Name).Error("Error importing archive entry")
+				result.Status, result.Error = statusForError(err), err.Error()
+				failed = true
+			} else {
+				result.Status, result.ID = http.StatusCreated, &created.ID
+			}
+
+			response.Files = append(response.Files, result)
+			return nil
+		})
+		if err != nil {
+			logrus.WithError(err).Error("Error exploding archive")
+			respondWithSuccess(w, statusForError(err), response)
+			return
+		}
+
+		if failed {
+			logrus.Warn("Some entries of the archive could not be imported")
+			respondWithSuccess(w, http.StatusMultiStatus, response)
+			return
+		}
+
+		logrus.WithField("count", len(response.Files)).Info("Archive exploded successfully")
+		respondWithSuccess(w, http.StatusCreated, response)
+		return
+	}
+}
+
+// importArchiveEntry stores one entry of an archive, creating the folders on its path that do not exist
+// yet. folders maps the directories created so far to their IDs.
+func importArchiveEntry(ctx context.Context, dbHandler dao.DBHandler, principal *models.Principal, folders map[string]primitive.ObjectID, entry models.ArchiveEntry, content io.Reader) (*models.FileResponse, error) {
+	parent, err := archiveFolder(ctx, dbHandler, principal, folders, path.Dir(entry.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	name := path.Base(entry.Name)
+	return dbHandler.UploadFile(ctx, &models.FileRequest{
+		Name:      name,
+		Timestamp: time.Now(),
+		Extension: filepath.Ext(name),
+		Owner:     principal.UserID,
+		Parent:    &parent,
+	}, content)
+}
+
+// archiveFolder returns the folder for a directory of an archive, creating it and its parents as needed.
+func archiveFolder(ctx context.Context, dbHandler dao.DBHandler, principal *models.Principal, folders map[string]primitive.ObjectID, dir string) (primitive.ObjectID, error) {
+	if id, ok := folders[dir]; ok {
+		return id, nil
+	}
+
+	parent, err := archiveFolder(ctx, dbHandler, principal, folders, path.Dir(dir))
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	folder, err := dbHandler.CreateFolder(ctx, &models.FolderRequest{
+		Name:      path.Base(dir),
+		Parent:    &parent,
+		Timestamp: time.Now(),
+		Owner:     principal.UserID,
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	folders[dir] = folder.ID
+	return folder.ID, nil
+}
+
+// openArchive opens the current content of a file as an archive. The returned stream must be closed
+// once the reader is no longer used.
+func openArchive(ctx context.Context, dbHandler dao.DBHandler, id primitive.ObjectID) (*unpack.Reader, dao.FileStream, error) {
+	stream, err := dbHandler.OpenFile(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := unpack.Open(stream, unpack.DefaultLimits)
+	if err != nil {
+		closeStream(stream)
+		return nil, nil, err
+	}
+
+	return reader, stream, nil
+}
+
+func explodedFolderName(file *models.FileResponse) string {
+	lower := strings.ToLower(file.Name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) && len(file.Name) > len(ext) {
+			return file.Name[:len(file.Name)-len(ext)]
+		}
+	}
+	return file.Name + " (extracted)"
+}
+
+func closeStream(stream dao.FileStream) {
+	if err := stream.Close(); err != nil {
+		logrus.WithError(err).Error("Error closing download stream")
+	}
+}
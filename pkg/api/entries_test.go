@@ -0,0 +1,184 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newZipContent(t *testing.T, names ...string) string {
+	buf := &bytes.Buffer{}
+	writer := zip.NewWriter(buf)
+	for _, name := range names {
+		entry, err := writer.Create(name)
+		require.Nil(t, err)
+		_, err = entry.Write([]byte("content of " + name))
+		require.Nil(t, err)
+	}
+	require.Nil(t, writer.Close())
+	return buf.String()
+}
+
+func newEntriesRequest(t *testing.T, method string, url string, vars map[string]string) *http.Request {
+	req, err := http.NewRequest(method, url, nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	return mux.SetURLVars(req, vars)
+}
+
+func TestApi_GetArchiveEntries_ShouldListEntries(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Name: "bundle.zip"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream(newZipContent(t, "a.txt", "docs/b.txt")), nil)
+
+	req := newEntriesRequest(t, http.MethodGet, "/file/5df25cc42d811e3b6b945c08/entries", map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getArchiveEntries(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var entries []models.ArchiveEntry
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&entries))
+	require.Len(t, entries, 2)
+	require.Equal(t, "docs/b.txt", entries[1].Name)
+	require.Equal(t, int64(len("content of docs/b.txt")), entries[1].Size)
+}
+
+func TestApi_GetArchiveEntries_ShouldReturn415IfFileIsNotAnArchive(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Name: "notes.txt"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("just some notes"), nil)
+
+	req := newEntriesRequest(t, http.MethodGet, "/file/5df25cc42d811e3b6b945c08/entries", map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getArchiveEntries(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+}
+
+func TestApi_GetArchiveEntries_ShouldReturn422OnZipSlip(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Name: "bundle.zip"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream(newZipContent(t, "a.txt", "../../evil.sh")), nil)
+
+	req := newEntriesRequest(t, http.MethodGet, "/file/5df25cc42d811e3b6b945c08/entries", map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getArchiveEntries(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+}
+
+func TestApi_GetArchiveEntry_ShouldStreamEntry(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Name: "bundle.zip"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream(newZipContent(t, "a.txt", "docs/b.txt")), nil)
+
+	req := newEntriesRequest(t, http.MethodGet, "/file/5df25cc42d811e3b6b945c08/entries/docs/b.txt", map[string]string{"id": "5df25cc42d811e3b6b945c08", "path": "docs/b.txt"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getArchiveEntry(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "content of docs/b.txt", recorder.Body.String())
+	require.Equal(t, "text/plain; charset=utf-8", recorder.Header().Get("Content-Type"))
+}
+
+func TestApi_GetArchiveEntry_ShouldReturn404IfEntryNotFound(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Name: "bundle.zip"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream(newZipContent(t, "a.txt")), nil)
+
+	req := newEntriesRequest(t, http.MethodGet, "/file/5df25cc42d811e3b6b945c08/entries/../a.txt", map[string]string{"id": "5df25cc42d811e3b6b945c08", "path": "../a.txt"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getArchiveEntry(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_ExplodeArchive_ShouldImportEntriesIntoNewFolders(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	parent := primitive.NewObjectID()
+	root := &models.FolderResponse{ID: primitive.NewObjectID(), Name: "bundle"}
+	docs := &models.FolderResponse{ID: primitive.NewObjectID(), Name: "docs"}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Name: "bundle.zip", Parent: &parent}, nil)
+	dbHandler.On("GetFolder", mock.Anything, parent).Return(&models.FolderResponse{ID: parent, Owner: "test"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream(newZipContent(t, "a.txt", "docs/b.txt", "docs/c.txt")), nil)
+	dbHandler.On("CreateFolder", mock.Anything, mock.MatchedBy(func(folderRequest *models.FolderRequest) bool {
+		return folderRequest.Name == "bundle" && *folderRequest.Parent == parent && folderRequest.Owner == "test"
+	})).Return(root, nil).Once()
+	dbHandler.On("CreateFolder", mock.Anything, mock.MatchedBy(func(folderRequest *models.FolderRequest) bool {
+		return folderRequest.Name == "docs" && *folderRequest.Parent == root.ID && folderRequest.Owner == "test"
+	})).Return(docs, nil).Once()
+	dbHandler.On("UploadFile", mock.Anything, mock.MatchedBy(func(uploadRequest *models.FileRequest) bool {
+		return uploadRequest.Name == "a.txt" && *uploadRequest.Parent == root.ID && uploadRequest.Owner == "test"
+	}), mock.Anything).Return(&models.FileResponse{ID: primitive.NewObjectID()}, nil)
+	dbHandler.On("UploadFile", mock.Anything, mock.MatchedBy(func(uploadRequest *models.FileRequest) bool {
+		return uploadRequest.Name == "b.txt" && *uploadRequest.Parent == docs.ID
+	}), mock.Anything).Return(&models.FileResponse{ID: primitive.NewObjectID()}, nil)
+	dbHandler.On("UploadFile", mock.Anything, mock.MatchedBy(func(uploadRequest *models.FileRequest) bool {
+		return uploadRequest.Name == "c.txt" && *uploadRequest.Parent == docs.ID
+	}), mock.Anything).Return(nil, dao.ErrNameConflict)
+
+	req := newEntriesRequest(t, http.MethodPost, "/file/5df25cc42d811e3b6b945c08/explode", map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(explodeArchive(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusMultiStatus, recorder.Code)
+
+	var response models.ExplodeResponse
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.Equal(t, root.ID, response.Folder.ID)
+	require.Len(t, response.Files, 3)
+	require.Equal(t, http.StatusCreated, response.Files[0].Status)
+	require.Equal(t, "docs/b.txt", response.Files[1].Name)
+	require.Equal(t, http.StatusCreated, response.Files[1].Status)
+	require.Equal(t, http.StatusConflict, response.Files[2].Status)
+	dbHandler.AssertNumberOfCalls(t, "CreateFolder", 2)
+}
+
+func TestApi_ExplodeArchive_ShouldNotImportAnythingFromUnsafeArchives(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Name: "bundle.zip"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream(newZipContent(t, "a.txt", "../evil.sh")), nil)
+
+	req := newEntriesRequest(t, http.MethodPost, "/file/5df25cc42d811e3b6b945c08/explode", map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(explodeArchive(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	dbHandler.AssertNotCalled(t, "CreateFolder", mock.Anything, mock.Anything)
+	dbHandler.AssertNotCalled(t, "UploadFile", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,425 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"content-service-api/models"
+	"content-service-api/pkg/convert"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/external"
+	"content-service-api/pkg/thumbnail"
+	"content-service-api/pkg/unpack"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type parentRequest struct {
+	Parent *primitive.ObjectID `json:"parent"`
+}
+
+func createFolder(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		var folderRequest models.FolderRequest
+		if err := json.NewDecoder(r.Body).Decode(&folderRequest); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		folderRequest.Timestamp = time.Now()
+		folderRequest.Owner = principal.UserID
+
+		if err := authorizeParent(ctx, dbHandler, principal, folderRequest.Parent); err != nil {
+			logrus.WithError(err).Error("Error authorizing parent folder access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		folder, err := dbHandler.CreateFolder(ctx, &folderRequest)
+		if err != nil {
+			logrus.WithError(err).Error("Error creating folder")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		logrus.Info("Folder created successfully")
+		respondWithSuccess(w, http.StatusOK, folder)
+		return
+	}
+}
+
+func getFolderContents(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		// The root folder is listed through the same handler, without an ID in the path.
+		var folderID *primitive.ObjectID
+		if hex, ok := mux.Vars(r)["id"]; ok {
+			id, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				logrus.WithError(err).Error("Error converting ID to ObjectID")
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			folderID = &id
+		}
+
+		contents, err := dbHandler.GetFolderContents(ctx, folderID)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving folder contents")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		contents.Files = accessibleFiles(principal, contents.Files)
+
+		logrus.Info("Folder contents retrieved successfully")
+		respondWithSuccess(w, http.StatusOK, contents)
+		return
+	}
+}
+
+func updateFolder(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if _, err := authorizeFolder(ctx, dbHandler, principal, id); err != nil {
+			logrus.WithError(err).Error("Error authorizing folder access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		// Decoding into raw messages distinguishes an omitted parent from an explicit null, which moves
+		// the folder to the root.
+		var updateRequest map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&updateRequest); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if raw, ok := updateRequest["parent"]; ok {
+			var parent *primitive.ObjectID
+			if err := json.Unmarshal(raw, &parent); err != nil {
+				logrus.WithError(err).Error("Error decoding parent")
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			if err := authorizeParent(ctx, dbHandler, principal, parent); err != nil {
+				logrus.WithError(err).Error("Error authorizing parent folder access")
+				respondWithError(w, statusForError(err), err.Error())
+				return
+			}
+
+			if err := dbHandler.MoveFolder(ctx, id, parent); err != nil {
+				logrus.WithError(err).Error("Error moving folder")
+				respondWithError(w, statusForError(err), err.Error())
+				return
+			}
+		}
+
+		if raw, ok := updateRequest["name"]; ok {
+			var name string
+			if err := json.Unmarshal(raw, &name); err != nil {
+				logrus.WithError(err).Error("Error decoding name")
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			if err := dbHandler.RenameFolder(ctx, id, name); err != nil {
+				logrus.WithError(err).Error("Error renaming folder")
+				respondWithError(w, statusForError(err), err.Error())
+				return
+			}
+		}
+
+		logrus.Info("Folder updated successfully")
+		respondWithSuccess(w, http.StatusOK, "Folder updated successfully")
+		return
+	}
+}
+
+func deleteFolder(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if _, err := authorizeFolder(ctx, dbHandler, principal, id); err != nil {
+			logrus.WithError(err).Error("Error authorizing folder access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		// Deleting a folder recursively deletes every file in it, whoever owns them.
+		recursive := r.URL.Query().Get("recursive") == "true"
+		if recursive && !principal.IsAdmin() {
+			respondWithError(w, http.StatusForbidden, "only admins can delete folders recursively")
+			return
+		}
+
+		if err := dbHandler.DeleteFolder(ctx, id, recursive); err != nil {
+			logrus.WithError(err).Error("Error deleting folder")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		logrus.Info("Folder deleted successfully")
+		respondWithSuccess(w, http.StatusOK, "Folder deleted successfully")
+		return
+	}
+}
+
+func moveFile(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if _, err := authorizeFile(ctx, dbHandler, principal, id); err != nil {
+			logrus.WithError(err).Error("Error authorizing file access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		var moveRequest parentRequest
+		if err := json.NewDecoder(r.Body).Decode(&moveRequest); err != nil {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := authorizeParent(ctx, dbHandler, principal, moveRequest.Parent); err != nil {
+			logrus.WithError(err).Error("Error authorizing parent folder access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		if err := dbHandler.MoveFile(ctx, id, moveRequest.Parent); err != nil {
+			logrus.WithError(err).Error("Error moving file")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		logrus.Info("File moved successfully")
+		respondWithSuccess(w, http.StatusOK, "File moved successfully")
+		return
+	}
+}
+
+// getByPath serves GET /fs/{path}. A path naming a file streams it the same way /file/{id} does, and a
+// path naming a folder lists its children.
+func getByPath(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		path := splitPath(mux.Vars(r)["path"])
+
+		query := map[string]interface{}{}
+		if access := accessFilter(principal); access != nil {
+			query["$or"] = access
+		}
+
+		file, err := dbHandler.GetFileByPath(ctx, path, principal.UserID, query)
+		if err == nil {
+			file, err = authorizeFile(ctx, dbHandler, principal, file.ID)
+			if err != nil {
+				logrus.WithError(err).Error("Error authorizing file access")
+				respondWithError(w, statusForError(err), err.Error())
+				return
+			}
+
+			serveFile(w, r, dbHandler, file)
+			return
+		} else if !dao.IsNotFound(err) {
+			logrus.WithError(err).Error("Error resolving file path")
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		folder, err := dbHandler.GetFolderByPath(ctx, path, principal.UserID)
+		if err != nil {
+			logrus.WithError(err).Error("Error resolving folder path")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		var folderID *primitive.ObjectID
+		if folder != nil {
+			folderID = &folder.ID
+		}
+
+		contents, err := dbHandler.GetFolderContents(ctx, folderID)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving folder contents")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		contents.Files = accessibleFiles(principal, contents.Files)
+
+		logrus.Info("Folder contents retrieved successfully")
+		respondWithSuccess(w, http.StatusOK, contents)
+		return
+	}
+}
+
+func splitPath(path string) []string {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// statusForError maps errors returned by the dao package to the status they should be reported with.
+func statusForError(err error) int {
+	switch {
+	case dao.IsNotFound(err):
+		return http.StatusNotFound
+	case errors.Is(err, dao.ErrNameConflict), errors.Is(err, dao.ErrVersionConflict), errors.Is(err, dao.ErrFolderNotEmpty):
+		return http.StatusConflict
+	case errors.Is(err, dao.ErrUploadOffsetMismatch), errors.Is(err, dao.ErrUploadIncomplete), errors.Is(err, dao.ErrUploadCompleting):
+		return http.StatusConflict
+	case errors.Is(err, dao.ErrUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, dao.ErrInvalidName), errors.Is(err, dao.ErrFolderCycle), errors.Is(err, dao.ErrInvalidPageToken):
+		return http.StatusBadRequest
+	case errors.Is(err, errArchiveTooLarge):
+		return http.StatusBadRequest
+	case errors.Is(err, unpack.ErrEntryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, unpack.ErrUnsupportedFormat), errors.Is(err, thumbnail.ErrUnsupportedImage), errors.Is(err, convert.ErrNoConverter):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, unpack.ErrUnsafePath), errors.Is(err, unpack.ErrTooManyEntries), errors.Is(err, unpack.ErrTooLarge),
+		errors.Is(err, thumbnail.ErrImageTooLarge), errors.Is(err, convert.ErrTooLarge), errors.Is(err, convert.ErrUndecodable):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, errForbidden), errors.Is(err, errFolderForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, dao.ErrShareUnavailable):
+		return http.StatusGone
+	case errors.Is(err, convert.ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, thumbnail.ErrBusy):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
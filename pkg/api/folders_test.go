@@ -0,0 +1,339 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestApi_CreateFolder_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(nil, errors.New("test"))
+
+	req, err := http.NewRequest(http.MethodPost, "/folders", strings.NewReader(`{"name":"test"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestApi_CreateFolder_ShouldReturn400IfErrorOccursDecodingRequestBody(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/folders", strings.NewReader(""))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_CreateFolder_ShouldReturn409IfNameIsTaken(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("CreateFolder", mock.Anything, mock.Anything).Return(nil, dao.ErrNameConflict)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/folders", strings.NewReader(`{"name":"test"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestApi_CreateFolder_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFolder", mock.Anything, mock.Anything).Return(&models.FolderResponse{Owner: "test"}, nil)
+	extHandler := &mocks.ExtHandler{}
+	parent, err := primitive.ObjectIDFromHex("5df25cc42d811e3b6b945c08")
+	require.Nil(t, err)
+	dbHandler.On("CreateFolder", mock.Anything, mock.MatchedBy(func(f *models.FolderRequest) bool {
+		return f.Name == "reports" && f.Parent != nil && *f.Parent == parent && f.Owner == "test"
+	})).Return(&models.FolderResponse{Name: "reports"}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/folders", strings.NewReader(`{"name":"reports","parent":"5df25cc42d811e3b6b945c08"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_GetFolderContents_ShouldListRootWhenNoIDGiven(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFolderContents", mock.Anything, (*primitive.ObjectID)(nil)).Return(&models.FolderContents{}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/folders", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getFolderContents(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_GetFolderContents_ShouldReturn400IfUnableToCreateObjectIDFromGivenIDVar(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/folder/test/children", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "test"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getFolderContents(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_GetFolderContents_ShouldReturn404IfFolderNotFound(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFolderContents", mock.Anything, mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/folder/5df25cc42d811e3b6b945c08/children", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getFolderContents(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_UpdateFolder_ShouldMoveFolderToRootOnNullParent(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFolder", mock.Anything, mock.Anything).Return(&models.FolderResponse{Owner: "test"}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("MoveFolder", mock.Anything, mock.Anything, (*primitive.ObjectID)(nil)).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/folder/5df25cc42d811e3b6b945c08", strings.NewReader(`{"parent":null}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(updateFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	dbHandler.AssertNotCalled(t, "RenameFolder", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_UpdateFolder_ShouldReturn400OnCycle(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFolder", mock.Anything, mock.Anything).Return(&models.FolderResponse{Owner: "test"}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("MoveFolder", mock.Anything, mock.Anything, mock.Anything).Return(dao.ErrFolderCycle)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/folder/5df25cc42d811e3b6b945c08", strings.NewReader(`{"parent":"5df25cc42d811e3b6b945c09"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(updateFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_UpdateFolder_ShouldRenameFolder(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFolder", mock.Anything, mock.Anything).Return(&models.FolderResponse{Owner: "test"}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("RenameFolder", mock.Anything, mock.Anything, "renamed").Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/folder/5df25cc42d811e3b6b945c08", strings.NewReader(`{"name":"renamed"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(updateFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	dbHandler.AssertNotCalled(t, "MoveFolder", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_DeleteFolder_ShouldReturn409IfFolderIsNotEmpty(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFolder", mock.Anything, mock.Anything).Return(&models.FolderResponse{Owner: "test"}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("DeleteFolder", mock.Anything, mock.Anything, false).Return(dao.ErrFolderNotEmpty)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodDelete, "/folder/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(deleteFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestApi_DeleteFolder_ShouldDeleteRecursivelyWhenRequested(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFolder", mock.Anything, mock.Anything).Return(&models.FolderResponse{Owner: "test"}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("DeleteFolder", mock.Anything, mock.Anything, true).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test", Roles: []string{models.AdminRole}}, nil)
+
+	req, err := http.NewRequest(http.MethodDelete, "/folder/5df25cc42d811e3b6b945c08?recursive=true", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(deleteFolder(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_MoveFile_ShouldReturn409IfNameIsTakenInDestination(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFolder", mock.Anything, mock.Anything).Return(&models.FolderResponse{Owner: "test"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("MoveFile", mock.Anything, mock.Anything, mock.Anything).Return(dao.ErrNameConflict)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/file/5df25cc42d811e3b6b945c08/move", strings.NewReader(`{"parent":"5df25cc42d811e3b6b945c09"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(moveFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestApi_MoveFile_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFolder", mock.Anything, mock.Anything).Return(&models.FolderResponse{Owner: "test"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("MoveFile", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/file/5df25cc42d811e3b6b945c08/move", strings.NewReader(`{"parent":"5df25cc42d811e3b6b945c09"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(moveFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_GetByPath_ShouldServeFileAtPath(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileByPath", mock.Anything, []string{"reports", "2026", "q3.pdf"}, "test", mock.Anything).Return(&models.FileResponse{}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "test"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("test"), nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/fs/reports/2026/q3.pdf", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"path": "reports/2026/q3.pdf"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getByPath(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "test", recorder.Body.String())
+}
+
+func TestApi_GetByPath_ShouldListFolderAtPath(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileByPath", mock.Anything, []string{"reports"}, "test", mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	dbHandler.On("GetFolderByPath", mock.Anything, []string{"reports"}, "test").Return(&models.FolderResponse{Name: "reports"}, nil)
+	dbHandler.On("GetFolderContents", mock.Anything, mock.Anything).Return(&models.FolderContents{}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/fs/reports/", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"path": "reports/"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getByPath(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_GetByPath_ShouldReturn404IfNothingExistsAtPath(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileByPath", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	dbHandler.On("GetFolderByPath", mock.Anything, mock.Anything, mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/fs/missing", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"path": "missing"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getByPath(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_UpdateFileInfo_ShouldReturn400IfParentIsGiven(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/file/5df25cc42d811e3b6b945c08", strings.NewReader(`{"parent":"5df25cc42d811e3b6b945c09"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(updateFileInfo(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"content-service-api/pkg/filter"
+)
+
+const (
+	// metadataFieldPrefix prefixes metadata keys in upload form fields and GET /files query parameters.
+	metadataFieldPrefix = "meta."
+	maxTagLength        = 128
+)
+
+// parseFormLabels reads the tags and metadata of an upload from its multipart form values. Tags may be
+// given as repeated "tag" fields, comma separated "tags" fields or both; every "meta.<key>" field
+// becomes a metadata entry.
+func parseFormLabels(form map[string][]string) ([]string, map[string]string, error) {
+	var rawTags []string
+	rawTags = append(rawTags, form["tag"]...)
+	for _, value := range form["tags"] {
+		rawTags = append(rawTags, strings.Split(value, ",")...)
+	}
+
+	tags, err := normalizeTags(rawTags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata := make(map[string]string)
+	for field, values := range form {
+		if !strings.HasPrefix(field, metadataFieldPrefix) || len(values) == 0 {
+			continue
+		}
+
+		key := strings.TrimPrefix(field, metadataFieldPrefix)
+		if !filter.ValidMetadataKey(key) {
+			return nil, nil, fmt.Errorf("invalid metadata key '%v'", key)
+		}
+		metadata[key] = values[0]
+	}
+
+	return tags, metadata, nil
+}
+
+// normalizeTags trims tags and drops empty and duplicate entries, preserving order.
+func normalizeTags(rawTags []string) ([]string, error) {
+	tags := make([]string, 0, len(rawTags))
+	seen := make(map[string]bool)
+	for _, tag := range rawTags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		} else if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tags cannot be longer than %v characters", maxTagLength)
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// normalizeLabelUpdates validates the "tags", "metadata" and "metadata.<key>" entries of a decoded PUT
+// /file/{id} body, replacing them with their typed equivalents so they are stored the same way as at
+// upload time.
+func normalizeLabelUpdates(updateRequest map[string]interface{}) error {
+	if raw, ok := updateRequest["tags"]; ok {
+		list, ok := raw.([]interface{})
+		if !ok {
+			return errors.New("tags must be a list of strings")
+		}
+
+		rawTags := make([]string, 0, len(list))
+		for _, item := range list {
+			tag, ok := item.(string)
+			if !ok {
+				return errors.New("tags must be a list of strings")
+			}
+			rawTags = append(rawTags, tag)
+		}
+
+		tags, err := normalizeTags(rawTags)
+		if err != nil {
+			return err
+		}
+		updateRequest["tags"] = tags
+	}
+
+	if raw, ok := updateRequest["metadata"]; ok {
+		object, ok := raw.(map[string]interface{})
+		if !ok {
+			return errors.New("metadata must be an object of string values")
+		}
+
+		metadata := make(map[string]string, len(object))
+		for key, item := range object {
+			value, ok := item.(string)
+			if !ok {
+				return errors.New("metadata must be an object of string values")
+			} else if !filter.ValidMetadataKey(key) {
+				return fmt.Errorf("invalid metadata key '%v'", key)
+			}
+			metadata[key] = value
+		}
+		updateRequest["metadata"] = metadata
+	}
+
+	for field, item := range updateRequest {
+		if !strings.HasPrefix(field, "metadata.") {
+			continue
+		}
+
+		if _, ok := item.(string); !ok {
+			return errors.New("metadata values must be strings")
+		} else if key := strings.TrimPrefix(field, "metadata."); !filter.ValidMetadataKey(key) {
+			return fmt.Errorf("invalid metadata key '%v'", key)
+		}
+	}
+
+	return nil
+}
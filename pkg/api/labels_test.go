@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"content-service-api/models"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLabels_ParseFormLabels_ShouldCombineTagFields(t *testing.T) {
+	tags, metadata, err := parseFormLabels(map[string][]string{
+		"tag":  {"invoice", " paid "},
+		"tags": {"2026,invoice,,q3"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"invoice", "paid", "2026", "q3"}, tags)
+	require.Empty(t, metadata)
+}
+
+func TestLabels_ParseFormLabels_ShouldReadMetadataFields(t *testing.T) {
+	tags, metadata, err := parseFormLabels(map[string][]string{
+		"meta.customer": {"acme"},
+		"meta.region":   {"emea"},
+		"parent":        {"5df25cc42d811e3b6b945c08"},
+	})
+	require.Nil(t, err)
+	require.Empty(t, tags)
+	require.Equal(t, map[string]string{"customer": "acme", "region": "emea"}, metadata)
+}
+
+func TestLabels_ParseFormLabels_ShouldRejectInvalidMetadataKeys(t *testing.T) {
+	_, _, err := parseFormLabels(map[string][]string{"meta.$where": {"test"}})
+	require.NotNil(t, err)
+
+	_, _, err = parseFormLabels(map[string][]string{"meta.a.b": {"test"}})
+	require.NotNil(t, err)
+}
+
+func TestLabels_NormalizeLabelUpdates_ShouldConvertTagsAndMetadata(t *testing.T) {
+	updateRequest := map[string]interface{}{
+		"tags":     []interface{}{"invoice", "invoice", " paid"},
+		"metadata": map[string]interface{}{"customer": "acme"},
+	}
+	require.Nil(t, normalizeLabelUpdates(updateRequest))
+	require.Equal(t, []string{"invoice", "paid"}, updateRequest["tags"])
+	require.Equal(t, map[string]string{"customer": "acme"}, updateRequest["metadata"])
+}
+
+func TestLabels_NormalizeLabelUpdates_ShouldRejectMalformedValues(t *testing.T) {
+	require.NotNil(t, normalizeLabelUpdates(map[string]interface{}{"tags": "invoice"}))
+	require.NotNil(t, normalizeLabelUpdates(map[string]interface{}{"tags": []interface{}{1}}))
+	require.NotNil(t, normalizeLabelUpdates(map[string]interface{}{"metadata": map[string]interface{}{"customer": 1}}))
+	require.NotNil(t, normalizeLabelUpdates(map[string]interface{}{"metadata": map[string]interface{}{"$set": "x"}}))
+}
+
+func TestApi_UploadFile_ShouldPassTagsAndMetadataToDbHandler(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("UploadFile", mock.Anything, mock.MatchedBy(func(f *models.FileRequest) bool {
+		return len(f.Tags) == 2 && f.Tags[0] == "invoice" && f.Tags[1] == "paid" && f.Metadata["customer"] == "acme"
+	}), mock.Anything).Return(&models.FileResponse{ID: primitive.NewObjectID()}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	require.Nil(t, writer.WriteField("tags", "invoice,paid"))
+	require.Nil(t, writer.WriteField("meta.customer", "acme"))
+	part, err := writer.CreateFormFile("file", "test.png")
+	require.Nil(t, err)
+
+	_, err = io.Copy(part, bytes.NewBuffer([]byte("test")))
+	require.Nil(t, err)
+
+	require.Nil(t, writer.Close())
+
+	req, err := http.NewRequest(http.MethodPost, "/upload", body)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+}
+
+func TestApi_UpdateFileInfo_ShouldReturn400IfTagsAreMalformed(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/file/5df25cc42d811e3b6b945c08", strings.NewReader(`{"tags":"invoice"}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(updateFileInfo(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_GetFiles_ShouldFilterByTagsAndMetadata(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFiles", mock.Anything, map[string]interface{}{
+		"tags":              map[string]interface{}{"$all": []interface{}{"invoice", "paid"}},
+		"metadata.customer": map[string]interface{}{"$eq": "acme"},
+	}, mock.Anything).Return(&models.FilePage{Files: []models.FileResponse{}}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test", Roles: []string{models.AdminRole}}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/files?tag=invoice&tag=paid&meta.customer=acme", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getFiles(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"encoding/json"
+
+	"content-service-api/models"
+)
+
+// projectedPage is a page of files reduced to the fields a client asked for.
+type projectedPage struct {
+	Files []map[string]interface{} `json:"files"`
+	Total int64                    `json:"total"`
+	Next  string                   `json:"next,omitempty"`
+}
+
+// projectPage drops every field not listed in fields from the files on a page. Fields are matched
+// against the files' JSON representation, so the names are the same ones clients see.
+func projectPage(page *models.FilePage, fields []string) (*projectedPage, error) {
+	projected := &projectedPage{Files: make([]map[string]interface{}, 0, len(page.Files)), Total: page.Total, Next: page.Next}
+
+	for _, file := range page.Files {
+		encoded, err := json.Marshal(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var full map[string]interface{}
+		if err := json.Unmarshal(encoded, &full); err != nil {
+			return nil, err
+		}
+
+		reduced := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			reduced[field] = full[field]
+		}
+		projected.Files = append(projected.Files, reduced)
+	}
+
+	return projected, nil
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApi_GetFiles_ShouldPassListOptionsToDbHandler(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFiles", mock.Anything, map[string]interface{}{
+		"extension": map[string]interface{}{"$eq": ".pdf"},
+	}, &models.ListOptions{
+		Limit: 10,
+		Sort:  []models.SortField{{Field: "timestamp", Descending: true}, {Field: "name"}},
+		Next:  "token",
+	}).Return(&models.FilePage{Files: []models.FileResponse{{Name: "test"}}, Total: 11, Next: "next"}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test", Roles: []string{models.AdminRole}}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/files?extension=.pdf&limit=10&sort=-timestamp,name&next=token", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getFiles(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var page models.FilePage
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&page))
+	require.Equal(t, int64(11), page.Total)
+	require.Equal(t, "next", page.Next)
+	require.Len(t, page.Files, 1)
+}
+
+func TestApi_GetFiles_ShouldReturnOnlyRequestedFields(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	id := primitive.NewObjectID()
+	dbHandler.On("GetFiles", mock.Anything, mock.Anything, mock.Anything).Return(&models.FilePage{
+		Files: []models.FileResponse{{ID: id, Name: "test.txt", Size: 4, Hash: "test"}},
+		Total: 1,
+	}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/files?fields=id,name", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getFiles(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var page map[string]interface{}
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&page))
+	require.Equal(t, []interface{}{map[string]interface{}{"id": id.Hex(), "name": "test.txt"}}, page["files"])
+	require.Equal(t, float64(1), page["total"])
+	require.NotContains(t, page, "next")
+}
+
+func TestApi_GetFiles_ShouldReturn400OnInvalidListOptions(t *testing.T) {
+	for _, query := range []string{"limit=0", "limit=test", "sort=hash", "sort=name,-name", "fields=versions", "limit=1&limit=2"} {
+		dbHandler := &mocks.DBHandler{}
+		extHandler := &mocks.ExtHandler{}
+		extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+		req, err := http.NewRequest(http.MethodGet, "/files?"+query, nil)
+		require.Nil(t, err)
+		req.Header.Add("Authorization", "Bearer test")
+
+		recorder := httptest.NewRecorder()
+		httpHandler := http.HandlerFunc(getFiles(dbHandler, extHandler))
+		httpHandler.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusBadRequest, recorder.Code, query)
+	}
+}
+
+func TestApi_GetFiles_ShouldReturn400OnInvalidPageToken(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFiles", mock.Anything, mock.Anything, mock.Anything).Return(nil, dao.ErrInvalidPageToken)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/files?next=test", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getFiles(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
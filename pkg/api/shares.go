@@ -0,0 +1,339 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/external"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultShareLifetime = 24 * time.Hour
+	maxShareLifetime     = 30 * 24 * time.Hour
+)
+
+// shareSigner signs share links with an HMAC over the share's ID and expiry, so that neither can be
+// changed and links can be rejected without touching the database.
+type shareSigner struct {
+	key     []byte
+	baseURL string
+}
+
+// newShareSigner creates a signer for the given key. Without a key a random one is used, which is only
+// good for development: links stop working on restart and are not accepted by other replicas.
+func newShareSigner(key string, baseURL string) (*shareSigner, error) {
+	signer := &shareSigner{key: []byte(key), baseURL: strings.TrimSuffix(baseURL, "/")}
+	if key == "" {
+		logrus.Warn("No share signing key configured, share links will not survive a restart")
+		signer.key = make([]byte, 32)
+		if _, err := rand.Read(signer.key); err != nil {
+			return nil, err
+		}
+	}
+	return signer, nil
+}
+
+func (s *shareSigner) sign(shareID primitive.ObjectID, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%v:%v", shareID.Hex(), expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *shareSigner) verify(shareID primitive.ObjectID, expires int64, signature string) bool {
+	return hmac.Equal([]byte(s.sign(shareID, expires)), []byte(signature))
+}
+
+// url builds the public link for a share. Links are absolute, based on the configured public URL or
+// failing that the host the request was made to.
+func (s *shareSigner) url(r *http.Request, share *models.Share) string {
+	base := s.baseURL
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = fmt.Sprintf("%v://%v", scheme, r.Host)
+	}
+
+	expires := share.Expires.Unix()
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expires, 10)},
+		"signature": {s.sign(share.ID, expires)},
+	}
+
+	return fmt.Sprintf("%v/shared/%v?%v", base, share.ID.Hex(), query.Encode())
+}
+
+func createShare(dbHandler dao.DBHandler, extHandler external.ExtHandler, signer *shareSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		file, err := dbHandler.GetFileInfo(ctx, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving file info")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		if !canManage(principal, file) {
+			respondWithError(w, http.StatusForbidden, "only the file's owner can share it")
+			return
+		}
+
+		// The body is optional; without one the share gets the default lifetime and no download limit.
+		var shareRequest models.ShareRequest
+		if err := json.NewDecoder(r.Body).Decode(&shareRequest); err != nil && err != io.EOF {
+			logrus.WithError(err).Error("Error decoding request body")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		lifetime := time.Duration(shareRequest.ExpiresIn) * time.Second
+		if shareRequest.ExpiresIn == 0 {
+			lifetime = defaultShareLifetime
+		} else if shareRequest.ExpiresIn < 0 || lifetime > maxShareLifetime {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("expiresIn must be between 1 and %v seconds", int64(maxShareLifetime.Seconds())))
+			return
+		}
+
+		if shareRequest.MaxDownloads < 0 {
+			respondWithError(w, http.StatusBadRequest, "maxDownloads cannot be negative")
+			return
+		}
+
+		// Links carry the expiry in whole seconds, so that is all that is stored.
+		now := time.Now()
+		share := models.Share{
+			FileID:       id,
+			CreatedBy:    principal.UserID,
+			Created:      now,
+			Expires:      now.Add(lifetime).Truncate(time.Second),
+			MaxDownloads: shareRequest.MaxDownloads,
+		}
+
+		if err := dbHandler.CreateShare(ctx, &share); err != nil {
+			logrus.WithError(err).Error("Error creating share")
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		share.URL = signer.url(r, &share)
+
+		logrus.Info("Share created successfully")
+		respondWithSuccess(w, http.StatusOK, share)
+		return
+	}
+}
+
+func getShares(dbHandler dao.DBHandler, extHandler external.ExtHandler, signer *shareSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		file, err := dbHandler.GetFileInfo(ctx, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving file info")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		if !canManage(principal, file) {
+			respondWithError(w, http.StatusForbidden, "only the file's owner can list its shares")
+			return
+		}
+
+		shares, err := dbHandler.GetShares(ctx, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving shares")
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		for i := range shares {
+			shares[i].URL = signer.url(r, &shares[i])
+		}
+
+		logrus.Info("Shares retrieved successfully")
+		respondWithSuccess(w, http.StatusOK, shares)
+		return
+	}
+}
+
+func revokeShare(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		shareID, err := primitive.ObjectIDFromHex(mux.Vars(r)["shareId"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting share ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		file, err := dbHandler.GetFileInfo(ctx, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving file info")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		if !canManage(principal, file) {
+			respondWithError(w, http.StatusForbidden, "only the file's owner can revoke its shares")
+			return
+		}
+
+		if err := dbHandler.DeleteShare(ctx, id, shareID); err != nil {
+			logrus.WithError(err).Error("Error revoking share")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		logrus.Info("Share revoked successfully")
+		respondWithSuccess(w, http.StatusOK, "Share revoked successfully")
+		return
+	}
+}
+
+// downloadSharedFile serves GET /shared/{id}, the only route that needs no authorization token. The link's
+// signature is checked first, then the share is used up by one download as the file is written. Only
+// full downloads count: 304s are free, and so are range requests once the file has been downloaded, so
+// that interrupted downloads can be resumed. Range requests are still only served while the share is
+// active, so they cannot be used to keep downloading a share that has run out.
+func downloadSharedFile(dbHandler dao.DBHandler, signer *shareSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		shareID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+		if err != nil || !signer.verify(shareID, expires, r.URL.Query().Get("signature")) {
+			respondWithError(w, http.StatusForbidden, "invalid share link")
+			return
+		}
+
+		if time.Now().Unix() >= expires {
+			respondWithError(w, http.StatusGone, dao.ErrShareUnavailable.Error())
+			return
+		}
+
+		share, err := dbHandler.GetShare(ctx, shareID)
+		if dao.IsNotFound(err) {
+			respondWithError(w, http.StatusNotFound, "share not found")
+			return
+		} else if err != nil {
+			logrus.WithError(err).Error("Error retrieving share")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		if !share.Expires.After(time.Now()) {
+			respondWithError(w, http.StatusGone, dao.ErrShareUnavailable.Error())
+			return
+		}
+
+		file, err := dbHandler.GetFileInfo(ctx, share.FileID)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving file info")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		serveRevision(w, r, dbHandler, file, 0, func(partial bool) error {
+			if partial && share.Downloads > 0 {
+				if !share.Active(time.Now()) {
+					return dao.ErrShareUnavailable
+				}
+				return nil
+			}
+			_, err := dbHandler.ClaimShareDownload(ctx, shareID)
+			return err
+		})
+		return
+	}
+}
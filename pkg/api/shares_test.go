@@ -0,0 +1,310 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func newTestShareSigner(t *testing.T) *shareSigner {
+	signer, err := newShareSigner("test", "https://files.example.com/")
+	require.Nil(t, err)
+	return signer
+}
+
+func sharedFileRequest(t *testing.T, signer *shareSigner, shareID primitive.ObjectID, expires time.Time) *http.Request {
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expires.Unix(), 10)},
+		"signature": {signer.sign(shareID, expires.Unix())},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/shared/"+shareID.Hex()+"?"+query.Encode(), nil)
+	require.Nil(t, err)
+	return mux.SetURLVars(req, map[string]string{"id": shareID.Hex()})
+}
+
+func TestApi_CreateShare_ShouldReturn403IfNotOwner(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Owner: "owner"}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "other"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/file/5df25cc42d811e3b6b945c08/share", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createShare(dbHandler, extHandler, newTestShareSigner(t)))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestApi_CreateShare_ShouldReturn400OnInvalidExpiry(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Owner: "owner"}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "owner"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/file/5df25cc42d811e3b6b945c08/share", strings.NewReader(`{"expiresIn": 31536000}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createShare(dbHandler, extHandler, newTestShareSigner(t)))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_CreateShare_ShouldReturnSignedURL(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	shareID := primitive.NewObjectID()
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Owner: "owner"}, nil)
+	dbHandler.On("CreateShare", mock.Anything, mock.MatchedBy(func(share *models.Share) bool {
+		return share.MaxDownloads == 3 && share.CreatedBy == "owner" && time.Until(share.Expires) <= time.Hour
+	})).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*models.Share).ID = shareID
+	})
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "owner"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/file/5df25cc42d811e3b6b945c08/share", strings.NewReader(`{"expiresIn": 3600, "maxDownloads": 3}`))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	signer := newTestShareSigner(t)
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createShare(dbHandler, extHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var share models.Share
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&share))
+
+	link, err := url.Parse(share.URL)
+	require.Nil(t, err)
+	require.Equal(t, "files.example.com", link.Host)
+	require.Equal(t, "/shared/"+shareID.Hex(), link.Path)
+
+	expires, err := strconv.ParseInt(link.Query().Get("expires"), 10, 64)
+	require.Nil(t, err)
+	require.Equal(t, share.Expires.Unix(), expires)
+	require.True(t, signer.verify(shareID, expires, link.Query().Get("signature")))
+}
+
+func TestApi_DownloadSharedFile_ShouldServeFileForValidLink(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	shareID := primitive.NewObjectID()
+	fileID := primitive.NewObjectID()
+	dbHandler.On("GetShare", mock.Anything, shareID).Return(&models.Share{ID: shareID, FileID: fileID, Expires: time.Now().Add(time.Hour)}, nil)
+	dbHandler.On("ClaimShareDownload", mock.Anything, shareID).Return(&models.Share{ID: shareID, FileID: fileID}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, fileID).Return(&models.FileResponse{ID: fileID, Name: "test.txt", Hash: "test"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, fileID).Return(newFileStream("test"), nil)
+
+	signer := newTestShareSigner(t)
+	req := sharedFileRequest(t, signer, shareID, time.Now().Add(time.Hour))
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadSharedFile(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	body, err := ioutil.ReadAll(recorder.Body)
+	require.Nil(t, err)
+	require.Equal(t, "test", string(body))
+	dbHandler.AssertCalled(t, "ClaimShareDownload", mock.Anything, shareID)
+}
+
+func TestApi_DownloadSharedFile_ShouldNotCountResumedDownloads(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	shareID := primitive.NewObjectID()
+	fileID := primitive.NewObjectID()
+	dbHandler.On("GetShare", mock.Anything, shareID).Return(&models.Share{ID: shareID, FileID: fileID, Expires: time.Now().Add(time.Hour), MaxDownloads: 2, Downloads: 1}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, fileID).Return(&models.FileResponse{ID: fileID, Name: "test.txt", Hash: "test"}, nil)
+	dbHandler.On("OpenFile", mock.Anything, fileID).Return(newFileStream("test content"), nil)
+
+	signer := newTestShareSigner(t)
+	req := sharedFileRequest(t, signer, shareID, time.Now().Add(time.Hour))
+	req.Header.Set("Range", "bytes=5-")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadSharedFile(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusPartialContent, recorder.Code)
+	require.Equal(t, "content", recorder.Body.String())
+	dbHandler.AssertNotCalled(t, "ClaimShareDownload", mock.Anything, mock.Anything)
+}
+
+func TestApi_DownloadSharedFile_ShouldReturn410ForRangeRequestsOnUsedUpShares(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	shareID := primitive.NewObjectID()
+	fileID := primitive.NewObjectID()
+	dbHandler.On("GetShare", mock.Anything, shareID).Return(&models.Share{ID: shareID, FileID: fileID, Expires: time.Now().Add(time.Hour), MaxDownloads: 1, Downloads: 1}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, fileID).Return(&models.FileResponse{ID: fileID, Name: "test.txt", Hash: "test"}, nil)
+
+	signer := newTestShareSigner(t)
+	req := sharedFileRequest(t, signer, shareID, time.Now().Add(time.Hour))
+	req.Header.Set("Range", "bytes=0-")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadSharedFile(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusGone, recorder.Code)
+	dbHandler.AssertNotCalled(t, "OpenFile", mock.Anything, mock.Anything)
+	dbHandler.AssertNotCalled(t, "ClaimShareDownload", mock.Anything, mock.Anything)
+}
+
+func TestApi_DownloadSharedFile_ShouldCountFirstDownloadEvenIfPartial(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	shareID := primitive.NewObjectID()
+	fileID := primitive.NewObjectID()
+	dbHandler.On("GetShare", mock.Anything, shareID).Return(&models.Share{ID: shareID, FileID: fileID, Expires: time.Now().Add(time.Hour), MaxDownloads: 1}, nil)
+	dbHandler.On("ClaimShareDownload", mock.Anything, shareID).Return(nil, dao.ErrShareUnavailable)
+	dbHandler.On("GetFileInfo", mock.Anything, fileID).Return(&models.FileResponse{ID: fileID, Name: "test.txt", Hash: "test"}, nil)
+
+	signer := newTestShareSigner(t)
+	req := sharedFileRequest(t, signer, shareID, time.Now().Add(time.Hour))
+	req.Header.Set("Range", "bytes=0-")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadSharedFile(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusGone, recorder.Code)
+	dbHandler.AssertNotCalled(t, "OpenFile", mock.Anything, mock.Anything)
+}
+
+func TestApi_DownloadSharedFile_ShouldNotCountNotModifiedResponses(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	shareID := primitive.NewObjectID()
+	fileID := primitive.NewObjectID()
+	dbHandler.On("GetShare", mock.Anything, shareID).Return(&models.Share{ID: shareID, FileID: fileID, Expires: time.Now().Add(time.Hour), MaxDownloads: 1}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, fileID).Return(&models.FileResponse{ID: fileID, Name: "test.txt", Hash: "test"}, nil)
+
+	signer := newTestShareSigner(t)
+	req := sharedFileRequest(t, signer, shareID, time.Now().Add(time.Hour))
+	req.Header.Set("If-None-Match", `"test"`)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadSharedFile(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotModified, recorder.Code)
+	dbHandler.AssertNotCalled(t, "ClaimShareDownload", mock.Anything, mock.Anything)
+}
+
+func TestApi_DownloadSharedFile_ShouldReturn403IfSignatureIsInvalid(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	shareID := primitive.NewObjectID()
+
+	req := sharedFileRequest(t, newTestShareSigner(t), shareID, time.Now().Add(time.Hour))
+	q := req.URL.Query()
+	q.Set("expires", strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10))
+	req.URL.RawQuery = q.Encode()
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadSharedFile(dbHandler, newTestShareSigner(t)))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	dbHandler.AssertNotCalled(t, "ClaimShareDownload", mock.Anything, mock.Anything)
+}
+
+func TestApi_DownloadSharedFile_ShouldReturn410IfLinkHasExpired(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	signer := newTestShareSigner(t)
+	req := sharedFileRequest(t, signer, primitive.NewObjectID(), time.Now().Add(-time.Minute))
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadSharedFile(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusGone, recorder.Code)
+}
+
+func TestApi_DownloadSharedFile_ShouldReturn410IfDownloadsAreUsedUp(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	shareID := primitive.NewObjectID()
+	fileID := primitive.NewObjectID()
+	dbHandler.On("ClaimShareDownload", mock.Anything, shareID).Return(nil, dao.ErrShareUnavailable)
+	dbHandler.On("GetShare", mock.Anything, shareID).Return(&models.Share{ID: shareID, FileID: fileID, Expires: time.Now().Add(time.Hour), MaxDownloads: 1, Downloads: 1}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, fileID).Return(&models.FileResponse{ID: fileID, Name: "test.txt", Hash: "test"}, nil)
+
+	signer := newTestShareSigner(t)
+	req := sharedFileRequest(t, signer, shareID, time.Now().Add(time.Hour))
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadSharedFile(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusGone, recorder.Code)
+}
+
+func TestApi_DownloadSharedFile_ShouldReturn404IfShareWasRevoked(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	shareID := primitive.NewObjectID()
+	dbHandler.On("GetShare", mock.Anything, shareID).Return(nil, mongo.ErrNoDocuments)
+
+	signer := newTestShareSigner(t)
+	req := sharedFileRequest(t, signer, shareID, time.Now().Add(time.Hour))
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadSharedFile(dbHandler, signer))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_GetShares_ShouldIncludeLinks(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	shareID := primitive.NewObjectID()
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Owner: "owner"}, nil)
+	dbHandler.On("GetShares", mock.Anything, mock.Anything).Return([]models.Share{{ID: shareID, Expires: time.Now().Add(time.Hour)}}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "owner"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08/shares", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getShares(dbHandler, extHandler, newTestShareSigner(t)))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var shares []models.Share
+	require.Nil(t, json.NewDecoder(recorder.Body).Decode(&shares))
+	require.Len(t, shares, 1)
+	require.True(t, strings.HasPrefix(shares[0].URL, "https://files.example.com/shared/"+shareID.Hex()+"?"))
+}
+
+func TestApi_RevokeShare_ShouldReturn404IfShareNotFound(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Owner: "owner"}, nil)
+	dbHandler.On("DeleteShare", mock.Anything, mock.Anything, mock.Anything).Return(mongo.ErrNoDocuments)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "owner"}, nil)
+
+	req, err := http.NewRequest(http.MethodDelete, "/file/5df25cc42d811e3b6b945c08/shares/5df25cc42d811e3b6b945c09", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08", "shareId": "5df25cc42d811e3b6b945c09"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(revokeShare(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/external"
+	"content-service-api/pkg/thumbnail"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// derivedThumbnail is the kind thumbnails are stored under as derived content.
+const derivedThumbnail = "thumbnail"
+
+// getThumbnail serves a scaled down copy of an image. Thumbnails are generated on first request and
+// stored as derived content of the file's current revision, from where later requests are served.
+func getThumbnail(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		file, err := authorizeFile(ctx, dbHandler, principal, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error authorizing file access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		options, err := thumbnail.ParseOptions(r.URL.Query())
+		if err != nil {
+			logrus.WithError(err).Error("Error parsing thumbnail options")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		etag := strongETag(file.Hash, derivedThumbnail+"-"+options.Variant())
+		setValidators(w, etag, file.Timestamp)
+		if notModified(r, etag, file.Timestamp) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		derived, err := dbHandler.GetDerived(ctx, id, file.Hash, derivedThumbnail, options.Variant())
+		if err == nil {
+			if served := serveDerived(w, r, dbHandler, derived); served {
+				logrus.Info("Thumbnail retrieved from cache")
+				return
+			}
+		} else if !dao.IsNotFound(err) {
+			logrus.WithError(err).Error("Error looking up cached thumbnail")
+		}
+
+		content, contentType, err := generateThumbnail(ctx, dbHandler, file, options)
+		if err != nil {
+			logrus.WithError(err).Error("Error generating thumbnail")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		derived = &models.Derived{
+			FileID:      id,
+			SourceHash:  file.Hash,
+			Kind:        derivedThumbnail,
+			Variant:     options.Variant(),
+			ContentType: contentType,
+		}
+		if err := dbHandler.StoreDerived(ctx, derived, bytes.NewReader(content)); err != nil {
+			logrus.WithError(err).Error("Error caching thumbnail")
+		}
+
+		// Last-Modified was already set by setValidators, so ServeContent is not given a time.
+		w.Header().Set("Content-Type", contentType)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+
+		logrus.Info("Thumbnail generated successfully")
+	}
+}
+
+func generateThumbnail(ctx context.Context, dbHandler dao.DBHandler, file *models.FileResponse, options thumbnail.Options) ([]byte, string, error) {
+	stream, err := dbHandler.OpenFile(ctx, file.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	defer closeStream(stream)
+
+	return thumbnail.Generate(stream, options)
+}
+
+// serveDerived writes stored derived content, reporting false without writing anything if its blob
+// cannot be opened so that the caller can generate the content again.
+func serveDerived(w http.ResponseWriter, r *http.Request, dbHandler dao.DBHandler, derived *models.Derived) bool {
+	stream, err := dbHandler.OpenDerived(r.Context(), derived)
+	if err != nil {
+		logrus.WithError(err).Error("Error opening derived content")
+		return false
+	}
+	defer closeStream(stream)
+
+	w.Header().Set("Content-Type", derived.ContentType)
+	http.ServeContent(w, r, "", time.Time{}, stream)
+	return true
+}
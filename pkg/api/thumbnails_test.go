@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"content-service-api/models"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func newThumbnailRequest(t *testing.T, query string) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, "/thumbnail/5df25cc42d811e3b6b945c08?"+query, nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	return mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+}
+
+func TestApi_GetThumbnail_ShouldGenerateAndCacheThumbnail(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 100, 50))))
+
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "hash"}, nil)
+	dbHandler.On("GetDerived", mock.Anything, mock.Anything, "hash", derivedThumbnail, "20x20-cover").Return(nil, mongo.ErrNoDocuments)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream(buf.String()), nil)
+
+	var stored []byte
+	dbHandler.On("StoreDerived", mock.Anything, mock.MatchedBy(func(derived *models.Derived) bool {
+		return derived.SourceHash == "hash" && derived.Variant == "20x20-cover" && derived.ContentType == "image/png"
+	}), mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		content, err := ioutil.ReadAll(args.Get(2).(io.Reader))
+		require.Nil(t, err)
+		stored = content
+	})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getThumbnail(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, newThumbnailRequest(t, "w=20&h=20&fit=cover"))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "image/png", recorder.Header().Get("Content-Type"))
+	require.Equal(t, stored, recorder.Body.Bytes())
+
+	img, err := png.Decode(recorder.Body)
+	require.Nil(t, err)
+	require.Equal(t, 20, img.Bounds().Dx())
+	require.Equal(t, 20, img.Bounds().Dy())
+}
+
+func TestApi_GetThumbnail_ShouldServeCachedThumbnail(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	derived := &models.Derived{Kind: derivedThumbnail, Variant: "256x256-contain", ContentType: "image/jpeg"}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "hash"}, nil)
+	dbHandler.On("GetDerived", mock.Anything, mock.Anything, "hash", derivedThumbnail, "256x256-contain").Return(derived, nil)
+	dbHandler.On("OpenDerived", mock.Anything, derived).Return(newFileStream("cached"), nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getThumbnail(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, newThumbnailRequest(t, ""))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "image/jpeg", recorder.Header().Get("Content-Type"))
+	require.Equal(t, "cached", recorder.Body.String())
+	dbHandler.AssertNotCalled(t, "OpenFile", mock.Anything, mock.Anything)
+}
+
+func TestApi_GetThumbnail_ShouldReturn415ForNonImages(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "hash"}, nil)
+	dbHandler.On("GetDerived", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	dbHandler.On("OpenFile", mock.Anything, mock.Anything).Return(newFileStream("%PDF-1.4"), nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getThumbnail(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, newThumbnailRequest(t, ""))
+	require.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+	dbHandler.AssertNotCalled(t, "StoreDerived", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_GetThumbnail_ShouldReturn400OnInvalidOptions(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{Hash: "hash"}, nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getThumbnail(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, newThumbnailRequest(t, "w=-1"))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,395 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/external"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+	tusChunkType  = "application/offset+octet-stream"
+
+	maxResumableUploadSize = 10 << 30
+	uploadCleanupInterval  = 10 * time.Minute
+)
+
+// tusOptions answers tus discovery requests with the protocol versions and extensions supported.
+func tusOptions(w http.ResponseWriter, r *http.Request) {
+	defer closeRequestBody(r)
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxResumableUploadSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createUpload starts a resumable upload as described by the tus creation extension. The file's name,
+// parent folder, tags and metadata are taken from the Upload-Metadata header using the same keys as
+// the form fields of POST /upload, with "filename" for the name.
+func createUpload(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if !checkTusVersion(w, r) {
+			return
+		}
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil || length < 0 {
+			respondWithError(w, http.StatusBadRequest, "Upload-Length must be a non-negative integer")
+			return
+		} else if length > maxResumableUploadSize {
+			respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("uploads cannot be larger than %v bytes", maxResumableUploadSize))
+			return
+		}
+
+		metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+		if err != nil {
+			logrus.WithError(err).Error("Error parsing upload metadata")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		name := firstValue(metadata["filename"])
+		if name == "" {
+			name = firstValue(metadata["name"])
+		}
+
+		upload := models.Upload{
+			Length: length,
+			File: models.FileRequest{
+				Name:      name,
+				Extension: filepath.Ext(name),
+				Owner:     principal.UserID,
+			},
+		}
+
+		upload.File.Tags, upload.File.Metadata, err = parseFormLabels(metadata)
+		if err != nil {
+			logrus.WithError(err).Error("Error parsing tags and metadata")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if parent := firstValue(metadata["parent"]); parent != "" {
+			parentID, err := primitive.ObjectIDFromHex(parent)
+			if err != nil {
+				logrus.WithError(err).Error("Error converting parent to ObjectID")
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			upload.File.Parent = &parentID
+		}
+
+		if err := authorizeParent(ctx, dbHandler, principal, upload.File.Parent); err != nil {
+			logrus.WithError(err).Error("Error authorizing parent folder access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		if err := dbHandler.CreateUpload(ctx, &upload); err != nil {
+			logrus.WithError(err).Error("Error creating upload")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		// An empty file has nothing left to upload, so it is created straight away. Location still
+		// points at the upload, where HEAD reports the file that was created.
+		if length == 0 {
+			if _, err := dbHandler.CompleteUpload(ctx, upload.ID); err != nil {
+				logrus.WithError(err).Error("Error completing upload")
+				respondWithError(w, statusForError(err), err.Error())
+				return
+			}
+		}
+
+		logrus.Info("Upload created successfully")
+		w.Header().Set("Location", fmt.Sprintf("/uploads/%v", upload.ID.Hex()))
+		w.Header().Set("Upload-Expires", upload.Expires.UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+}
+
+// getUploadOffset reports how many bytes of an upload have been received. Once the upload has completed,
+// Location points at the file it created.
+func getUploadOffset(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if !checkTusVersion(w, r) {
+			return
+		}
+
+		upload, ok := authorizeUpload(ctx, w, r, dbHandler, extHandler)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+		setUploadedFileLocation(w, upload)
+		w.Header().Set("Upload-Expires", upload.Expires.UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+}
+
+// appendUpload stores the request body as the next chunk of an upload, and creates the file once the
+// last chunk has been received, pointing Location at it. Sending an empty chunk at the end of an upload
+// retries creating the file if that failed before.
+func appendUpload(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if !checkTusVersion(w, r) {
+			return
+		}
+
+		if r.Header.Get("Content-Type") != tusChunkType {
+			respondWithError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("Content-Type must be %v", tusChunkType))
+			return
+		}
+
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			respondWithError(w, http.StatusBadRequest, "Upload-Offset must be a non-negative integer")
+			return
+		}
+
+		upload, ok := authorizeUpload(ctx, w, r, dbHandler, extHandler)
+		if !ok {
+			return
+		}
+
+		if upload.Offset != offset {
+			respondWithError(w, http.StatusConflict, dao.ErrUploadOffsetMismatch.Error())
+			return
+		}
+
+		// Chunks are stored under a context of their own rather than the request's, so that what was
+		// received before a client disconnected is kept. It has no deadline either: a chunk takes as long
+		// as the client needs to send it, and a store giving up part way would discard all of it.
+		if r.ContentLength != 0 && !upload.Completed {
+			body := &tolerantReader{source: r.Body}
+			upload, err = dbHandler.AppendUpload(context.Background(), upload.ID, offset, body)
+			if err != nil {
+				logrus.WithError(err).Error("Error appending to upload")
+				respondWithError(w, statusForError(err), err.Error())
+				return
+			} else if body.err != nil {
+				logrus.WithError(body.err).Warn("Upload chunk was cut short")
+			}
+		}
+
+		if upload.Offset == upload.Length && !upload.Completed {
+			if upload, err = dbHandler.CompleteUpload(ctx, upload.ID); err != nil {
+				logrus.WithError(err).Error("Error completing upload")
+				respondWithError(w, statusForError(err), err.Error())
+				return
+			}
+			logrus.Info("Upload completed successfully")
+		}
+
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		w.Header().Set("Upload-Expires", upload.Expires.UTC().Format(http.TimeFormat))
+		setUploadedFileLocation(w, upload)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+}
+
+// terminateUpload cancels an upload as described by the tus termination extension.
+func terminateUpload(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		if !checkTusVersion(w, r) {
+			return
+		}
+
+		upload, ok := authorizeUpload(ctx, w, r, dbHandler, extHandler)
+		if !ok {
+			return
+		}
+
+		if err := dbHandler.DeleteUpload(ctx, upload.ID); err != nil {
+			logrus.WithError(err).Error("Error deleting upload")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		logrus.Info("Upload terminated successfully")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+}
+
+// authorizeUpload authenticates the request and loads the upload it refers to, which only the user who
+// started it and admins can access. It writes the error response itself and reports whether to go on.
+func authorizeUpload(ctx context.Context, w http.ResponseWriter, r *http.Request, dbHandler dao.DBHandler, extHandler external.ExtHandler) (*models.Upload, bool) {
+	token, err := getAuthToken(r)
+	if err != nil {
+		logrus.WithError(err).Error("Error retrieving authorization token from request")
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	principal, err := validateToken(r, extHandler, token)
+	if err != nil {
+		logrus.WithError(err).Error("Error validating token")
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return nil, false
+	}
+
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		logrus.WithError(err).Error("Error converting ID to ObjectID")
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	upload, err := dbHandler.GetUpload(ctx, id)
+	if err != nil {
+		logrus.WithError(err).Error("Error retrieving upload")
+		respondWithError(w, statusForError(err), err.Error())
+		return nil, false
+	}
+
+	if !principal.IsAdmin() && upload.File.Owner != principal.UserID {
+		respondWithError(w, http.StatusForbidden, "you do not have access to this upload")
+		return nil, false
+	}
+
+	return upload, true
+}
+
+// setUploadedFileLocation points Location at the file a completed upload created.
+func setUploadedFileLocation(w http.ResponseWriter, upload *models.Upload) {
+	if upload.Completed && upload.FileID != nil {
+		w.Header().Set("Location", "/file/"+upload.FileID.Hex())
+	}
+}
+
+// checkTusVersion sets the Tus-Resumable header every tus response carries and rejects requests for a
+// protocol version other than the one supported.
+func checkTusVersion(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		respondWithError(w, http.StatusPreconditionFailed, fmt.Sprintf("Tus-Resumable must be %v", tusVersion))
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header: comma separated pairs of a key and a base64
+// encoded value, where the value may be left out.
+func parseUploadMetadata(header string) (map[string][]string, error) {
+	metadata := make(map[string][]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid Upload-Metadata pair '%v'", strings.TrimSpace(pair))
+		}
+
+		value := ""
+		if len(fields) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid Upload-Metadata value for '%v': %v", fields[0], err)
+			}
+			value = string(decoded)
+		}
+
+		if _, ok := metadata[fields[0]]; ok {
+			return nil, fmt.Errorf("Upload-Metadata key '%v' given more than once", fields[0])
+		}
+		metadata[fields[0]] = []string{value}
+	}
+
+	return metadata, nil
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// tolerantReader ends at the first error reading from source instead of failing, so that the part of a
+// chunk received before a client disconnected can still be stored. The error is kept for logging.
+type tolerantReader struct {
+	source io.Reader
+	err    error
+}
+
+func (t *tolerantReader) Read(p []byte) (int, error) {
+	n, err := t.source.Read(p)
+	if err != nil && err != io.EOF {
+		t.err = err
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// cleanUpUploads periodically deletes uploads that have expired, until ctx is cancelled.
+func cleanUpUploads(ctx context.Context, dbHandler dao.DBHandler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := dbHandler.DeleteExpiredUploads(ctx)
+			if err != nil {
+				logrus.WithError(err).Error("Error deleting expired uploads")
+			} else if deleted > 0 {
+				logrus.WithField("count", deleted).Info("Deleted expired uploads")
+			}
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTusRequest(t *testing.T, method string, url string, body string) *http.Request {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("Tus-Resumable", tusVersion)
+	return req
+}
+
+func testUpload(offset int64, length int64) *models.Upload {
+	return &models.Upload{
+		ID:      primitive.NewObjectID(),
+		Length:  length,
+		Offset:  offset,
+		File:    models.FileRequest{Name: "test.txt", Owner: "test"},
+		Expires: time.Now().Add(time.Hour),
+	}
+}
+
+func TestApi_CreateUpload_ShouldReturn412IfTusVersionIsUnsupported(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+
+	req := newTusRequest(t, http.MethodPost, "/uploads", "")
+	req.Header.Set("Tus-Resumable", "0.2.2")
+	req.Header.Set("Upload-Length", "10")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createUpload(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+	require.Equal(t, tusVersion, recorder.Header().Get("Tus-Version"))
+}
+
+func TestApi_CreateUpload_ShouldReturn400IfLengthIsMissing(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req := newTusRequest(t, http.MethodPost, "/uploads", "")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createUpload(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_CreateUpload_ShouldCreateUploadFromMetadata(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	uploadID := primitive.NewObjectID()
+	parentID := primitive.NewObjectID()
+	dbHandler.On("GetFolder", mock.Anything, parentID).Return(&models.FolderResponse{ID: parentID, Owner: "test"}, nil)
+	dbHandler.On("CreateUpload", mock.Anything, mock.MatchedBy(func(upload *models.Upload) bool {
+		return upload.Length == 10 &&
+			upload.File.Name == "report.pdf" &&
+			upload.File.Extension == ".pdf" &&
+			upload.File.Owner == "test" &&
+			*upload.File.Parent == parentID &&
+			strings.Join(upload.File.Tags, ",") == "a,b" &&
+			upload.File.Metadata["project"] == "test"
+	})).Return(nil).Run(func(args mock.Arguments) {
+		upload := args.Get(1).(*models.Upload)
+		upload.ID = uploadID
+		upload.Expires = time.Now().Add(dao.UploadLifetime)
+	})
+
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	req := newTusRequest(t, http.MethodPost, "/uploads", "")
+	req.Header.Set("Upload-Length", "10")
+	req.Header.Set("Upload-Metadata", strings.Join([]string{
+		"filename " + encode("report.pdf"),
+		"parent " + encode(parentID.Hex()),
+		"tags " + encode("a,b"),
+		"meta.project " + encode("test"),
+	}, ","))
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(createUpload(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	require.Equal(t, "/uploads/"+uploadID.Hex(), recorder.Header().Get("Location"))
+	require.Equal(t, tusVersion, recorder.Header().Get("Tus-Resumable"))
+	require.NotEmpty(t, recorder.Header().Get("Upload-Expires"))
+	dbHandler.AssertNotCalled(t, "CompleteUpload", mock.Anything, mock.Anything)
+}
+
+func TestApi_GetUploadOffset_ShouldReturnOffset(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	upload := testUpload(4, 10)
+	dbHandler.On("GetUpload", mock.Anything, upload.ID).Return(upload, nil)
+
+	req := newTusRequest(t, http.MethodHead, "/uploads/"+upload.ID.Hex(), "")
+	req = mux.SetURLVars(req, map[string]string{"id": upload.ID.Hex()})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getUploadOffset(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "4", recorder.Header().Get("Upload-Offset"))
+	require.Equal(t, "10", recorder.Header().Get("Upload-Length"))
+	require.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+	require.Empty(t, recorder.Header().Get("Location"))
+}
+
+func TestApi_GetUploadOffset_ShouldReturnLocationOfCompletedFile(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	upload := testUpload(10, 10)
+	upload.Completed = true
+	fileID := primitive.NewObjectID()
+	upload.FileID = &fileID
+	dbHandler.On("GetUpload", mock.Anything, upload.ID).Return(upload, nil)
+
+	req := newTusRequest(t, http.MethodHead, "/uploads/"+upload.ID.Hex(), "")
+	req = mux.SetURLVars(req, map[string]string{"id": upload.ID.Hex()})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getUploadOffset(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "/file/"+fileID.Hex(), recorder.Header().Get("Location"))
+}
+
+func TestApi_GetUploadOffset_ShouldReturn403ForOtherUsers(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "other"}, nil)
+
+	upload := testUpload(4, 10)
+	dbHandler.On("GetUpload", mock.Anything, upload.ID).Return(upload, nil)
+
+	req := newTusRequest(t, http.MethodHead, "/uploads/"+upload.ID.Hex(), "")
+	req = mux.SetURLVars(req, map[string]string{"id": upload.ID.Hex()})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getUploadOffset(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestApi_AppendUpload_ShouldReturn415OnWrongContentType(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+
+	req := newTusRequest(t, http.MethodPatch, "/uploads/5df25cc42d811e3b6b945c08", "test")
+	req.Header.Set("Upload-Offset", "0")
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(appendUpload(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+}
+
+func TestApi_AppendUpload_ShouldReturn409OnOffsetMismatch(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	upload := testUpload(4, 10)
+	dbHandler.On("GetUpload", mock.Anything, upload.ID).Return(upload, nil)
+
+	req := newTusRequest(t, http.MethodPatch, "/uploads/"+upload.ID.Hex(), "test")
+	req.Header.Set("Upload-Offset", "0")
+	req.Header.Set("Content-Type", tusChunkType)
+	req = mux.SetURLVars(req, map[string]string{"id": upload.ID.Hex()})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(appendUpload(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	dbHandler.AssertNotCalled(t, "AppendUpload", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestApi_AppendUpload_ShouldAppendChunk(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	upload := testUpload(4, 10)
+	dbHandler.On("GetUpload", mock.Anything, upload.ID).Return(upload, nil)
+	// Storing a chunk is not bounded by a deadline, which could discard a chunk still being received.
+	noDeadline := mock.MatchedBy(func(ctx context.Context) bool {
+		_, ok := ctx.Deadline()
+		return !ok
+	})
+	dbHandler.On("AppendUpload", noDeadline, upload.ID, int64(4), mock.MatchedBy(func(source *tolerantReader) bool {
+		content, err := ioutil.ReadAll(source)
+		return err == nil && string(content) == "test"
+	})).Return(testUpload(8, 10), nil)
+
+	req := newTusRequest(t, http.MethodPatch, "/uploads/"+upload.ID.Hex(), "test")
+	req.Header.Set("Upload-Offset", "4")
+	req.Header.Set("Content-Type", tusChunkType)
+	req = mux.SetURLVars(req, map[string]string{"id": upload.ID.Hex()})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(appendUpload(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	require.Equal(t, "8", recorder.Header().Get("Upload-Offset"))
+	dbHandler.AssertNotCalled(t, "CompleteUpload", mock.Anything, mock.Anything)
+}
+
+func TestApi_AppendUpload_ShouldCompleteUploadAfterLastChunk(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	upload := testUpload(6, 10)
+	complete := testUpload(10, 10)
+	complete.ID = upload.ID
+	dbHandler.On("GetUpload", mock.Anything, upload.ID).Return(upload, nil)
+	dbHandler.On("AppendUpload", mock.Anything, upload.ID, int64(6), mock.Anything).Return(complete, nil)
+	completed := testUpload(10, 10)
+	completed.ID = upload.ID
+	completed.Completed = true
+	fileID := primitive.NewObjectID()
+	completed.FileID = &fileID
+	dbHandler.On("CompleteUpload", mock.Anything, upload.ID).Return(completed, nil)
+
+	req := newTusRequest(t, http.MethodPatch, "/uploads/"+upload.ID.Hex(), "test")
+	req.Header.Set("Upload-Offset", "6")
+	req.Header.Set("Content-Type", tusChunkType)
+	req = mux.SetURLVars(req, map[string]string{"id": upload.ID.Hex()})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(appendUpload(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	require.Equal(t, "10", recorder.Header().Get("Upload-Offset"))
+	require.Equal(t, "/file/"+fileID.Hex(), recorder.Header().Get("Location"))
+	dbHandler.AssertCalled(t, "CompleteUpload", mock.Anything, upload.ID)
+}
+
+func TestApi_TerminateUpload_ShouldDeleteUpload(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	upload := testUpload(4, 10)
+	dbHandler.On("GetUpload", mock.Anything, upload.ID).Return(upload, nil)
+	dbHandler.On("DeleteUpload", mock.Anything, upload.ID).Return(nil)
+
+	req := newTusRequest(t, http.MethodDelete, "/uploads/"+upload.ID.Hex(), "")
+	req = mux.SetURLVars(req, map[string]string{"id": upload.ID.Hex()})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(terminateUpload(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+}
+
+func TestApi_ParseUploadMetadata_ShouldRejectInvalidPairs(t *testing.T) {
+	metadata, err := parseUploadMetadata("filename dGVzdA==,flag")
+	require.Nil(t, err)
+	require.Equal(t, map[string][]string{"filename": {"test"}, "flag": {""}}, metadata)
+
+	for _, header := range []string{"filename !!!", "filename dGVzdA== extra", "a dGVzdA==,a dGVzdA==", "a dGVzdA==,"} {
+		_, err := parseUploadMetadata(header)
+		require.NotNil(t, err, header)
+	}
+}
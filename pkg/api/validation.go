@@ -0,0 +1,140 @@
+package api
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"content-service-api/pkg/external"
+)
+
+// newExtHandler creates the token validator selected by TOKEN_VALIDATION: "remote" (the default) asks
+// the login service, "jwt" verifies JWTs locally against JWKS_URL, "introspection" asks an OAuth2
+// introspection endpoint, and a comma separated list such as "jwt,remote" tries each in order until
+// one accepts the token.
+func newExtHandler() (external.ExtHandler, error) {
+	modes := strings.Split(os.Getenv("TOKEN_VALIDATION"), ",")
+	if len(modes) == 1 && strings.TrimSpace(modes[0]) == "" {
+		modes = []string{"remote"}
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	var chain external.ChainHandler
+	for _, mode := range modes {
+		var handler external.ExtHandler
+		var err error
+		switch mode = strings.TrimSpace(mode); mode {
+		case "remote":
+			handler, err = newRemoteValidator(client)
+		case "jwt":
+			handler, err = newJWTValidator(client)
+		case "introspection":
+			handler, err = newIntrospectionValidator(client)
+		default:
+			err = fmt.Errorf("unknown token validation mode '%v'", mode)
+		}
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, handler)
+	}
+
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+	return chain, nil
+}
+
+// newRemoteValidator creates the login service client, wrapped in a validation cache.
+func newRemoteValidator(client *http.Client) (external.ExtHandler, error) {
+	return newCachedValidator("tokenCache", &external.Handler{
+		HttpClient:      client,
+		LoginServiceURL: os.Getenv("LOGIN_SERVICE_URL"),
+	})
+}
+
+// newIntrospectionValidator creates an OAuth2 introspection client configured by the INTROSPECTION_*
+// variables, wrapped in a validation cache. INTROSPECTION_SCOPES is a space separated list of scopes
+// every token must have been granted.
+func newIntrospectionValidator(client *http.Client) (external.ExtHandler, error) {
+	handler, err := external.NewIntrospectionHandler(client, external.IntrospectionConfig{
+		URL:            os.Getenv("INTROSPECTION_URL"),
+		ClientID:       os.Getenv("INTROSPECTION_CLIENT_ID"),
+		ClientSecret:   os.Getenv("INTROSPECTION_CLIENT_SECRET"),
+		RequiredScopes: strings.Fields(os.Getenv("INTROSPECTION_SCOPES")),
+		Audience:       os.Getenv("INTROSPECTION_AUDIENCE"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newCachedValidator("introspectionCache", handler)
+}
+
+// newCachedValidator wraps handler in a validation cache configured by the TOKEN_CACHE_* variables,
+// and publishes the cache's counters under name.
+func newCachedValidator(name string, handler external.ExtHandler) (external.ExtHandler, error) {
+	ttl, err := durationFromEnv("TOKEN_CACHE_TTL")
+	if err != nil {
+		return nil, err
+	}
+
+	negativeTTL, err := durationFromEnv("TOKEN_CACHE_NEGATIVE_TTL")
+	if err != nil {
+		return nil, err
+	}
+
+	size := 0
+	if value := os.Getenv("TOKEN_CACHE_SIZE"); value != "" {
+		if size, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("invalid TOKEN_CACHE_SIZE: %v", err)
+		}
+	}
+
+	cache := external.NewCachingHandler(handler, external.CacheConfig{TTL: ttl, NegativeTTL: negativeTTL, MaxEntries: size})
+	expvar.Publish(name, expvar.Func(func() interface{} { return cache.Stats() }))
+
+	return cache, nil
+}
+
+// newJWTValidator creates a local JWT validator configured by JWKS_URL and the JWT_* variables.
+func newJWTValidator(client *http.Client) (external.ExtHandler, error) {
+	refresh, err := durationFromEnv("JWKS_REFRESH_INTERVAL")
+	if err != nil {
+		return nil, err
+	}
+
+	leeway := external.DefaultJWTLeeway
+	if os.Getenv("JWT_LEEWAY") != "" {
+		if leeway, err = durationFromEnv("JWT_LEEWAY"); err != nil {
+			return nil, err
+		}
+	}
+
+	return external.NewJWTHandler(client, external.JWTConfig{
+		JWKSURL:         os.Getenv("JWKS_URL"),
+		Issuer:          os.Getenv("JWT_ISSUER"),
+		Audience:        os.Getenv("JWT_AUDIENCE"),
+		RefreshInterval: refresh,
+		Leeway:          leeway,
+	})
+}
+
+// durationFromEnv parses a Go duration such as "5m" from the named variable, returning zero if unset.
+func durationFromEnv(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v: %v", name, err)
+	}
+	return d, nil
+}
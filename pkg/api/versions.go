@@ -0,0 +1,233 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/external"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func uploadFileVersion(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if _, err := authorizeFile(ctx, dbHandler, principal, id); err != nil {
+			logrus.WithError(err).Error("Error authorizing file access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+			logrus.WithError(err).Error("Error parsing multipart form")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		defer func() {
+			if err := r.MultipartForm.RemoveAll(); err != nil {
+				logrus.WithError(err).Error("Error removing temporary multipart files")
+			}
+		}()
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			logrus.WithError(err).Error("Error getting file from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		defer func() {
+			if err := file.Close(); err != nil {
+				logrus.WithError(err).Error("Error closing file")
+			}
+		}()
+
+		versionRequest := models.FileVersion{
+			Name:      header.Filename,
+			Timestamp: time.Now(),
+			Extension: filepath.Ext(header.Filename),
+			Size:      header.Size,
+		}
+
+		if err := dbHandler.UploadFileVersion(ctx, id, &versionRequest, file); err != nil {
+			logrus.WithError(err).Error("Error uploading file version")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		logrus.Info("File version uploaded successfully")
+		respondWithSuccess(w, http.StatusOK, versionRequest)
+		return
+	}
+}
+
+func getFileVersions(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if _, err := authorizeFile(ctx, dbHandler, principal, id); err != nil {
+			logrus.WithError(err).Error("Error authorizing file access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		versions, err := dbHandler.GetFileVersions(ctx, id)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving file versions")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		logrus.Info("File versions retrieved successfully")
+		respondWithSuccess(w, http.StatusOK, versions)
+		return
+	}
+}
+
+func restoreFileVersion(dbHandler dao.DBHandler, extHandler external.ExtHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		defer closeRequestBody(r)
+
+		token, err := getAuthToken(r)
+		if err != nil {
+			logrus.WithError(err).Error("Error retrieving authorization token from request")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		principal, err := validateToken(r, extHandler, token)
+		if err != nil {
+			logrus.WithError(err).Error("Error validating token")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			logrus.WithError(err).Error("Error converting ID to ObjectID")
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if _, err := authorizeFile(ctx, dbHandler, principal, id); err != nil {
+			logrus.WithError(err).Error("Error authorizing file access")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		version, err := strconv.Atoi(mux.Vars(r)["version"])
+		if err != nil || version < 1 {
+			logrus.WithError(err).Error("Error parsing version")
+			respondWithError(w, http.StatusBadRequest, "version must be a positive integer")
+			return
+		}
+
+		restored, err := dbHandler.RestoreFileVersion(ctx, id, version)
+		if err != nil {
+			logrus.WithError(err).Error("Error restoring file version")
+			respondWithError(w, statusForError(err), err.Error())
+			return
+		}
+
+		logrus.Info("File version restored successfully")
+		respondWithSuccess(w, http.StatusOK, restored)
+		return
+	}
+}
+
+// requestedVersion returns the revision selected by the "version" query parameter, or 0 for the
+// current revision when the parameter is absent.
+func requestedVersion(r *http.Request) (int, error) {
+	param := r.URL.Query().Get("version")
+	if param == "" {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(param)
+	if err != nil || version < 1 {
+		return 0, errors.New("version must be a positive integer")
+	}
+
+	return version, nil
+}
+
+// getRevision returns the given revision of a file, or its current revision when version is 0.
+func getRevision(ctx context.Context, dbHandler dao.DBHandler, file *models.FileResponse, version int) (*models.FileVersion, error) {
+	if version != 0 {
+		return dbHandler.GetFileVersion(ctx, file.ID, version)
+	}
+
+	return &models.FileVersion{
+		Version:     file.Version,
+		Name:        file.Name,
+		Timestamp:   file.Timestamp,
+		Extension:   file.Extension,
+		Size:        file.Size,
+		ContentType: file.ContentType,
+		FileID:      file.FileID,
+		Hash:        file.Hash,
+	}, nil
+}
+
+// openRevision opens the content of the given revision of a file, or its current revision when version is 0.
+func openRevision(ctx context.Context, dbHandler dao.DBHandler, id primitive.ObjectID, version int) (dao.FileStream, error) {
+	if version != 0 {
+		return dbHandler.OpenFileVersion(ctx, id, version)
+	}
+	return dbHandler.OpenFile(ctx, id)
+}
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"content-service-api/models"
+	"content-service-api/pkg/dao"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func newVersionUploadRequest(t *testing.T) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "test.png")
+	require.Nil(t, err)
+
+	_, err = io.Copy(part, bytes.NewBuffer([]byte("test")))
+	require.Nil(t, err)
+
+	require.Nil(t, writer.Close())
+
+	req, err := http.NewRequest(http.MethodPost, "/file/5df25cc42d811e3b6b945c08", body)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+	return mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+}
+
+func TestApi_UploadFileVersion_ShouldReturn401IfErrorOccursValidatingToken(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(nil, errors.New("test"))
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadFileVersion(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, newVersionUploadRequest(t))
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestApi_UploadFileVersion_ShouldReturn400IfNoFormFieldWithKeyFileFound(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/file/5df25cc42d811e3b6b945c08", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadFileVersion(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_UploadFileVersion_ShouldReturn404IfFileNotFound(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("UploadFileVersion", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(mongo.ErrNoDocuments)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadFileVersion(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, newVersionUploadRequest(t))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_UploadFileVersion_ShouldReturn409OnConcurrentModification(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("UploadFileVersion", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(dao.ErrVersionConflict)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadFileVersion(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, newVersionUploadRequest(t))
+	require.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestApi_UploadFileVersion_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("UploadFileVersion", mock.Anything, mock.Anything, mock.MatchedBy(func(v *models.FileVersion) bool {
+		return v.Name == "test.png" && v.Extension == ".png"
+	}), mock.Anything).Return(nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(uploadFileVersion(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, newVersionUploadRequest(t))
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestApi_GetFileVersions_ShouldReturn404IfFileNotFound(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileVersions", mock.Anything, mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08/versions", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getFileVersions(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_GetFileVersions_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileVersions", mock.Anything, mock.Anything).Return([]models.FileVersion{{Version: 1}, {Version: 2}}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08/versions", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(getFileVersions(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"version":2`)
+}
+
+func TestApi_RestoreFileVersion_ShouldReturn400IfVersionIsInvalid(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/file/5df25cc42d811e3b6b945c08/versions/test/restore", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08", "version": "test"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(restoreFileVersion(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_RestoreFileVersion_ShouldReturn404IfVersionNotFound(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("RestoreFileVersion", mock.Anything, mock.Anything, 3).Return(nil, dao.ErrVersionNotFound)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/file/5df25cc42d811e3b6b945c08/versions/3/restore", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08", "version": "3"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(restoreFileVersion(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_RestoreFileVersion_ShouldReturn200OnSuccess(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("RestoreFileVersion", mock.Anything, mock.Anything, 1).Return(&models.FileVersion{Version: 3}, nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/file/5df25cc42d811e3b6b945c08/versions/1/restore", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08", "version": "1"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(restoreFileVersion(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"version":3`)
+}
+
+func TestApi_DownloadFile_ShouldReturn400IfVersionIsInvalid(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08?version=0", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestApi_DownloadFile_ShouldReturn404IfVersionNotFound(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileVersion", mock.Anything, mock.Anything, 2).Return(nil, dao.ErrVersionNotFound)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08?version=2", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApi_DownloadFile_ShouldServeRequestedVersion(t *testing.T) {
+	dbHandler := &mocks.DBHandler{}
+	dbHandler.On("GetFileInfo", mock.Anything, mock.Anything).Return(&models.FileResponse{}, nil)
+	extHandler := &mocks.ExtHandler{}
+	dbHandler.On("GetFileVersion", mock.Anything, mock.Anything, 2).Return(&models.FileVersion{Version: 2, Hash: "v2"}, nil)
+	dbHandler.On("OpenFileVersion", mock.Anything, mock.Anything, 2).Return(newFileStream("second"), nil)
+	extHandler.On("ValidateToken", mock.Anything).Return(&models.Principal{UserID: "test"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/file/5df25cc42d811e3b6b945c08?version=2", nil)
+	require.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer test")
+	req = mux.SetURLVars(req, map[string]string{"id": "5df25cc42d811e3b6b945c08"})
+
+	recorder := httptest.NewRecorder()
+	httpHandler := http.HandlerFunc(downloadFile(dbHandler, extHandler))
+	httpHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "second", recorder.Body.String())
+	require.Equal(t, `"v2"`, recorder.Header().Get("ETag"))
+}
@@ -0,0 +1,98 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+var errNoOutput = errors.New("converter produced no output")
+
+// LibreOffice converts office documents to PDF with soffice, or libreoffice where soffice is not on
+// the path. Each run is given its own user profile inside dir, since instances sharing a profile block
+// on its lock and fail to start while another conversion is running.
+type LibreOffice struct{}
+
+func (LibreOffice) Convert(ctx context.Context, dir string, input string) (string, error) {
+	binary, err := lookPath("soffice", "libreoffice")
+	if err != nil {
+		return "", err
+	}
+
+	profile := "file://" + filepath.ToSlash(filepath.Join(dir, ".profile"))
+	output := filepath.Join(dir, strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))+".pdf")
+	return output, run(ctx, output, binary, "-env:UserInstallation="+profile, "--headless", "--invisible",
+		"--convert-to", "pdf", "--outdir", dir, input)
+}
+
+// Wkhtmltopdf renders HTML documents to PDF with the wkhtmltopdf command. Documents are user content,
+// so scripts are not run, pages cannot pull in files from the local file system and every network
+// request goes to a proxy that does not exist, so that a document cannot make the service fetch URLs
+// on its behalf. Resources that fail to load are left out rather than failing the conversion.
+type Wkhtmltopdf struct{}
+
+// unreachableProxy is the discard port on the loopback interface, where nothing listens.
+const unreachableProxy = "http://127.0.0.1:9"
+
+func (Wkhtmltopdf) Convert(ctx context.Context, dir string, input string) (string, error) {
+	binary, err := lookPath("wkhtmltopdf")
+	if err != nil {
+		return "", err
+	}
+
+	output := filepath.Join(dir, "result.pdf")
+	return output, run(ctx, output, binary, "--quiet", "--disable-javascript", "--disable-local-file-access",
+		"--proxy", unreachableProxy, "--disable-external-links", "--load-error-handling", "ignore",
+		"--load-media-error-handling", "ignore", input, output)
+}
+
+// run runs a converter command and checks that it wrote output, returning the command's output with
+// any error since that is where converters explain what went wrong. The command runs in a process group
+// of its own, and when ctx ends the whole group is killed: converters such as soffice hand the work to
+// child processes, which would otherwise keep running and hold the output pipe open.
+func run(ctx context.Context, output string, name string, args ...string) error {
+	var out bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%v: %v", err, strings.TrimSpace(out.String()))
+		}
+	case <-ctx.Done():
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return err
+		}
+		<-done
+		return ctx.Err()
+	}
+
+	if _, err := os.Stat(output); err != nil {
+		return errNoOutput
+	}
+	return nil
+}
+
+func lookPath(names ...string) (string, error) {
+	for _, name := range names {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%v could not be found", strings.Join(names, " or "))
+}
@@ -0,0 +1,65 @@
+package convert
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert_Run_ShouldReturnCommandOutputOnFailure(t *testing.T) {
+	err := run(context.Background(), "", "/bin/sh", "-c", "echo 'cannot convert' >&2; exit 3")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "cannot convert")
+}
+
+func TestConvert_Run_ShouldKillChildProcessesOnTimeout(t *testing.T) {
+	// The converter hands the work to a child that keeps the output pipe open, as soffice does.
+	converter := ConverterFunc(func(ctx context.Context, dir string, input string) (string, error) {
+		output := filepath.Join(dir, "result")
+		return output, run(ctx, output, "/bin/sh", "-c", "sleep 30 & wait")
+	})
+	pool := NewPool(PoolConfig{Timeout: 100 * time.Millisecond})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- pool.Convert(context.Background(), converter, strings.NewReader("content"), "test.txt", func(*os.File) error {
+			t.Error("timed out conversion should not produce a result")
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-done:
+		require.Equal(t, ErrTimeout, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("conversion waited for the converter's child process")
+	}
+}
+
+func TestConvert_Wkhtmltopdf_ShouldBlockNetworkAccess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "convert-test-")
+	require.Nil(t, err)
+	defer func() { require.Nil(t, os.RemoveAll(dir)) }()
+
+	// A stand-in for wkhtmltopdf that records its arguments and writes the output file, its last one.
+	script := "#!/bin/sh\necho \"$@\" > \"" + filepath.Join(dir, "args") + "\"\nfor last; do :; done\ntouch \"$last\"\n"
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "wkhtmltopdf"), []byte(script), 0700))
+
+	path := os.Getenv("PATH")
+	require.Nil(t, os.Setenv("PATH", dir+string(os.PathListSeparator)+path))
+	defer func() { require.Nil(t, os.Setenv("PATH", path)) }()
+
+	output, err := Wkhtmltopdf{}.Convert(context.Background(), dir, filepath.Join(dir, "source.html"))
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(dir, "result.pdf"), output)
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	require.Nil(t, err)
+	require.Contains(t, string(args), "--disable-javascript --disable-local-file-access --proxy "+unreachableProxy)
+}
@@ -0,0 +1,136 @@
+package convert
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultWorkers = 2
+	DefaultTimeout = time.Minute
+)
+
+var ErrTimeout = errors.New("conversion timed out")
+
+// Converter converts the document at input, writing its result into dir, and returns the path of
+// the result. It must stop when ctx is done.
+type Converter interface {
+	Convert(ctx context.Context, dir string, input string) (string, error)
+}
+
+// ConverterFunc adapts a function to a Converter.
+type ConverterFunc func(ctx context.Context, dir string, input string) (string, error)
+
+func (f ConverterFunc) Convert(ctx context.Context, dir string, input string) (string, error) {
+	return f(ctx, dir, input)
+}
+
+// PoolConfig controls how many conversions run at once and how long each may take. Zero values are
+// replaced by the package defaults.
+type PoolConfig struct {
+	Workers int
+	Timeout time.Duration
+}
+
+// Pool runs conversions with a bounded number at a time. Every conversion works in a temporary
+// directory of its own that is removed once it has finished, so concurrent conversions never see
+// each other's files. Requests that find all workers busy wait until one is free or their context ends.
+type Pool struct {
+	timeout time.Duration
+	slots   chan struct{}
+}
+
+func NewPool(config PoolConfig) *Pool {
+	if config.Workers <= 0 {
+		config.Workers = DefaultWorkers
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	return &Pool{
+		timeout: config.Timeout,
+		slots:   make(chan struct{}, config.Workers),
+	}
+}
+
+// Convert copies source into a temporary file named after name, so that converters that choose an
+// import filter by extension can do so, converts it with converter and passes the result to fn. The
+// result is only valid until fn returns. The worker is freed as soon as the converter returns, so a
+// slow fn, such as one streaming the result to a client, does not hold up other conversions.
+func (p *Pool) Convert(ctx context.Context, converter Converter, source io.Reader, name string, fn func(result *os.File) error) error {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	released := false
+	release := func() {
+		if !released {
+			released = true
+			<-p.slots
+		}
+	}
+	defer release()
+
+	dir, err := ioutil.TempDir("", "convert-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	input, err := writeInput(dir, source, name)
+	if err != nil {
+		return err
+	}
+
+	output := filepath.Join(dir, "out")
+	if err := os.Mkdir(output, 0700); err != nil {
+		return err
+	}
+
+	convertCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	path, err := converter.Convert(convertCtx, output, input)
+	release()
+	if err != nil {
+		if ctx.Err() == nil && convertCtx.Err() == context.DeadlineExceeded {
+			return ErrTimeout
+		}
+		return err
+	}
+
+	result, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+
+	return fn(result)
+}
+
+func writeInput(dir string, source io.Reader, name string) (string, error) {
+	input := filepath.Join(dir, "in")
+	if err := os.Mkdir(input, 0700); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(input, "source"+strings.ToLower(filepath.Ext(name)))
+	dst, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(dst, source)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return path, err
+}
@@ -0,0 +1,134 @@
+package convert
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func copyInput(ctx context.Context, dir string, input string) (string, error) {
+	content, err := ioutil.ReadFile(input)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, "result")
+	return path, ioutil.WriteFile(path, append([]byte(filepath.Base(input)+":"), content...), 0600)
+}
+
+func TestConvert_Pool_ShouldConvertInTemporaryDirectory(t *testing.T) {
+	pool := NewPool(PoolConfig{})
+
+	var dir string
+	err := pool.Convert(context.Background(), ConverterFunc(copyInput), strings.NewReader("content"), "Report.DOCX", func(result *os.File) error {
+		dir = filepath.Dir(filepath.Dir(result.Name()))
+		content, err := ioutil.ReadAll(result)
+		require.Nil(t, err)
+		require.Equal(t, "source.docx:content", string(content))
+		return nil
+	})
+	require.Nil(t, err)
+
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestConvert_Pool_ShouldBoundConcurrentConversions(t *testing.T) {
+	var running, peak int32
+	converter := ConverterFunc(func(ctx context.Context, dir string, input string) (string, error) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			previous := atomic.LoadInt32(&peak)
+			if current <= previous || atomic.CompareAndSwapInt32(&peak, previous, current) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		return copyInput(ctx, dir, input)
+	})
+	pool := NewPool(PoolConfig{Workers: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := pool.Convert(context.Background(), converter, strings.NewReader("content"), "test.txt", func(*os.File) error { return nil })
+			require.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(2), peak)
+}
+
+func TestConvert_Pool_ShouldFreeWorkerBeforeCallingFn(t *testing.T) {
+	pool := NewPool(PoolConfig{Workers: 1})
+
+	second := make(chan error)
+	err := pool.Convert(context.Background(), ConverterFunc(copyInput), strings.NewReader("content"), "test.txt", func(*os.File) error {
+		go func() {
+			second <- pool.Convert(context.Background(), ConverterFunc(copyInput), strings.NewReader("content"), "test.txt", func(*os.File) error { return nil })
+		}()
+
+		select {
+		case err := <-second:
+			return err
+		case <-time.After(time.Second):
+			t.Fatal("conversion waited for the result of another to be consumed")
+			return nil
+		}
+	})
+	require.Nil(t, err)
+}
+
+func TestConvert_Pool_ShouldReturnErrTimeout(t *testing.T) {
+	converter := ConverterFunc(func(ctx context.Context, dir string, input string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	pool := NewPool(PoolConfig{Timeout: 10 * time.Millisecond})
+
+	err := pool.Convert(context.Background(), converter, strings.NewReader("content"), "test.txt", func(*os.File) error {
+		t.Fatal("timed out conversion should not produce a result")
+		return nil
+	})
+	require.Equal(t, ErrTimeout, err)
+}
+
+func TestConvert_Pool_ShouldStopWaitingWhenContextEnds(t *testing.T) {
+	release := make(chan struct{})
+	converter := ConverterFunc(func(ctx context.Context, dir string, input string) (string, error) {
+		<-release
+		return copyInput(ctx, dir, input)
+	})
+	pool := NewPool(PoolConfig{Workers: 1})
+
+	done := make(chan error)
+	go func() {
+		done <- pool.Convert(context.Background(), converter, strings.NewReader("content"), "test.txt", func(*os.File) error { return nil })
+	}()
+
+	// Wait for the first conversion to hold the only worker.
+	for len(pool.slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := pool.Convert(ctx, converter, strings.NewReader("content"), "test.txt", func(*os.File) error { return nil })
+	require.Equal(t, context.Canceled, err)
+
+	close(release)
+	require.Nil(t, <-done)
+}
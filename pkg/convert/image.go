@@ -0,0 +1,63 @@
+package convert
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+
+	// Registered with image.Decode for the formats ImageToPNG reads.
+	_ "image/gif"
+	_ "image/jpeg"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// maxImagePixels bounds the images that are decoded, as for thumbnails.
+const maxImagePixels = 50000000
+
+var ErrUndecodable = errors.New("file content could not be decoded")
+
+// ImageToPNG re-encodes JPEG, GIF, WebP, BMP and TIFF images as PNG. Only the first frame of animated
+// images is kept.
+type ImageToPNG struct{}
+
+func (ImageToPNG) Convert(ctx context.Context, dir string, input string) (string, error) {
+	src, err := os.Open(input)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	config, _, err := image.DecodeConfig(src)
+	if err != nil {
+		return "", ErrUndecodable
+	} else if int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return "", ErrTooLarge
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	img, _, err := image.Decode(src)
+	if err != nil {
+		return "", ErrUndecodable
+	}
+
+	path := filepath.Join(dir, "result.png")
+	dst, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+
+	err = png.Encode(dst, img)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return path, err
+}
@@ -0,0 +1,240 @@
+package convert
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	rulePattern        = regexp.MustCompile(`^ {0,3}([-*_])( *[-*_]){2,} *$`)
+	unorderedPattern   = regexp.MustCompile(`^ {0,3}[-*+]\s+(.*)$`)
+	orderedPattern     = regexp.MustCompile(`^ {0,3}\d{1,9}[.)]\s+(.*)$`)
+	blockquotePattern  = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+	fencePattern       = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	indentedCodePrefix = regexp.MustCompile(`^(    |\t)`)
+)
+
+// renderMarkdown renders the commonly used subset of markdown: headings, paragraphs, block quotes,
+// flat lists, rules and code blocks, with emphasis, code spans, links and images inline.
+func renderMarkdown(text string) string {
+	out := &strings.Builder{}
+	lines := strings.Split(text, "\n")
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+
+		case fencePattern.MatchString(line):
+			fence := fencePattern.FindStringSubmatch(line)[1]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			i++
+			writeCode(out, code)
+
+		case indentedCodePrefix.MatchString(line):
+			var code []string
+			for ; i < len(lines) && (indentedCodePrefix.MatchString(lines[i]) || strings.TrimSpace(lines[i]) == ""); i++ {
+				code = append(code, indentedCodePrefix.ReplaceAllString(lines[i], ""))
+			}
+			for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+				code = code[:len(code)-1]
+			}
+			writeCode(out, code)
+
+		case headingPattern.MatchString(line):
+			match := headingPattern.FindStringSubmatch(line)
+			fmt.Fprintf(out, "<h%v>%v</h%v>\n", len(match[1]), renderInline(match[2]), len(match[1]))
+			i++
+
+		case rulePattern.MatchString(line):
+			out.WriteString("<hr>\n")
+			i++
+
+		case blockquotePattern.MatchString(line):
+			var quoted []string
+			for ; i < len(lines) && blockquotePattern.MatchString(lines[i]); i++ {
+				quoted = append(quoted, blockquotePattern.FindStringSubmatch(lines[i])[1])
+			}
+			fmt.Fprintf(out, "<blockquote>\n%v</blockquote>\n", renderMarkdown(strings.Join(quoted, "\n")))
+
+		case unorderedPattern.MatchString(line), orderedPattern.MatchString(line):
+			pattern, tag := unorderedPattern, "ul"
+			if !unorderedPattern.MatchString(line) {
+				pattern, tag = orderedPattern, "ol"
+			}
+
+			fmt.Fprintf(out, "<%v>\n", tag)
+			for i < len(lines) && pattern.MatchString(lines[i]) {
+				item := []string{pattern.FindStringSubmatch(lines[i])[1]}
+				for i++; i < len(lines) && isContinuation(lines[i]); i++ {
+					item = append(item, strings.TrimSpace(lines[i]))
+				}
+				fmt.Fprintf(out, "<li>%v</li>\n", renderInline(strings.Join(item, "\n")))
+			}
+			fmt.Fprintf(out, "</%v>\n", tag)
+
+		default:
+			paragraph := []string{strings.TrimSpace(line)}
+			for i++; i < len(lines) && isContinuation(lines[i]); i++ {
+				paragraph = append(paragraph, strings.TrimSpace(lines[i]))
+			}
+			fmt.Fprintf(out, "<p>%v</p>\n", renderInline(strings.Join(paragraph, "\n")))
+		}
+	}
+
+	return out.String()
+}
+
+// isContinuation reports whether a line carries on the paragraph or list item before it, rather than
+// ending it or starting a block of its own.
+func isContinuation(line string) bool {
+	return strings.TrimSpace(line) != "" &&
+		!fencePattern.MatchString(line) &&
+		!headingPattern.MatchString(line) &&
+		!rulePattern.MatchString(line) &&
+		!blockquotePattern.MatchString(line) &&
+		!unorderedPattern.MatchString(line) &&
+		!orderedPattern.MatchString(line)
+}
+
+func writeCode(out *strings.Builder, code []string) {
+	fmt.Fprintf(out, "<pre><code>%v</code></pre>\n", html.EscapeString(strings.Join(code, "\n")))
+}
+
+// renderInline renders the inline markup of a block of text, escaping everything else.
+func renderInline(text string) string {
+	out := &strings.Builder{}
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes) && (unicode.IsPunct(runes[i+1]) || unicode.IsSymbol(runes[i+1])):
+			out.WriteString(html.EscapeString(string(runes[i+1])))
+			i++
+			continue
+
+		case r == '`':
+			run := countRun(runes, i, '`')
+			if end := findRun(runes, i+run, "`", run); end >= 0 {
+				code := strings.TrimSpace(string(runes[i+run : end]))
+				fmt.Fprintf(out, "<code>%v</code>", html.EscapeString(code))
+				i = end + run - 1
+				continue
+			}
+
+		case (r == '*' || r == '_') && i+1 < len(runes) && runes[i+1] == r:
+			if end := findRun(runes, i+2, string([]rune{r, r}), 1); end > i+2 {
+				fmt.Fprintf(out, "<strong>%v</strong>", renderInline(string(runes[i+2:end])))
+				i = end + 1
+				continue
+			}
+
+		case r == '*' || (r == '_' && (i == 0 || !isWordRune(runes[i-1]))):
+			if end := findRun(runes, i+1, string(r), 1); end > i+1 && !unicode.IsSpace(runes[i+1]) {
+				fmt.Fprintf(out, "<em>%v</em>", renderInline(string(runes[i+1:end])))
+				i = end
+				continue
+			}
+
+		case r == '!' && i+1 < len(runes) && runes[i+1] == '[':
+			if label, target, end, ok := parseLink(runes, i+1); ok {
+				fmt.Fprintf(out, `<img src="%v" alt="%v">`, html.EscapeString(safeURL(target)), html.EscapeString(label))
+				i = end
+				continue
+			}
+
+		case r == '[':
+			if label, target, end, ok := parseLink(runes, i); ok {
+				fmt.Fprintf(out, `<a href="%v">%v</a>`, html.EscapeString(safeURL(target)), renderInline(label))
+				i = end
+				continue
+			}
+		}
+
+		out.WriteString(html.EscapeString(string(r)))
+	}
+
+	return out.String()
+}
+
+// parseLink parses a link of the form [label](target) starting at the opening bracket, returning the
+// index of the closing parenthesis.
+func parseLink(runes []rune, start int) (string, string, int, bool) {
+	depth := 0
+	for i := start; i < len(runes); i++ {
+		switch runes[i] {
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth > 0 {
+				continue
+			}
+			if i+1 >= len(runes) || runes[i+1] != '(' {
+				return "", "", 0, false
+			}
+			for j := i + 2; j < len(runes); j++ {
+				if runes[j] == ')' {
+					target := strings.TrimSpace(string(runes[i+2 : j]))
+					if fields := strings.Fields(target); len(fields) > 0 {
+						target = fields[0]
+					}
+					return string(runes[start+1 : i]), target, j, true
+				}
+			}
+			return "", "", 0, false
+		}
+	}
+	return "", "", 0, false
+}
+
+// safeURL keeps relative links and web and mail addresses, replacing any other scheme, such as
+// javascript:, with a link that goes nowhere.
+func safeURL(target string) string {
+	target = strings.Trim(target, "<>")
+	if colon := strings.IndexRune(target, ':'); colon >= 0 && !strings.ContainsAny(target[:colon], "/?#") {
+		switch strings.ToLower(target[:colon]) {
+		case "http", "https", "mailto":
+		default:
+			return "#"
+		}
+	}
+	return target
+}
+
+func countRun(runes []rune, start int, r rune) int {
+	n := 0
+	for start+n < len(runes) && runes[start+n] == r {
+		n++
+	}
+	return n
+}
+
+// findRun returns the index at which delimiter next occurs exactly count times in a row at or after
+// start, or -1.
+func findRun(runes []rune, start int, delimiter string, count int) int {
+	needle := []rune(strings.Repeat(delimiter, count))
+	for i := start; i+len(needle) <= len(runes); i++ {
+		if string(runes[i:i+len(needle)]) != string(needle) {
+			continue
+		}
+		if len(delimiter) == 1 && (i+len(needle) < len(runes) && runes[i+len(needle)] == needle[0]) {
+			i += countRun(runes, i, needle[0]) - 1
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
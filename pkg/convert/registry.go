@@ -0,0 +1,128 @@
+package convert
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	FormatPDF  = "pdf"
+	FormatPNG  = "png"
+	FormatHTML = "html"
+	FormatText = "txt"
+)
+
+var ErrNoConverter = errors.New("no converter available for this content type and format")
+
+// Formats maps the formats files can be converted to onto the content type of the result.
+var Formats = map[string]string{
+	FormatPDF:  "application/pdf",
+	FormatPNG:  "image/png",
+	FormatHTML: "text/html; charset=utf-8",
+	FormatText: "text/plain; charset=utf-8",
+}
+
+var officeTypes = []string{
+	"application/msword",
+	"application/vnd.ms-excel",
+	"application/vnd.ms-powerpoint",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"application/vnd.oasis.opendocument.text",
+	"application/vnd.oasis.opendocument.spreadsheet",
+	"application/vnd.oasis.opendocument.presentation",
+	"application/vnd.oasis.opendocument.graphics",
+	"text/rtf",
+}
+
+var imageTypes = []string{"image/jpeg", "image/gif", "image/webp", "image/bmp", "image/tiff"}
+
+type registryKey struct {
+	contentType string
+	format      string
+}
+
+// Registry picks the converter for a conversion by the content type of the source and the format
+// asked for, and runs it on its pool.
+type Registry struct {
+	pool       *Pool
+	converters map[registryKey]Converter
+}
+
+func NewRegistry(pool *Pool) *Registry {
+	return &Registry{pool: pool, converters: make(map[registryKey]Converter)}
+}
+
+// NewDefaultRegistry creates a registry with the converters built into the service: LibreOffice for
+// office documents, wkhtmltopdf for HTML, and pure Go renderers for text, markdown and images.
+func NewDefaultRegistry(pool *Pool) *Registry {
+	registry := NewRegistry(pool)
+	registry.Register(FormatPDF, LibreOffice{}, officeTypes...)
+	registry.Register(FormatPDF, Wkhtmltopdf{}, "text/html")
+	registry.Register(FormatPDF, TextToPDF{}, "text/plain", "text/markdown", "text/csv")
+	registry.Register(FormatHTML, TextToHTML{}, "text/plain", "text/csv")
+	registry.Register(FormatHTML, MarkdownToHTML{}, "text/markdown")
+	registry.Register(FormatText, PlainText{}, "text/markdown", "text/csv")
+	registry.Register(FormatPNG, ImageToPNG{}, imageTypes...)
+	return registry
+}
+
+// Register makes converter the one used to convert files of the given content types to format,
+// replacing any registered before.
+func (r *Registry) Register(format string, converter Converter, contentTypes ...string) {
+	for _, contentType := range contentTypes {
+		r.converters[registryKey{contentType: contentType, format: format}] = converter
+	}
+}
+
+// Lookup returns the converter for files of contentType, which must already be reduced by SourceType.
+func (r *Registry) Lookup(contentType string, format string) (Converter, bool) {
+	converter, ok := r.converters[registryKey{contentType: contentType, format: format}]
+	return converter, ok
+}
+
+// Convert converts source, a file named name of the given content type, to format and passes the result
+// to fn as Pool.Convert does. It returns ErrNoConverter if there is no converter for the conversion.
+func (r *Registry) Convert(ctx context.Context, contentType string, format string, source io.Reader, name string, fn func(result *os.File) error) error {
+	converter, ok := r.Lookup(SourceType(contentType, name), format)
+	if !ok {
+		return ErrNoConverter
+	}
+	return r.pool.Convert(ctx, converter, source, name, fn)
+}
+
+// SourceType reduces a stored content type to the media type converters are registered by. Content
+// sniffing cannot tell markdown from plain text, so plain text files are taken to be markdown by their
+// extension.
+func SourceType(contentType string, name string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	switch mediaType {
+	case "text/x-markdown":
+		return "text/markdown"
+	case "text/plain":
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".md", ".markdown":
+			return "text/markdown"
+		}
+	}
+	return mediaType
+}
+
+// IsFormat reports whether a file of contentType is already in format, so needs no conversion.
+func IsFormat(contentType string, name string, format string) bool {
+	target, ok := Formats[format]
+	if !ok {
+		return false
+	}
+	return SourceType(contentType, name) == SourceType(target, "")
+}
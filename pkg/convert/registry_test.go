@@ -0,0 +1,73 @@
+package convert
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert_SourceType_ShouldReduceContentTypes(t *testing.T) {
+	require.Equal(t, "text/html", SourceType("text/html; charset=utf-8", "index.html"))
+	require.Equal(t, "text/plain", SourceType("text/plain; charset=utf-8", "notes.txt"))
+	require.Equal(t, "text/markdown", SourceType("text/plain; charset=utf-8", "README.MD"))
+	require.Equal(t, "text/markdown", SourceType("text/x-markdown", "notes"))
+	require.Equal(t, "application/pdf", SourceType("application/pdf", "test.md"))
+}
+
+func TestConvert_IsFormat_ShouldMatchFilesAlreadyInFormat(t *testing.T) {
+	require.True(t, IsFormat("application/pdf", "test.pdf", FormatPDF))
+	require.True(t, IsFormat("image/png", "test.png", FormatPNG))
+	require.True(t, IsFormat("text/plain; charset=utf-8", "test.txt", FormatText))
+	require.False(t, IsFormat("text/plain; charset=utf-8", "test.md", FormatText))
+	require.False(t, IsFormat("image/jpeg", "test.jpg", FormatPNG))
+	require.False(t, IsFormat("application/pdf", "test.pdf", "doc"))
+}
+
+func TestConvert_DefaultRegistry_ShouldRegisterBuiltInConverters(t *testing.T) {
+	registry := NewDefaultRegistry(NewPool(PoolConfig{}))
+
+	tests := []struct {
+		contentType string
+		format      string
+		converter   Converter
+	}{
+		{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", FormatPDF, LibreOffice{}},
+		{"text/html", FormatPDF, Wkhtmltopdf{}},
+		{"text/plain", FormatPDF, TextToPDF{}},
+		{"text/markdown", FormatHTML, MarkdownToHTML{}},
+		{"text/plain", FormatHTML, TextToHTML{}},
+		{"text/markdown", FormatText, PlainText{}},
+		{"image/jpeg", FormatPNG, ImageToPNG{}},
+	}
+	for _, test := range tests {
+		converter, ok := registry.Lookup(test.contentType, test.format)
+		require.True(t, ok, test.contentType+" to "+test.format)
+		require.Equal(t, test.converter, converter)
+	}
+
+	_, ok := registry.Lookup("application/zip", FormatPDF)
+	require.False(t, ok)
+}
+
+func TestConvert_Registry_ShouldReturnErrNoConverter(t *testing.T) {
+	registry := NewRegistry(NewPool(PoolConfig{}))
+	registry.Register(FormatHTML, MarkdownToHTML{}, "text/markdown")
+
+	err := registry.Convert(context.Background(), "text/plain", FormatHTML, strings.NewReader("# Test"), "test.txt", func(*os.File) error {
+		t.Fatal("no converter should have run")
+		return nil
+	})
+	require.Equal(t, ErrNoConverter, err)
+
+	err = registry.Convert(context.Background(), "text/plain", FormatHTML, strings.NewReader("# Test"), "test.md", func(result *os.File) error {
+		content, err := ioutil.ReadAll(result)
+		require.Nil(t, err)
+		require.Contains(t, string(content), "<h1>Test</h1>")
+		return nil
+	})
+	require.Nil(t, err)
+}
@@ -0,0 +1,199 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxTextSize bounds the text files the pure Go renderers read into memory.
+	maxTextSize = 16 << 20
+
+	// Text is laid out on A4 pages in 10pt Courier, whose glyphs are 6pt wide.
+	pageWidth  = 595
+	pageHeight = 842
+	pageMargin = 50
+	fontSize   = 10
+	lineHeight = 12
+	charWidth  = 6
+	lineLength = (pageWidth - 2*pageMargin) / charWidth
+	pageLines  = (pageHeight - 2*pageMargin) / lineHeight
+	tabWidth   = 4
+
+	// htmlTemplate wraps rendered HTML in a document, taking a style sheet and the body.
+	htmlTemplate = "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<style>%v</style>\n</head>\n<body>\n%v</body>\n</html>\n"
+)
+
+var ErrTooLarge = errors.New("file is too large to convert")
+
+// PlainText serves text formats that need no rendering, such as markdown, as plain text.
+type PlainText struct{}
+
+func (PlainText) Convert(ctx context.Context, dir string, input string) (string, error) {
+	text, err := readText(input)
+	if err != nil {
+		return "", err
+	}
+	return writeResult(dir, "result.txt", []byte(text))
+}
+
+// TextToHTML renders plain text as a preformatted HTML document.
+type TextToHTML struct{}
+
+func (TextToHTML) Convert(ctx context.Context, dir string, input string) (string, error) {
+	text, err := readText(input)
+	if err != nil {
+		return "", err
+	}
+
+	body := "<pre>" + html.EscapeString(text) + "</pre>\n"
+	return writeResult(dir, "result.html", []byte(fmt.Sprintf(htmlTemplate, "pre { white-space: pre-wrap; }", body)))
+}
+
+// MarkdownToHTML renders markdown as an HTML document. Raw HTML in the source is escaped rather than
+// passed through, and links are only kept for web and mail addresses.
+type MarkdownToHTML struct{}
+
+func (MarkdownToHTML) Convert(ctx context.Context, dir string, input string) (string, error) {
+	text, err := readText(input)
+	if err != nil {
+		return "", err
+	}
+
+	body := renderMarkdown(text)
+	return writeResult(dir, "result.html", []byte(fmt.Sprintf(htmlTemplate, "body { font-family: sans-serif; }", body)))
+}
+
+// TextToPDF lays out text in a monospaced font, wrapping long lines, and writes it as a PDF. Characters
+// outside Latin-1 cannot be shown with the PDF standard fonts and are replaced by question marks.
+type TextToPDF struct{}
+
+func (TextToPDF) Convert(ctx context.Context, dir string, input string) (string, error) {
+	text, err := readText(input)
+	if err != nil {
+		return "", err
+	}
+	return writeResult(dir, "result.pdf", renderPDF(layoutText(text)))
+}
+
+func readText(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	} else if info.Size() > maxTextSize {
+		return "", ErrTooLarge
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	return strings.ToValidUTF8(text, "�"), nil
+}
+
+func writeResult(dir string, name string, content []byte) (string, error) {
+	path := filepath.Join(dir, name)
+	return path, ioutil.WriteFile(path, content, 0600)
+}
+
+// layoutText splits text into pages of lines that fit the page width, expanding tabs.
+func layoutText(text string) [][]string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		var expanded []rune
+		for _, r := range line {
+			if r == '\t' {
+				for n := tabWidth - len(expanded)%tabWidth; n > 0; n-- {
+					expanded = append(expanded, ' ')
+				}
+				continue
+			}
+			expanded = append(expanded, r)
+		}
+
+		for len(expanded) > lineLength {
+			lines = append(lines, string(expanded[:lineLength]))
+			expanded = expanded[lineLength:]
+		}
+		lines = append(lines, string(expanded))
+	}
+
+	pages := [][]string{}
+	for len(lines) > pageLines {
+		pages = append(pages, lines[:pageLines])
+		lines = lines[pageLines:]
+	}
+	return append(pages, lines)
+}
+
+// renderPDF writes pages of text as a PDF document using the built in Courier font.
+func renderPDF(pages [][]string) []byte {
+	out := &bytes.Buffer{}
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(out, "%v 0 obj\n%v\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// Objects 1 to 3 are the catalog, the page tree and the font; each page then takes two more, the
+	// page itself followed by its content stream.
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%v 0 R", 4+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%v] /Count %v >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, lines := range pages {
+		content := &bytes.Buffer{}
+		fmt.Fprintf(content, "BT\n/F1 %v Tf\n%v TL\n%v %v Td\n", fontSize, lineHeight, pageMargin, pageHeight-pageMargin-fontSize)
+		for _, line := range lines {
+			fmt.Fprintf(content, "(%v) Tj T*\n", pdfString(line))
+		}
+		content.WriteString("ET")
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %v %v] /Resources << /Font << /F1 3 0 R >> >> /Contents %v 0 R >>",
+			pageWidth, pageHeight, 5+2*i))
+		object(fmt.Sprintf("<< /Length %v >>\nstream\n%v\nendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(out, "xref\n0 %v\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %v /Root 1 0 R >>\nstartxref\n%v\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// pdfString encodes a line for a PDF literal string in WinAnsiEncoding, which matches Latin-1 for
+// the characters kept.
+func pdfString(line string) string {
+	encoded := make([]byte, 0, len(line))
+	for _, r := range line {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			encoded = append(encoded, '\\', byte(r))
+		case r >= ' ' && r < utf8.RuneSelf && r != 0x7f, r >= 0xa0 && r <= 0xff:
+			encoded = append(encoded, byte(r))
+		case r < ' ':
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return string(encoded)
+}
@@ -0,0 +1,126 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func convertContent(t *testing.T, converter Converter, name string, content []byte) []byte {
+	dir, err := ioutil.TempDir("", "convert-test-")
+	require.Nil(t, err)
+	defer func() { require.Nil(t, os.RemoveAll(dir)) }()
+
+	input := filepath.Join(dir, name)
+	require.Nil(t, ioutil.WriteFile(input, content, 0600))
+
+	path, err := converter.Convert(context.Background(), dir, input)
+	require.Nil(t, err)
+
+	result, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	return result
+}
+
+func TestConvert_MarkdownToHTML_ShouldRenderMarkdown(t *testing.T) {
+	markdown := strings.Join([]string{
+		"# Title",
+		"",
+		"Some *emphasis*, **strong** and `code <b>`",
+		"on two lines with a [link](https://example.com/a?b=1&c=2).",
+		"",
+		"- one",
+		"- two",
+		"",
+		"1. first",
+		"",
+		"> quoted",
+		"",
+		"```",
+		"<script>alert(1)</script>",
+		"```",
+		"",
+		"---",
+		"",
+		"<b>raw</b> and [bad](javascript:alert(1)) and snake_case_name \\*literal\\*",
+	}, "\n")
+
+	html := string(convertContent(t, MarkdownToHTML{}, "source.md", []byte(markdown)))
+	require.Contains(t, html, "<h1>Title</h1>")
+	require.Contains(t, html, "<p>Some <em>emphasis</em>, <strong>strong</strong> and <code>code &lt;b&gt;</code>\n"+
+		`on two lines with a <a href="https://example.com/a?b=1&amp;c=2">link</a>.</p>`)
+	require.Contains(t, html, "<ul>\n<li>one</li>\n<li>two</li>\n</ul>")
+	require.Contains(t, html, "<ol>\n<li>first</li>\n</ol>")
+	require.Contains(t, html, "<blockquote>\n<p>quoted</p>\n</blockquote>")
+	require.Contains(t, html, "<pre><code>&lt;script&gt;alert(1)&lt;/script&gt;</code></pre>")
+	require.Contains(t, html, "<hr>")
+	require.Contains(t, html, `<p>&lt;b&gt;raw&lt;/b&gt; and <a href="#">bad</a>) and snake_case_name *literal*</p>`)
+	require.NotContains(t, html, "<script>")
+}
+
+func TestConvert_TextToHTML_ShouldEscapeText(t *testing.T) {
+	html := string(convertContent(t, TextToHTML{}, "source.txt", []byte("a < b\r\n")))
+	require.Contains(t, html, "<pre>a &lt; b\n</pre>")
+}
+
+func TestConvert_TextToPDF_ShouldWritePagedPDF(t *testing.T) {
+	lines := make([]string, pageLines+1)
+	for i := range lines {
+		lines[i] = "line " + strconv.Itoa(i)
+	}
+	lines[0] = strings.Repeat("x", lineLength+5) + "\t(é€)"
+
+	pdf := convertContent(t, TextToPDF{}, "source.txt", []byte(strings.Join(lines, "\n")))
+	require.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")))
+	require.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+	require.Contains(t, string(pdf), "/Count 2")
+	require.Contains(t, string(pdf), "(xxxxx \\(\xe9?\\)) Tj")
+
+	// Every cross reference offset must point at the object it names.
+	match := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	require.NotNil(t, match)
+	xref, err := strconv.Atoi(string(match[1]))
+	require.Nil(t, err)
+	require.True(t, bytes.HasPrefix(pdf[xref:], []byte("xref\n")))
+
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	require.Len(t, offsets, 3+2*2)
+	for i, offset := range offsets {
+		position, err := strconv.Atoi(string(offset[1]))
+		require.Nil(t, err)
+		require.True(t, bytes.HasPrefix(pdf[position:], []byte(strconv.Itoa(i+1)+" 0 obj\n")))
+	}
+}
+
+func TestConvert_ImageToPNG_ShouldReencodeImages(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.Nil(t, jpeg.Encode(buf, image.NewRGBA(image.Rect(0, 0, 8, 4)), nil))
+
+	result := convertContent(t, ImageToPNG{}, "source.jpg", buf.Bytes())
+	img, err := png.Decode(bytes.NewReader(result))
+	require.Nil(t, err)
+	require.Equal(t, image.Rect(0, 0, 8, 4), img.Bounds())
+}
+
+func TestConvert_ImageToPNG_ShouldRejectInvalidImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "convert-test-")
+	require.Nil(t, err)
+	defer func() { require.Nil(t, os.RemoveAll(dir)) }()
+
+	input := filepath.Join(dir, "source.jpg")
+	require.Nil(t, ioutil.WriteFile(input, []byte("not an image"), 0600))
+
+	_, err = ImageToPNG{}.Convert(context.Background(), dir, input)
+	require.Equal(t, ErrUndecodable, err)
+}
@@ -0,0 +1,82 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"content-service-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (db *Handler) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	result, err := db.getAPIKeyCollection().InsertOne(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	key.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetAPIKeys lists every API key, newest first.
+func (db *Handler) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	cursor, err := db.getAPIKeyCollection().Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []models.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// UseAPIKey looks up an unexpired API key by the hash of the key and records that it has been used.
+func (db *Handler) UseAPIKey(ctx context.Context, hash string) (*models.APIKey, error) {
+	now := time.Now()
+	filter := bson.M{
+		"hash": hash,
+		"$or": bson.A{
+			bson.M{"expires": bson.M{"$exists": false}},
+			bson.M{"expires": bson.M{"$gt": now}},
+		},
+	}
+
+	result := db.getAPIKeyCollection().FindOneAndUpdate(
+		ctx,
+		filter,
+		bson.M{"$set": bson.M{"lastUsed": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var key models.APIKey
+	if err := result.Decode(&key); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (db *Handler) DeleteAPIKey(ctx context.Context, keyID primitive.ObjectID) error {
+	result, err := db.getAPIKeyCollection().DeleteOne(ctx, bson.M{"_id": keyID})
+	if err != nil {
+		return err
+	} else if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (db *Handler) getAPIKeyCollection() *mongo.Collection {
+	return db.Client.Database(db.Database).Collection(db.APIKeyCollection)
+}
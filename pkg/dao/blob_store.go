@@ -0,0 +1,25 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore holds the content of stored files, while their metadata stays in the file collection.
+// Blobs are immutable once written and are addressed by the ID the store assigns on Put.
+type BlobStore interface {
+	Put(ctx context.Context, name string, source io.Reader) (*BlobInfo, error)
+	Get(ctx context.Context, blobID primitive.ObjectID) (FileStream, error)
+	Delete(ctx context.Context, blobID primitive.ObjectID) error
+	Stat(ctx context.Context, blobID primitive.ObjectID) (*BlobInfo, error)
+}
+
+type BlobInfo struct {
+	ID   primitive.ObjectID
+	Size int64
+}
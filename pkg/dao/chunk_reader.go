@@ -0,0 +1,156 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FileStream is a seekable reader over the content of a stored file.
+type FileStream interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+type gridFile struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Length    int64              `bson:"length"`
+	ChunkSize int64              `bson:"chunkSize"`
+}
+
+type gridChunk struct {
+	N    int64  `bson:"n"`
+	Data []byte `bson:"data"`
+}
+
+// chunkCursor iterates over the chunks of a file, as a *mongo.Cursor does.
+type chunkCursor interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// chunkFinder opens a cursor over the chunks of a file in order, starting at chunk n.
+type chunkFinder func(ctx context.Context, fileID primitive.ObjectID, n int64) (chunkCursor, error)
+
+// chunkReader reads a GridFS file directly from its chunk collection. Unlike gridfs.DownloadStream,
+// seeking does not read through the preceding chunks; the next read opens a cursor starting at the
+// chunk that contains the new offset.
+type chunkReader struct {
+	ctx    context.Context
+	find   chunkFinder
+	file   gridFile
+	offset int64
+	cursor chunkCursor
+	buf    []byte
+}
+
+func newChunkReader(ctx context.Context, find chunkFinder, file gridFile) *chunkReader {
+	return &chunkReader{
+		ctx:  ctx,
+		find: find,
+		file: file,
+	}
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if c.offset >= c.file.Length {
+		return 0, io.EOF
+	}
+
+	for len(c.buf) == 0 {
+		if err := c.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	c.offset += int64(n)
+	return n, nil
+}
+
+func (c *chunkReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = c.offset + offset
+	case io.SeekEnd:
+		target = c.file.Length + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if target < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if target != c.offset {
+		if err := c.closeCursor(); err != nil {
+			return 0, err
+		}
+		c.buf = nil
+		c.offset = target
+	}
+
+	return target, nil
+}
+
+func (c *chunkReader) Close() error {
+	return c.closeCursor()
+}
+
+func (c *chunkReader) nextChunk() error {
+	if c.file.ChunkSize <= 0 {
+		return errors.New("invalid chunk size")
+	}
+
+	expected := c.offset / c.file.ChunkSize
+	if c.cursor == nil {
+		cursor, err := c.find(c.ctx, c.file.ID, expected)
+		if err != nil {
+			return err
+		}
+		c.cursor = cursor
+	}
+
+	if !c.cursor.Next(c.ctx) {
+		if err := c.cursor.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("chunk %v of file %v is missing", expected, c.file.ID.Hex())
+	}
+
+	var chunk gridChunk
+	if err := c.cursor.Decode(&chunk); err != nil {
+		return err
+	}
+
+	if chunk.N != expected {
+		return fmt.Errorf("expected chunk %v of file %v but found chunk %v", expected, c.file.ID.Hex(), chunk.N)
+	}
+
+	skip := c.offset - chunk.N*c.file.ChunkSize
+	if skip < 0 || skip > int64(len(chunk.Data)) {
+		return fmt.Errorf("chunk %v of file %v is truncated", chunk.N, c.file.ID.Hex())
+	}
+
+	c.buf = chunk.Data[skip:]
+	return nil
+}
+
+func (c *chunkReader) closeCursor() error {
+	if c.cursor == nil {
+		return nil
+	}
+
+	err := c.cursor.Close(c.ctx)
+	c.cursor = nil
+	return err
+}
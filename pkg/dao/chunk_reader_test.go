@@ -0,0 +1,140 @@
+package dao
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type sliceCursor struct {
+	chunks []gridChunk
+	next   int
+}
+
+func (s *sliceCursor) Next(ctx context.Context) bool {
+	s.next++
+	return s.next <= len(s.chunks)
+}
+
+func (s *sliceCursor) Decode(val interface{}) error {
+	*val.(*gridChunk) = s.chunks[s.next-1]
+	return nil
+}
+
+func (s *sliceCursor) Err() error {
+	return nil
+}
+
+func (s *sliceCursor) Close(ctx context.Context) error {
+	return nil
+}
+
+// newTestChunkReader serves "0123456789" in chunks of four bytes, recording the chunk each cursor
+// is opened at.
+func newTestChunkReader(opened *[]int64) *chunkReader {
+	chunks := []gridChunk{{N: 0, Data: []byte("0123")}, {N: 1, Data: []byte("4567")}, {N: 2, Data: []byte("89")}}
+	find := func(ctx context.Context, fileID primitive.ObjectID, n int64) (chunkCursor, error) {
+		*opened = append(*opened, n)
+		return &sliceCursor{chunks: chunks[n:]}, nil
+	}
+	return newChunkReader(context.Background(), find, gridFile{ID: primitive.NewObjectID(), Length: 10, ChunkSize: 4})
+}
+
+func TestChunkReader_ShouldReadAcrossChunks(t *testing.T) {
+	var opened []int64
+	reader := newTestChunkReader(&opened)
+
+	buf := make([]byte, 3)
+	n, err := reader.Read(buf)
+	require.Nil(t, err)
+	require.Equal(t, "012", string(buf[:n]))
+
+	// Reads stop at the end of the current chunk rather than spanning two.
+	n, err = reader.Read(make([]byte, 3))
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+
+	rest, err := ioutil.ReadAll(reader)
+	require.Nil(t, err)
+	require.Equal(t, "456789", string(rest))
+	require.Equal(t, []int64{0}, opened)
+}
+
+func TestChunkReader_ShouldSeekToChunkContainingOffset(t *testing.T) {
+	var opened []int64
+	reader := newTestChunkReader(&opened)
+
+	position, err := reader.Seek(5, io.SeekStart)
+	require.Nil(t, err)
+	require.Equal(t, int64(5), position)
+
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(reader, buf)
+	require.Nil(t, err)
+	require.Equal(t, "56", string(buf))
+
+	// Seeking to the current offset keeps the open cursor.
+	position, err = reader.Seek(-3, io.SeekEnd)
+	require.Nil(t, err)
+	require.Equal(t, int64(7), position)
+
+	position, err = reader.Seek(-2, io.SeekEnd)
+	require.Nil(t, err)
+	require.Equal(t, int64(8), position)
+
+	rest, err := ioutil.ReadAll(reader)
+	require.Nil(t, err)
+	require.Equal(t, "89", string(rest))
+
+	position, err = reader.Seek(-10, io.SeekCurrent)
+	require.Nil(t, err)
+	require.Equal(t, int64(0), position)
+	_, err = io.ReadFull(reader, buf)
+	require.Nil(t, err)
+	require.Equal(t, "01", string(buf))
+
+	require.Equal(t, []int64{1, 2, 0}, opened)
+}
+
+func TestChunkReader_ShouldHandleSeeksOutsideFile(t *testing.T) {
+	var opened []int64
+	reader := newTestChunkReader(&opened)
+
+	_, err := reader.Seek(-1, io.SeekStart)
+	require.NotNil(t, err)
+
+	_, err = reader.Seek(20, io.SeekStart)
+	require.Nil(t, err)
+	_, err = reader.Read(make([]byte, 1))
+	require.Equal(t, io.EOF, err)
+	require.Empty(t, opened)
+}
+
+func TestChunkReader_ShouldReportMissingChunks(t *testing.T) {
+	find := func(ctx context.Context, fileID primitive.ObjectID, n int64) (chunkCursor, error) {
+		return &sliceCursor{chunks: []gridChunk{{N: 0, Data: []byte("0123")}, {N: 2, Data: []byte("89")}}}, nil
+	}
+	reader := newChunkReader(context.Background(), find, gridFile{ID: primitive.NewObjectID(), Length: 10, ChunkSize: 4})
+
+	_, err := ioutil.ReadAll(reader)
+	require.NotNil(t, err)
+}
+
+func TestGridFSStore_ShouldRequireCollectionsOfOneBucket(t *testing.T) {
+	store, err := NewGridFSStore(nil, "db", "", "")
+	require.Nil(t, err)
+	require.Equal(t, "fs.files", store.FsCollection)
+	require.Equal(t, "fs.chunks", store.ChunkCollection)
+
+	_, err = NewGridFSStore(nil, "db", "content.files", "content.chunks")
+	require.Nil(t, err)
+
+	for _, collections := range [][2]string{{"files", "chunks"}, {"a.files", "b.chunks"}, {"fs.files", ""}} {
+		_, err = NewGridFSStore(nil, "db", collections[0], collections[1])
+		require.NotNil(t, err, collections)
+	}
+}
@@ -0,0 +1,271 @@
+package dao
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mimeSniffLength is the number of leading bytes mimetype inspects when detecting content type.
+const mimeSniffLength = 3072
+
+// storedContent describes the blob holding a file's bytes.
+type storedContent struct {
+	FileID      primitive.ObjectID
+	Size        int64
+	Hash        string
+	ContentType string
+}
+
+// sniffBuffer keeps the first mimeSniffLength bytes written to it and discards the rest.
+type sniffBuffer struct {
+	bytes.Buffer
+}
+
+func (s *sniffBuffer) Write(p []byte) (int, error) {
+	if remaining := mimeSniffLength - s.Len(); remaining > 0 {
+		if len(p) > remaining {
+			s.Buffer.Write(p[:remaining])
+		} else {
+			s.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (s *sniffBuffer) contentType() string {
+	return mimetype.Detect(s.Bytes()).String()
+}
+
+// storeContent writes source to the blob store unless identical content is already stored, in which case
+// the existing blob is reused. Seekable sources are hashed before anything is written so duplicates never
+// touch the store; other sources are hashed while they are written and the new blob is discarded if it
+// turns out to be a duplicate. Either way the content type is detected from the leading bytes, and the
+// caller holds a reference to the returned blob that it must release if it does not end up using it.
+func (db *Handler) storeContent(ctx context.Context, name string, source io.Reader) (*storedContent, error) {
+	var head sniffBuffer
+	if seeker, ok := source.(io.Seeker); ok {
+		hash := sha256.New()
+		size, err := io.Copy(io.MultiWriter(hash, &head), source)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		existing, err := db.findContent(ctx, hex.EncodeToString(hash.Sum(nil)))
+		if err != nil {
+			return nil, err
+		} else if existing != nil {
+			existing.Size = size
+			existing.ContentType = head.contentType()
+			return existing, nil
+		}
+	} else {
+		source = io.TeeReader(source, &head)
+	}
+
+	content, err := db.writeContent(ctx, name, source)
+	if err != nil {
+		return nil, err
+	}
+	content.ContentType = head.contentType()
+
+	existing, err := db.findContent(ctx, content.Hash)
+	if err == nil && existing == nil {
+		err = db.contentRefs().create(ctx, &contentRef{BlobID: content.FileID, Hash: content.Hash, Refs: 1})
+		if err == nil {
+			return content, nil
+		}
+	}
+
+	// The new blob is either a duplicate or could not be counted, and is not used either way.
+	if err := db.deleteContent(ctx, content.FileID); err != nil {
+		logrus.WithError(err).Error("Error deleting unused content")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	existing.Size = content.Size
+	existing.ContentType = content.ContentType
+	return existing, nil
+}
+
+func (db *Handler) writeContent(ctx context.Context, name string, source io.Reader) (*storedContent, error) {
+	hash := sha256.New()
+	blob, err := db.BlobStore.Put(ctx, name, io.TeeReader(source, hash))
+	if err != nil {
+		return nil, err
+	}
+
+	return &storedContent{
+		FileID: blob.ID,
+		Size:   blob.Size,
+		Hash:   hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// findContent takes a reference to a stored blob with the given content hash, returning nil if none is
+// still referenced. Blobs stored before reference counts were kept are not reused.
+func (db *Handler) findContent(ctx context.Context, hash string) (*storedContent, error) {
+	ref, err := db.contentRefs().acquire(ctx, hash)
+	if err != nil || ref == nil {
+		return nil, err
+	}
+
+	// Only reuse the blob if the store still has it, so content lost from the store out from under the
+	// metadata is written again rather than referenced by yet another file.
+	if _, err := db.BlobStore.Stat(ctx, ref.BlobID); err != nil {
+		if err == ErrBlobNotFound {
+			if err := db.contentRefs().markLost(ctx, ref.BlobID); err != nil {
+				return nil, err
+			}
+		}
+		if err := db.releaseContent(ctx, ref.BlobID); err != nil {
+			logrus.WithError(err).Error("Error releasing file content")
+		}
+		if err == ErrBlobNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &storedContent{FileID: ref.BlobID, Hash: hash}, nil
+}
+
+func (db *Handler) openContent(ctx context.Context, contentID primitive.ObjectID) (FileStream, error) {
+	return db.BlobStore.Get(ctx, contentID)
+}
+
+// releaseContent drops a reference to a blob and deletes the blob along with its last one. Since
+// references are only ever taken while the count is above zero, nothing can pick up a blob again once it
+// is up for deletion. Blobs stored before reference counts were kept are deleted once no metadata
+// document references them; they are never reused, so no new references to them can appear meanwhile.
+func (db *Handler) releaseContent(ctx context.Context, blobID primitive.ObjectID) error {
+	ref, err := db.contentRefs().release(ctx, blobID)
+	if err != nil {
+		return err
+	} else if ref != nil && ref.Refs > 0 {
+		return nil
+	} else if ref == nil {
+		references, err := db.getFileCollection().CountDocuments(ctx, bson.M{"$or": bson.A{bson.M{"fileBytes": blobID}, bson.M{"versions.fileBytes": blobID}}})
+		if err != nil {
+			return err
+		} else if references > 0 {
+			return nil
+		}
+	}
+
+	if err := db.deleteContent(ctx, blobID); err != nil {
+		return err
+	}
+	return db.contentRefs().remove(ctx, blobID)
+}
+
+func (db *Handler) deleteContent(ctx context.Context, fileID primitive.ObjectID) error {
+	if err := db.BlobStore.Delete(ctx, fileID); err != nil && err != ErrBlobNotFound {
+		return err
+	}
+	return nil
+}
+
+// contentRef counts the revisions referencing a blob, each revision holding one reference.
+type contentRef struct {
+	BlobID primitive.ObjectID `bson:"_id"`
+	Hash   string             `bson:"hash"`
+	Refs   int64              `bson:"refs"`
+	Lost   bool               `bson:"lost,omitempty"`
+}
+
+// contentRefs keeps the reference counts of blobs. Every method is a single atomic update, which is what
+// makes concurrently storing and releasing the same content safe.
+type contentRefs interface {
+	// acquire adds a reference to a referenced blob with the given hash, returning nil if there is none.
+	acquire(ctx context.Context, hash string) (*contentRef, error)
+	// retain adds a reference to a referenced blob; blobs without a count are left alone.
+	retain(ctx context.Context, blobID primitive.ObjectID) error
+	create(ctx context.Context, ref *contentRef) error
+	// release drops a reference and returns the updated count, or nil if the blob has none.
+	release(ctx context.Context, blobID primitive.ObjectID) (*contentRef, error)
+	// remove deletes the count of a blob that is no longer referenced.
+	remove(ctx context.Context, blobID primitive.ObjectID) error
+	// markLost keeps a blob missing from the store from being acquired again.
+	markLost(ctx context.Context, blobID primitive.ObjectID) error
+}
+
+func (db *Handler) contentRefs() contentRefs {
+	if db.refs != nil {
+		return db.refs
+	}
+	return mongoContentRefs{collection: db.getContentCollection()}
+}
+
+func (db *Handler) getContentCollection() *mongo.Collection {
+	return db.Client.Database(db.Database).Collection(db.ContentCollection)
+}
+
+type mongoContentRefs struct {
+	collection *mongo.Collection
+}
+
+func (m mongoContentRefs) acquire(ctx context.Context, hash string) (*contentRef, error) {
+	result := m.collection.FindOneAndUpdate(ctx,
+		bson.M{"hash": hash, "refs": bson.M{"$gt": 0}, "lost": bson.M{"$ne": true}},
+		bson.M{"$inc": bson.M{"refs": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After))
+	return decodeContentRef(result)
+}
+
+func (m mongoContentRefs) retain(ctx context.Context, blobID primitive.ObjectID) error {
+	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": blobID, "refs": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"refs": 1}})
+	return err
+}
+
+func (m mongoContentRefs) create(ctx context.Context, ref *contentRef) error {
+	_, err := m.collection.InsertOne(ctx, ref)
+	return err
+}
+
+func (m mongoContentRefs) release(ctx context.Context, blobID primitive.ObjectID) (*contentRef, error) {
+	result := m.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": blobID},
+		bson.M{"$inc": bson.M{"refs": -1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After))
+	return decodeContentRef(result)
+}
+
+func (m mongoContentRefs) remove(ctx context.Context, blobID primitive.ObjectID) error {
+	_, err := m.collection.DeleteOne(ctx, bson.M{"_id": blobID, "refs": bson.M{"$lte": 0}})
+	return err
+}
+
+func (m mongoContentRefs) markLost(ctx context.Context, blobID primitive.ObjectID) error {
+	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": blobID}, bson.M{"$set": bson.M{"lost": true}})
+	return err
+}
+
+func decodeContentRef(result *mongo.SingleResult) (*contentRef, error) {
+	if result.Err() == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var ref contentRef
+	if err := result.Decode(&ref); err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
@@ -0,0 +1,178 @@
+package dao
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryContentRefs keeps reference counts in memory, applying each update atomically as Mongo does.
+type memoryContentRefs struct {
+	mu   sync.Mutex
+	refs map[primitive.ObjectID]contentRef
+}
+
+func (m *memoryContentRefs) acquire(ctx context.Context, hash string) (*contentRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, ref := range m.refs {
+		if ref.Hash == hash && ref.Refs > 0 && !ref.Lost {
+			ref.Refs++
+			m.refs[id] = ref
+			return &ref, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryContentRefs) retain(ctx context.Context, blobID primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ref, ok := m.refs[blobID]; ok && ref.Refs > 0 {
+		ref.Refs++
+		m.refs[blobID] = ref
+	}
+	return nil
+}
+
+func (m *memoryContentRefs) create(ctx context.Context, ref *contentRef) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refs[ref.BlobID] = *ref
+	return nil
+}
+
+func (m *memoryContentRefs) release(ctx context.Context, blobID primitive.ObjectID) (*contentRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ref, ok := m.refs[blobID]
+	if !ok {
+		return nil, nil
+	}
+	ref.Refs--
+	m.refs[blobID] = ref
+	return &ref, nil
+}
+
+func (m *memoryContentRefs) remove(ctx context.Context, blobID primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ref, ok := m.refs[blobID]; ok && ref.Refs <= 0 {
+		delete(m.refs, blobID)
+	}
+	return nil
+}
+
+func (m *memoryContentRefs) markLost(ctx context.Context, blobID primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ref, ok := m.refs[blobID]; ok {
+		ref.Lost = true
+		m.refs[blobID] = ref
+	}
+	return nil
+}
+
+func TestSniffBuffer_ShouldKeepOnlyTheLeadingBytes(t *testing.T) {
+	var head sniffBuffer
+	for i := 0; i < 3; i++ {
+		n, err := head.Write([]byte(strings.Repeat("a", mimeSniffLength/2)))
+		require.Nil(t, err)
+		require.Equal(t, mimeSniffLength/2, n)
+	}
+
+	require.Equal(t, mimeSniffLength, head.Len())
+}
+
+func TestSniffBuffer_ShouldDetectContentType(t *testing.T) {
+	var head sniffBuffer
+	_, err := head.Write([]byte("%PDF-1.4\n"))
+	require.Nil(t, err)
+
+	require.Equal(t, "application/pdf", head.contentType())
+}
+
+func TestHandler_StoreContent_ShouldNotReuseReleasedContent(t *testing.T) {
+	store := newTestLocalStore(t)
+	refs := &memoryContentRefs{refs: make(map[primitive.ObjectID]contentRef)}
+	db := &Handler{BlobStore: store, refs: refs}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(seekable bool) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				var source io.Reader = strings.NewReader("shared content")
+				if !seekable {
+					source = io.MultiReader(source)
+				}
+
+				content, err := db.storeContent(ctx, "test.txt", source)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				// The blob must stay readable for as long as the reference to it is held.
+				stream, err := store.Get(ctx, content.FileID)
+				if err != nil {
+					errs <- err
+					return
+				}
+				_, err = ioutil.ReadAll(stream)
+				stream.Close()
+				if err == nil {
+					err = db.releaseContent(ctx, content.FileID)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.Nil(t, err)
+	}
+
+	// With every reference released, neither blobs nor counts are left behind.
+	require.Empty(t, refs.refs)
+	err := filepath.Walk(store.Root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			t.Errorf("blob %v was not deleted", path)
+		}
+		return err
+	})
+	require.Nil(t, err)
+}
+
+func TestHandler_StoreContent_ShouldRewriteLostContent(t *testing.T) {
+	store := newTestLocalStore(t)
+	refs := &memoryContentRefs{refs: make(map[primitive.ObjectID]contentRef)}
+	db := &Handler{BlobStore: store, refs: refs}
+	ctx := context.Background()
+
+	first, err := db.storeContent(ctx, "test.txt", strings.NewReader("test content"))
+	require.Nil(t, err)
+	require.Nil(t, store.Delete(ctx, first.FileID))
+
+	second, err := db.storeContent(ctx, "test.txt", strings.NewReader("test content"))
+	require.Nil(t, err)
+	require.NotEqual(t, first.FileID, second.FileID)
+	require.True(t, refs.refs[first.FileID].Lost)
+	require.Equal(t, int64(1), refs.refs[first.FileID].Refs)
+	require.Equal(t, int64(1), refs.refs[second.FileID].Refs)
+}
@@ -0,0 +1,109 @@
+package dao
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"content-service-api/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetDerived looks up content derived from the revision of a file with the given hash.
+func (db *Handler) GetDerived(ctx context.Context, fileID primitive.ObjectID, sourceHash string, kind string, variant string) (*models.Derived, error) {
+	result := db.getDerivedCollection().FindOne(ctx, bson.M{
+		"fileId":     fileID,
+		"sourceHash": sourceHash,
+		"kind":       kind,
+		"variant":    variant,
+	})
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var derived models.Derived
+	if err := result.Decode(&derived); err != nil {
+		return nil, err
+	}
+
+	return &derived, nil
+}
+
+// OpenDerived opens the stored content of a derived record for reading.
+func (db *Handler) OpenDerived(ctx context.Context, derived *models.Derived) (FileStream, error) {
+	return db.BlobStore.Get(ctx, derived.BlobID)
+}
+
+// StoreDerived writes derived content to the blob store and records it. If the same content was stored
+// concurrently, the copy stored first wins: this one is discarded and derived is filled in from the other.
+func (db *Handler) StoreDerived(ctx context.Context, derived *models.Derived, source io.Reader) error {
+	blob, err := db.BlobStore.Put(ctx, derived.Kind, source)
+	if err != nil {
+		return err
+	}
+
+	derived.ID = primitive.NilObjectID
+	derived.BlobID = blob.ID
+	derived.Size = blob.Size
+	derived.Created = time.Now()
+
+	result, err := db.getDerivedCollection().InsertOne(ctx, derived)
+	if mongo.IsDuplicateKeyError(err) {
+		if err := db.BlobStore.Delete(ctx, blob.ID); err != nil {
+			logrus.WithError(err).Error("Error deleting duplicate derived content")
+		}
+
+		existing, err := db.GetDerived(ctx, derived.FileID, derived.SourceHash, derived.Kind, derived.Variant)
+		if err != nil {
+			return err
+		}
+		*derived = *existing
+		return nil
+	} else if err != nil {
+		if err := db.BlobStore.Delete(ctx, blob.ID); err != nil {
+			logrus.WithError(err).Error("Error deleting derived content")
+		}
+		return err
+	}
+
+	derived.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// DeleteDerived removes the content derived from a file, except for what was derived from the revision
+// with the hash keep. An empty keep removes everything.
+func (db *Handler) DeleteDerived(ctx context.Context, fileID primitive.ObjectID, keep string) error {
+	filter := bson.M{"fileId": fileID}
+	if keep != "" {
+		filter["sourceHash"] = bson.M{"$ne": keep}
+	}
+
+	cursor, err := db.getDerivedCollection().Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	var stale []models.Derived
+	if err := cursor.All(ctx, &stale); err != nil {
+		return err
+	}
+
+	for _, derived := range stale {
+		if err := db.BlobStore.Delete(ctx, derived.BlobID); err != nil && err != ErrBlobNotFound {
+			return err
+		}
+		if _, err := db.getDerivedCollection().DeleteOne(ctx, bson.M{"_id": derived.ID}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *Handler) getDerivedCollection() *mongo.Collection {
+	return db.Client.Database(db.Database).Collection(db.DerivedCollection)
+}
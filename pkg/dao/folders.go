@@ -0,0 +1,334 @@
+package dao
+
+import (
+	"context"
+	"errors"
+
+	"content-service-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrNameConflict   = errors.New("a file or folder with that name already exists in this folder")
+	ErrFolderNotEmpty = errors.New("folder is not empty")
+	ErrFolderCycle    = errors.New("a folder cannot be moved into itself or one of its subfolders")
+	ErrInvalidName    = errors.New("name cannot be empty, '.', '..' or contain '/'")
+)
+
+func (db *Handler) CreateFolder(ctx context.Context, folderRequest *models.FolderRequest) (*models.FolderResponse, error) {
+	if !validName(folderRequest.Name) {
+		return nil, ErrInvalidName
+	}
+
+	if folderRequest.Parent != nil {
+		if _, err := db.GetFolder(ctx, *folderRequest.Parent); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := db.checkNameAvailable(ctx, folderRequest.Parent, folderRequest.Owner, folderRequest.Name, primitive.NilObjectID); err != nil {
+		return nil, err
+	}
+
+	result, err := db.getFolderCollection().InsertOne(ctx, folderRequest)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrNameConflict
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &models.FolderResponse{
+		ID:        result.InsertedID.(primitive.ObjectID),
+		Name:      folderRequest.Name,
+		Parent:    folderRequest.Parent,
+		Timestamp: folderRequest.Timestamp,
+		Owner:     folderRequest.Owner,
+	}, nil
+}
+
+func (db *Handler) GetFolder(ctx context.Context, folderID primitive.ObjectID) (*models.FolderResponse, error) {
+	result := db.getFolderCollection().FindOne(ctx, map[string]interface{}{"_id": folderID})
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var folder models.FolderResponse
+	if err := result.Decode(&folder); err != nil {
+		return nil, err
+	}
+
+	return &folder, nil
+}
+
+func (db *Handler) RenameFolder(ctx context.Context, folderID primitive.ObjectID, name string) error {
+	if !validName(name) {
+		return ErrInvalidName
+	}
+
+	folder, err := db.GetFolder(ctx, folderID)
+	if err != nil {
+		return err
+	}
+
+	if err := db.checkNameAvailable(ctx, folder.Parent, folder.Owner, name, folderID); err != nil {
+		return err
+	}
+
+	_, err = db.getFolderCollection().UpdateOne(ctx, bson.M{"_id": folderID}, bson.M{"$set": bson.M{"name": name}})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrNameConflict
+	}
+	return err
+}
+
+// MoveFolder moves a folder under a new parent, or to the root when parent is nil.
+func (db *Handler) MoveFolder(ctx context.Context, folderID primitive.ObjectID, parent *primitive.ObjectID) error {
+	folder, err := db.GetFolder(ctx, folderID)
+	if err != nil {
+		return err
+	}
+
+	// Walk up from the destination to the root; finding the folder being moved on the way means the
+	// move would detach it from the tree.
+	for ancestor := parent; ancestor != nil; {
+		if *ancestor == folderID {
+			return ErrFolderCycle
+		}
+
+		next, err := db.GetFolder(ctx, *ancestor)
+		if err != nil {
+			return err
+		}
+		ancestor = next.Parent
+	}
+
+	if err := db.checkNameAvailable(ctx, parent, folder.Owner, folder.Name, folderID); err != nil {
+		return err
+	}
+
+	_, err = db.getFolderCollection().UpdateOne(ctx, bson.M{"_id": folderID}, bson.M{"$set": bson.M{"parent": parent}})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrNameConflict
+	}
+	return err
+}
+
+// DeleteFolder deletes an empty folder. When recursive is set, its files and subfolders are deleted first.
+func (db *Handler) DeleteFolder(ctx context.Context, folderID primitive.ObjectID, recursive bool) error {
+	contents, err := db.GetFolderContents(ctx, &folderID)
+	if err != nil {
+		return err
+	}
+
+	if len(contents.Files) > 0 || len(contents.Folders) > 0 {
+		if !recursive {
+			return ErrFolderNotEmpty
+		}
+
+		for _, file := range contents.Files {
+			if err := db.DeleteFile(ctx, file.ID); err != nil {
+				return err
+			}
+		}
+
+		for _, folder := range contents.Folders {
+			if err := db.DeleteFolder(ctx, folder.ID, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = db.getFolderCollection().DeleteOne(ctx, bson.M{"_id": folderID})
+	return err
+}
+
+// MoveFile moves a file into a folder, or to the root when parent is nil.
+func (db *Handler) MoveFile(ctx context.Context, fileID primitive.ObjectID, parent *primitive.ObjectID) error {
+	fileRequest, err := db.getFileRequest(ctx, fileID)
+	if err != nil {
+		return err
+	}
+
+	if parent != nil {
+		if _, err := db.GetFolder(ctx, *parent); err != nil {
+			return err
+		}
+	}
+
+	if err := db.checkNameAvailable(ctx, parent, fileRequest.Owner, fileRequest.Name, fileID); err != nil {
+		return err
+	}
+
+	_, err = db.getFileCollection().UpdateOne(ctx, bson.M{"_id": fileID}, bson.M{"$set": bson.M{"parent": parent}})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrNameConflict
+	}
+	return err
+}
+
+// GetFolderContents lists the direct children of a folder, or of the root when folderID is nil.
+func (db *Handler) GetFolderContents(ctx context.Context, folderID *primitive.ObjectID) (*models.FolderContents, error) {
+	contents := models.FolderContents{
+		Folders: []models.FolderResponse{},
+		Files:   []models.FileResponse{},
+	}
+
+	if folderID != nil {
+		folder, err := db.GetFolder(ctx, *folderID)
+		if err != nil {
+			return nil, err
+		}
+		contents.Folder = folder
+	}
+
+	sort := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	cursor, err := db.getFolderCollection().Find(ctx, bson.M{"parent": folderID}, sort)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &contents.Folders); err != nil {
+		return nil, err
+	}
+
+	cursor, err = db.getFileCollection().Find(ctx, bson.M{"parent": folderID}, sort)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &contents.Files); err != nil {
+		return nil, err
+	}
+
+	return &contents, nil
+}
+
+// GetFolderByPath resolves a sequence of folder names starting at the root. An empty path is the root
+// itself, for which nil is returned. Names are only unique per owner, so where several folders share a
+// name the one owned by owner is preferred.
+func (db *Handler) GetFolderByPath(ctx context.Context, path []string, owner string) (*models.FolderResponse, error) {
+	var folder *models.FolderResponse
+	var parent *primitive.ObjectID
+	for _, name := range path {
+		folder = &models.FolderResponse{}
+		if err := findByName(ctx, db.getFolderCollection(), bson.M{"parent": parent, "name": name}, owner, folder); err != nil {
+			return nil, err
+		}
+		parent = &folder.ID
+	}
+
+	return folder, nil
+}
+
+// GetFileByPath resolves a path whose last element names a file and the preceding elements its folders.
+// Only files matching query are considered, and as with folders the ones owned by owner are preferred.
+func (db *Handler) GetFileByPath(ctx context.Context, path []string, owner string, query map[string]interface{}) (*models.FileResponse, error) {
+	if len(path) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	folder, err := db.GetFolderByPath(ctx, path[:len(path)-1], owner)
+	if err != nil {
+		return nil, err
+	}
+
+	var parent *primitive.ObjectID
+	if folder != nil {
+		parent = &folder.ID
+	}
+
+	filter := bson.M{}
+	for key, val := range query {
+		filter[key] = val
+	}
+	filter["parent"] = parent
+	filter["name"] = path[len(path)-1]
+
+	var file models.FileResponse
+	if err := findByName(ctx, db.getFileCollection(), filter, owner, &file); err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+// findByName decodes into result the document matching filter that is owned by owner, or failing that
+// one without an owner, or failing that the oldest.
+func findByName(ctx context.Context, collection *mongo.Collection, filter bson.M, owner string, result interface{}) error {
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+
+	var candidates []bson.Raw
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return err
+	} else if len(candidates) == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	best, bestRank := candidates[0], ownerRank(candidates[0], owner)
+	for _, candidate := range candidates[1:] {
+		if rank := ownerRank(candidate, owner); rank < bestRank {
+			best, bestRank = candidate, rank
+		}
+	}
+
+	return bson.Unmarshal(best, result)
+}
+
+func ownerRank(document bson.Raw, owner string) int {
+	documentOwner, _ := document.Lookup("owner").StringValueOK()
+	switch {
+	case owner != "" && documentOwner == owner:
+		return 0
+	case documentOwner == "":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// checkNameAvailable returns ErrNameConflict if a file or folder of owner other than exclude already uses
+// name within parent. Names are unique per owner, so that one user's files, which others may not be able
+// to see, never stop another from choosing a name. Unique indexes back this up against concurrent
+// requests, except for files without an owner: those predating folders may share names, so theirs is
+// enforced here only.
+func (db *Handler) checkNameAvailable(ctx context.Context, parent *primitive.ObjectID, owner string, name string, exclude primitive.ObjectID) error {
+	filter := bson.M{"parent": parent, "owner": ownerScope(owner), "name": name, "_id": bson.M{"$ne": exclude}}
+
+	for _, collection := range []*mongo.Collection{db.getFolderCollection(), db.getFileCollection()} {
+		count, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		} else if count > 0 {
+			return ErrNameConflict
+		}
+	}
+
+	return nil
+}
+
+// ownerScope matches the owner field of documents owned by owner. Documents stored before ownership was
+// recorded may lack the field altogether, and share one scope with those whose owner is empty.
+func ownerScope(owner string) interface{} {
+	if owner == "" {
+		return bson.M{"$in": bson.A{nil, ""}}
+	}
+	return owner
+}
+
+func validName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	for _, c := range name {
+		if c == '/' {
+			return false
+		}
+	}
+	return true
+}
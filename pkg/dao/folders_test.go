@@ -0,0 +1,27 @@
+package dao
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestOwnerRank_ShouldPreferOwnItemsThenUnownedOnes(t *testing.T) {
+	document := func(fields bson.M) bson.Raw {
+		raw, err := bson.Marshal(fields)
+		require.Nil(t, err)
+		return raw
+	}
+
+	require.Equal(t, 0, ownerRank(document(bson.M{"owner": "test"}), "test"))
+	require.Equal(t, 1, ownerRank(document(bson.M{"owner": ""}), "test"))
+	require.Equal(t, 1, ownerRank(document(bson.M{"name": "legacy"}), "test"))
+	require.Equal(t, 2, ownerRank(document(bson.M{"owner": "other"}), "test"))
+	require.Equal(t, 1, ownerRank(document(bson.M{"owner": ""}), ""))
+}
+
+func TestOwnerScope_ShouldMatchMissingOwnersWithEmptyOnes(t *testing.T) {
+	require.Equal(t, "test", ownerScope("test"))
+	require.Equal(t, bson.M{"$in": bson.A{nil, ""}}, ownerScope(""))
+}
@@ -0,0 +1,145 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultBucketName = "fs"
+
+// GridFSStore keeps blobs in a GridFS bucket of the database. The bucket's files and chunks are read
+// directly through FsCollection and ChunkCollection, and written through the driver's bucket of the
+// same name, so the two must be the <bucket>.files and <bucket>.chunks collections of one bucket.
+type GridFSStore struct {
+	Client          *mongo.Client
+	Database        string
+	FsCollection    string
+	ChunkCollection string
+}
+
+// NewGridFSStore returns a store for the bucket the given collections belong to. Without collection
+// names it uses the default "fs" bucket.
+func NewGridFSStore(client *mongo.Client, database string, fsCollection string, chunkCollection string) (*GridFSStore, error) {
+	if fsCollection == "" && chunkCollection == "" {
+		fsCollection, chunkCollection = defaultBucketName+".files", defaultBucketName+".chunks"
+	}
+
+	bucket := strings.TrimSuffix(fsCollection, ".files")
+	if bucket == "" || bucket == fsCollection || chunkCollection != bucket+".chunks" {
+		return nil, fmt.Errorf("collections '%v' and '%v' are not the files and chunks of one GridFS bucket", fsCollection, chunkCollection)
+	}
+
+	return &GridFSStore{
+		Client:          client,
+		Database:        database,
+		FsCollection:    fsCollection,
+		ChunkCollection: chunkCollection,
+	}, nil
+}
+
+func (g *GridFSStore) Put(ctx context.Context, name string, source io.Reader) (*BlobInfo, error) {
+	bucket, err := g.bucket()
+	if err != nil {
+		return nil, err
+	}
+
+	uploadStream, err := bucket.OpenUploadStream(name)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := io.Copy(uploadStream, source)
+	if err != nil {
+		if err := uploadStream.Abort(); err != nil {
+			logrus.WithError(err).Error("Error aborting upload stream")
+		}
+		return nil, err
+	}
+
+	// Closing the stream flushes the final chunk and writes the GridFS file document, so it has to
+	// happen before any metadata document points at it.
+	if err := uploadStream.Close(); err != nil {
+		return nil, err
+	}
+
+	return &BlobInfo{ID: uploadStream.FileID.(primitive.ObjectID), Size: size}, nil
+}
+
+func (g *GridFSStore) Get(ctx context.Context, blobID primitive.ObjectID) (FileStream, error) {
+	file, err := g.findFile(ctx, blobID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newChunkReader(ctx, g.findChunks, *file), nil
+}
+
+func (g *GridFSStore) Delete(ctx context.Context, blobID primitive.ObjectID) error {
+	bucket, err := g.bucket()
+	if err != nil {
+		return err
+	}
+
+	if err := bucket.Delete(blobID); err == gridfs.ErrFileNotFound {
+		return ErrBlobNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (g *GridFSStore) Stat(ctx context.Context, blobID primitive.ObjectID) (*BlobInfo, error) {
+	file, err := g.findFile(ctx, blobID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlobInfo{ID: file.ID, Size: file.Length}, nil
+}
+
+func (g *GridFSStore) findFile(ctx context.Context, blobID primitive.ObjectID) (*gridFile, error) {
+	result := g.getFsCollection().FindOne(ctx, map[string]interface{}{"_id": blobID})
+	if result.Err() == mongo.ErrNoDocuments {
+		return nil, ErrBlobNotFound
+	} else if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var file gridFile
+	if err := result.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+// findChunks opens a cursor over the chunks of a file in order, starting at chunk n.
+func (g *GridFSStore) findChunks(ctx context.Context, fileID primitive.ObjectID, n int64) (chunkCursor, error) {
+	return g.getChunkCollection().Find(
+		ctx,
+		map[string]interface{}{"files_id": fileID, "n": map[string]interface{}{"$gte": n}},
+		options.Find().SetSort(map[string]interface{}{"n": 1}),
+	)
+}
+
+func (g *GridFSStore) bucket() (*gridfs.Bucket, error) {
+	name := strings.TrimSuffix(g.FsCollection, ".files")
+	return gridfs.NewBucket(g.Client.Database(g.Database), options.GridFSBucket().SetName(name))
+}
+
+func (g *GridFSStore) getFsCollection() *mongo.Collection {
+	return g.Client.Database(g.Database).Collection(g.FsCollection)
+}
+
+func (g *GridFSStore) getChunkCollection() *mongo.Collection {
+	return g.Client.Database(g.Database).Collection(g.ChunkCollection)
+}
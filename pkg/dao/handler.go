@@ -1,9 +1,11 @@
 package dao
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"io"
 
 	"content-service-api/models"
 
@@ -11,89 +13,202 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
+// indexNotFoundCode is the code of the error Mongo returns when dropping an index that does not exist.
+const indexNotFoundCode = 27
+
 type DBHandler interface {
 	Ping(ctx context.Context) error
-	GetFile(ctx context.Context, fileID primitive.ObjectID) ([]byte, error)
-	UploadFile(ctx context.Context, uploadRequest *models.FileRequest, fileBytes []byte) error
+	GetFileInfo(ctx context.Context, fileID primitive.ObjectID) (*models.FileResponse, error)
+	OpenFile(ctx context.Context, fileID primitive.ObjectID) (FileStream, error)
+	UploadFile(ctx context.Context, uploadRequest *models.FileRequest, source io.Reader) (*models.FileResponse, error)
 	DeleteFile(ctx context.Context, fileID primitive.ObjectID) error
 	UpdateFileInfo(ctx context.Context, fileID primitive.ObjectID, updateRequest map[string]interface{}) error
-	GetFiles(ctx context.Context, query map[string]interface{}) ([]models.FileResponse, error)
+	GetFiles(ctx context.Context, query map[string]interface{}, listOptions *models.ListOptions) (*models.FilePage, error)
+	GetFileVersions(ctx context.Context, fileID primitive.ObjectID) ([]models.FileVersion, error)
+	GetFileVersion(ctx context.Context, fileID primitive.ObjectID, version int) (*models.FileVersion, error)
+	OpenFileVersion(ctx context.Context, fileID primitive.ObjectID, version int) (FileStream, error)
+	UploadFileVersion(ctx context.Context, fileID primitive.ObjectID, versionRequest *models.FileVersion, source io.Reader) error
+	RestoreFileVersion(ctx context.Context, fileID primitive.ObjectID, version int) (*models.FileVersion, error)
+	CreateFolder(ctx context.Context, folderRequest *models.FolderRequest) (*models.FolderResponse, error)
+	GetFolder(ctx context.Context, folderID primitive.ObjectID) (*models.FolderResponse, error)
+	RenameFolder(ctx context.Context, folderID primitive.ObjectID, name string) error
+	MoveFolder(ctx context.Context, folderID primitive.ObjectID, parent *primitive.ObjectID) error
+	DeleteFolder(ctx context.Context, folderID primitive.ObjectID, recursive bool) error
+	MoveFile(ctx context.Context, fileID primitive.ObjectID, parent *primitive.ObjectID) error
+	GetFolderContents(ctx context.Context, folderID *primitive.ObjectID) (*models.FolderContents, error)
+	GetFolderByPath(ctx context.Context, path []string, owner string) (*models.FolderResponse, error)
+	GetFileByPath(ctx context.Context, path []string, owner string, query map[string]interface{}) (*models.FileResponse, error)
+	CreateShare(ctx context.Context, share *models.Share) error
+	GetShare(ctx context.Context, shareID primitive.ObjectID) (*models.Share, error)
+	GetShares(ctx context.Context, fileID primitive.ObjectID) ([]models.Share, error)
+	ClaimShareDownload(ctx context.Context, shareID primitive.ObjectID) (*models.Share, error)
+	DeleteShare(ctx context.Context, fileID primitive.ObjectID, shareID primitive.ObjectID) error
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	UseAPIKey(ctx context.Context, hash string) (*models.APIKey, error)
+	DeleteAPIKey(ctx context.Context, keyID primitive.ObjectID) error
+	CreateUpload(ctx context.Context, upload *models.Upload) error
+	GetUpload(ctx context.Context, uploadID primitive.ObjectID) (*models.Upload, error)
+	AppendUpload(ctx context.Context, uploadID primitive.ObjectID, offset int64, source io.Reader) (*models.Upload, error)
+	CompleteUpload(ctx context.Context, uploadID primitive.ObjectID) (*models.Upload, error)
+	DeleteUpload(ctx context.Context, uploadID primitive.ObjectID) error
+	DeleteExpiredUploads(ctx context.Context) (int, error)
+	GetDerived(ctx context.Context, fileID primitive.ObjectID, sourceHash string, kind string, variant string) (*models.Derived, error)
+	OpenDerived(ctx context.Context, derived *models.Derived) (FileStream, error)
+	StoreDerived(ctx context.Context, derived *models.Derived, source io.Reader) error
+	DeleteDerived(ctx context.Context, fileID primitive.ObjectID, keep string) error
 }
 
 type Handler struct {
-	Client          *mongo.Client
-	Database        string
-	FileCollection  string
-	FsCollection    string
-	ChunkCollection string
+	Client            *mongo.Client
+	Database          string
+	FileCollection    string
+	FolderCollection  string
+	ShareCollection   string
+	APIKeyCollection  string
+	UploadCollection  string
+	DerivedCollection string
+	ContentCollection string
+	BlobStore         BlobStore
+
+	// refs replaces the reference counts kept in ContentCollection in tests.
+	refs contentRefs
 }
 
 func (db *Handler) Ping(ctx context.Context) error {
 	return db.Client.Ping(ctx, readpref.Primary())
 }
 
-func (db *Handler) GetFile(ctx context.Context, fileID primitive.ObjectID) ([]byte, error) {
+// GetFileInfo returns the metadata document for a file. Files stored before content hashes were
+// recorded have theirs computed from the stored chunks and saved on first access.
+func (db *Handler) GetFileInfo(ctx context.Context, fileID primitive.ObjectID) (*models.FileResponse, error) {
 	result := db.getFileCollection().FindOne(ctx, map[string]interface{}{"_id": fileID})
 	if result.Err() != nil {
 		return nil, result.Err()
 	}
 
-	var fileRequest models.FileRequest
-	if err := result.Decode(&fileRequest); err != nil {
+	var fileResponse models.FileResponse
+	if err := result.Decode(&fileResponse); err != nil {
 		return nil, err
 	}
 
-	bucket, err := gridfs.NewBucket(db.Client.Database(db.Database))
+	if fileResponse.Hash != "" {
+		return &fileResponse, nil
+	}
+
+	stream, err := db.OpenFile(ctx, fileID)
 	if err != nil {
 		return nil, err
 	}
 
-	var buf bytes.Buffer
-	_, err = bucket.DownloadToStream(fileRequest.FileID, &buf)
-	if err != nil {
+	defer func() {
+		if err := stream.Close(); err != nil {
+			logrus.WithError(err).Error("Error closing download stream")
+		}
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, stream); err != nil {
 		return nil, err
 	}
+	fileResponse.Hash = hex.EncodeToString(hash.Sum(nil))
 
-	return buf.Bytes(), nil
+	if err := db.UpdateFileInfo(ctx, fileID, map[string]interface{}{"hash": fileResponse.Hash}); err != nil {
+		return nil, err
+	}
+
+	return &fileResponse, nil
 }
 
-func (db *Handler) UploadFile(ctx context.Context, uploadRequest *models.FileRequest, fileBytes []byte) error {
-	bucket, err := gridfs.NewBucket(db.Client.Database(db.Database))
-	if err != nil {
-		return err
+func (db *Handler) OpenFile(ctx context.Context, fileID primitive.ObjectID) (FileStream, error) {
+	result := db.getFileCollection().FindOne(ctx, map[string]interface{}{"_id": fileID})
+	if result.Err() != nil {
+		return nil, result.Err()
 	}
 
-	uploadStream, err := bucket.OpenUploadStream(uploadRequest.Name)
-	if err != nil {
-		return err
+	var fileRequest models.FileRequest
+	if err := result.Decode(&fileRequest); err != nil {
+		return nil, err
 	}
 
-	defer func() {
-		if err := uploadStream.Close(); err != nil {
-			logrus.WithError(err).Error("Error closing upload stream")
+	return db.openContent(ctx, fileRequest.FileID)
+}
+
+// UploadFile stores source as a new file and returns the document that was inserted.
+func (db *Handler) UploadFile(ctx context.Context, uploadRequest *models.FileRequest, source io.Reader) (*models.FileResponse, error) {
+	if !validName(uploadRequest.Name) {
+		return nil, ErrInvalidName
+	}
+
+	if uploadRequest.Parent != nil {
+		if _, err := db.GetFolder(ctx, *uploadRequest.Parent); err != nil {
+			return nil, err
 		}
-	}()
+	}
 
-	_, err = uploadStream.Write(fileBytes)
+	if err := db.checkNameAvailable(ctx, uploadRequest.Parent, uploadRequest.Owner, uploadRequest.Name, primitive.NilObjectID); err != nil {
+		return nil, err
+	}
+
+	content, err := db.storeContent(ctx, uploadRequest.Name, source)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	uploadRequest.FileID = uploadStream.FileID.(primitive.ObjectID)
+	uploadRequest.FileID = content.FileID
+	uploadRequest.Size = content.Size
+	uploadRequest.Hash = content.Hash
+	uploadRequest.ContentType = content.ContentType
+	uploadRequest.Version = 1
+	uploadRequest.Versions = []models.FileVersion{{
+		Version:     uploadRequest.Version,
+		Name:        uploadRequest.Name,
+		Timestamp:   uploadRequest.Timestamp,
+		Extension:   uploadRequest.Extension,
+		Size:        uploadRequest.Size,
+		ContentType: uploadRequest.ContentType,
+		FileID:      uploadRequest.FileID,
+		Hash:        uploadRequest.Hash,
+	}}
 	results, err := db.getFileCollection().InsertOne(ctx, uploadRequest)
 	if err != nil {
-		return err
+		if err := db.releaseContent(ctx, content.FileID); err != nil {
+			logrus.WithError(err).Error("Error releasing file content")
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrNameConflict
+		}
+		return nil, err
 	} else if results.InsertedID == nil {
-		return errors.New("no file inserted")
+		return nil, errors.New("no file inserted")
 	}
 
-	return nil
+	return &models.FileResponse{
+		ID:          results.InsertedID.(primitive.ObjectID),
+		Name:        uploadRequest.Name,
+		Timestamp:   uploadRequest.Timestamp,
+		Extension:   uploadRequest.Extension,
+		Size:        uploadRequest.Size,
+		ContentType: uploadRequest.ContentType,
+		FileID:      uploadRequest.FileID,
+		Hash:        uploadRequest.Hash,
+		Hidden:      uploadRequest.Hidden,
+		Parent:      uploadRequest.Parent,
+		Tags:        uploadRequest.Tags,
+		Metadata:    uploadRequest.Metadata,
+		Owner:       uploadRequest.Owner,
+		Grants:      uploadRequest.Grants,
+		Version:     uploadRequest.Version,
+	}, nil
 }
 
+// DeleteFile removes a file's metadata document along with its version history. Blobs are shared between
+// all revisions with identical content, so each revision releases its reference and a blob is only
+// deleted along with the last.
 func (db *Handler) DeleteFile(ctx context.Context, fileID primitive.ObjectID) error {
 	result := db.getFileCollection().FindOneAndDelete(ctx, map[string]interface{}{"_id": fileID})
 	if result.Err() != nil {
@@ -107,19 +222,52 @@ func (db *Handler) DeleteFile(ctx context.Context, fileID primitive.ObjectID) er
 
 	logrus.Info(fileRequest)
 
-	bucket, err := gridfs.NewBucket(db.Client.Database(db.Database))
-	if err != nil {
+	if _, err := db.getShareCollection().DeleteMany(ctx, bson.M{"fileId": fileID}); err != nil {
 		return err
 	}
 
-	if err = bucket.Delete(fileRequest.FileID); err != nil {
+	if err := db.DeleteDerived(ctx, fileID, ""); err != nil {
 		return err
 	}
 
+	for _, version := range fileVersions(&fileRequest) {
+		if err := db.releaseContent(ctx, version.FileID); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (db *Handler) UpdateFileInfo(ctx context.Context, fileID primitive.ObjectID, updateRequest map[string]interface{}) error {
+	name, renamed := updateRequest["name"]
+	owner, transferred := updateRequest["owner"]
+	if renamed || transferred {
+		fileRequest, err := db.getFileRequest(ctx, fileID)
+		if err != nil {
+			return err
+		}
+
+		// Names are unique per owner, so a file handed to another user must not clash with theirs.
+		nameString, ownerString := fileRequest.Name, fileRequest.Owner
+		if renamed {
+			var ok bool
+			if nameString, ok = name.(string); !ok || !validName(nameString) {
+				return ErrInvalidName
+			}
+		}
+		if transferred {
+			var ok bool
+			if ownerString, ok = owner.(string); !ok {
+				return errors.New("owner must be a string")
+			}
+		}
+
+		if err := db.checkNameAvailable(ctx, fileRequest.Parent, ownerString, nameString, fileID); err != nil {
+			return err
+		}
+	}
+
 	updates := bson.M{}
 	for key, val := range updateRequest {
 		updates[key] = val
@@ -127,36 +275,180 @@ func (db *Handler) UpdateFileInfo(ctx context.Context, fileID primitive.ObjectID
 	updates = bson.M{"$set": updates}
 
 	result := db.getFileCollection().FindOneAndUpdate(ctx, map[string]interface{}{"_id": fileID}, updates)
-	if result.Err() != nil {
+	if mongo.IsDuplicateKeyError(result.Err()) {
+		return ErrNameConflict
+	} else if result.Err() != nil {
 		return result.Err()
 	}
 
 	return nil
 }
 
-func (db *Handler) GetFiles(ctx context.Context, query map[string]interface{}) ([]models.FileResponse, error) {
-	cursor, err := db.getFileCollection().Find(ctx, query)
+// GetFiles returns one page of the files matching query. Pages are ordered by listOptions.Sort with the
+// file ID breaking ties, and listOptions.Next continues from where a previous page left off.
+func (db *Handler) GetFiles(ctx context.Context, query map[string]interface{}, listOptions *models.ListOptions) (*models.FilePage, error) {
+	if listOptions == nil {
+		listOptions = &models.ListOptions{}
+	}
+
+	limit := listOptions.Limit
+	if limit <= 0 {
+		limit = models.DefaultPageSize
+	} else if limit > models.MaxPageSize {
+		limit = models.MaxPageSize
+	}
+
+	keys := sortKeys(listOptions.Sort)
+
+	filter := bson.M{}
+	for key, val := range query {
+		filter[key] = val
+	}
+
+	total, err := db.getFileCollection().CountDocuments(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
 
-	var results []models.FileResponse
-	err = cursor.All(ctx, &results)
+	if listOptions.Next != "" {
+		after, err := afterToken(listOptions.Next, keys)
+		if err != nil {
+			return nil, err
+		}
+		filter = bson.M{"$and": bson.A{filter, after}}
+	}
+
+	// One extra file is fetched to find out whether there is a next page.
+	findOptions := options.Find().SetSort(sortDocument(keys)).SetLimit(limit + 1)
+	if len(listOptions.Fields) > 0 {
+		findOptions.SetProjection(projection(listOptions.Fields, keys))
+	}
+
+	cursor, err := db.getFileCollection().Find(ctx, filter, findOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	return results, nil
+	defer func() {
+		if err := cursor.Close(ctx); err != nil {
+			logrus.WithError(err).Error("Error closing cursor")
+		}
+	}()
+
+	page := &models.FilePage{Files: []models.FileResponse{}, Total: total}
+	var last bson.Raw
+	for cursor.Next(ctx) {
+		if int64(len(page.Files)) == limit {
+			if page.Next, err = newPageToken(last, keys); err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		var file models.FileResponse
+		if err := cursor.Decode(&file); err != nil {
+			return nil, err
+		}
+		page.Files = append(page.Files, file)
+		last = append(bson.Raw(nil), cursor.Current...)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return page, nil
 }
 
-func (db *Handler) getFileCollection() *mongo.Collection {
-	return db.Client.Database(db.Database).Collection(db.FileCollection)
+// CreateIndexes creates the indexes the file, folder, share, API key, upload, derived content and content
+// reference collections' queries rely on.
+func (db *Handler) CreateIndexes(ctx context.Context) error {
+	_, err := db.getFileCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}},
+		{Keys: bson.D{{Key: "fileBytes", Value: 1}}},
+		{Keys: bson.D{{Key: "versions.hash", Value: 1}}},
+		{Keys: bson.D{{Key: "versions.fileBytes", Value: 1}}},
+		{Keys: bson.D{{Key: "parent", Value: 1}, {Key: "name", Value: 1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}}},
+		{Keys: bson.D{{Key: "timestamp", Value: 1}}},
+		{Keys: bson.D{{Key: "owner", Value: 1}}},
+		{Keys: bson.D{{Key: "grants", Value: 1}}},
+		// Files without an owner predate folders and may already share names, so only owned files are
+		// held to unique names.
+		{
+			Keys: bson.D{{Key: "parent", Value: 1}, {Key: "owner", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"owner": bson.M{"$gt": ""}}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Folder names used to be unique within their parent, and are now unique per owner.
+	_, err = db.getFolderCollection().Indexes().DropOne(ctx, "parent_1_name_1")
+	if cmdErr, ok := err.(mongo.CommandError); err != nil && !(ok && cmdErr.Code == indexNotFoundCode) {
+		return err
+	}
+
+	_, err = db.getFolderCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "parent", Value: 1}, {Key: "owner", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Expired shares can never be used again, so Mongo is left to remove them.
+	_, err = db.getShareCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "fileId", Value: 1}}},
+		{Keys: bson.D{{Key: "expires", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.getAPIKeyCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Unlike shares, expired uploads are not left to a TTL index, since their chunks have to be deleted
+	// from the blob store along with them.
+	_, err = db.getUploadCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "expires", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The unique index lets concurrent requests deriving the same content find out which one stored it.
+	_, err = db.getDerivedCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "fileId", Value: 1},
+			{Key: "sourceHash", Value: 1},
+			{Key: "kind", Value: 1},
+			{Key: "variant", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.getContentCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "hash", Value: 1}},
+	})
+	return err
 }
 
-func (db *Handler) getFsCollection() *mongo.Collection {
-	return db.Client.Database(db.Database).Collection(db.FsCollection)
+func (db *Handler) getFileCollection() *mongo.Collection {
+	return db.Client.Database(db.Database).Collection(db.FileCollection)
 }
 
-func (db *Handler) getChunkCollection() *mongo.Collection {
-	return db.Client.Database(db.Database).Collection(db.ChunkCollection)
+func (db *Handler) getFolderCollection() *mongo.Collection {
+	return db.Client.Database(db.Database).Collection(db.FolderCollection)
 }
@@ -0,0 +1,99 @@
+package dao
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LocalStore keeps blobs as files in a directory on local disk, for development and deployments small
+// enough to run on a single node. Blobs are spread over subdirectories named after the last two
+// characters of their ID, which come from its counter, so that no one directory grows too large.
+type LocalStore struct {
+	Root string
+}
+
+// NewLocalStore returns a LocalStore rooted at root, creating the directory if it does not exist.
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0750); err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{Root: root}, nil
+}
+
+// Put writes the blob to a temporary file first and only renames it into place once it is complete,
+// so a failed or interrupted upload never leaves a partial blob behind under a valid ID.
+func (l *LocalStore) Put(ctx context.Context, name string, source io.Reader) (*BlobInfo, error) {
+	blobID := primitive.NewObjectID()
+	path := l.path(blobID)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".upload-")
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := io.Copy(tmp, source)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+		if err := os.Remove(tmp.Name()); err != nil {
+			logrus.WithError(err).Error("Error removing temporary file")
+		}
+		return nil, err
+	}
+
+	return &BlobInfo{ID: blobID, Size: size}, nil
+}
+
+func (l *LocalStore) Get(ctx context.Context, blobID primitive.ObjectID) (FileStream, error) {
+	file, err := os.Open(l.path(blobID))
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (l *LocalStore) Delete(ctx context.Context, blobID primitive.ObjectID) error {
+	err := os.Remove(l.path(blobID))
+	if os.IsNotExist(err) {
+		return ErrBlobNotFound
+	}
+	return err
+}
+
+func (l *LocalStore) Stat(ctx context.Context, blobID primitive.ObjectID) (*BlobInfo, error) {
+	info, err := os.Stat(l.path(blobID))
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &BlobInfo{ID: blobID, Size: info.Size()}, nil
+}
+
+func (l *LocalStore) path(blobID primitive.ObjectID) string {
+	hex := blobID.Hex()
+	return filepath.Join(l.Root, hex[len(hex)-2:], hex)
+}
@@ -0,0 +1,61 @@
+package dao
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestLocalStore(t *testing.T) *LocalStore {
+	root, err := ioutil.TempDir("", "local-store-")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	store, err := NewLocalStore(root)
+	require.Nil(t, err)
+	return store
+}
+
+func TestLocalStore_ShouldRoundTripBlobs(t *testing.T) {
+	store := newTestLocalStore(t)
+	ctx := context.Background()
+
+	blob, err := store.Put(ctx, "test.txt", strings.NewReader("test content"))
+	require.Nil(t, err)
+	require.Equal(t, int64(12), blob.Size)
+
+	info, err := store.Stat(ctx, blob.ID)
+	require.Nil(t, err)
+	require.Equal(t, blob, info)
+
+	stream, err := store.Get(ctx, blob.ID)
+	require.Nil(t, err)
+	_, err = stream.Seek(5, 0)
+	require.Nil(t, err)
+	content, err := ioutil.ReadAll(stream)
+	require.Nil(t, err)
+	require.Nil(t, stream.Close())
+	require.Equal(t, "content", string(content))
+
+	require.Nil(t, store.Delete(ctx, blob.ID))
+	_, err = store.Get(ctx, blob.ID)
+	require.Equal(t, ErrBlobNotFound, err)
+}
+
+func TestLocalStore_ShouldReturnErrBlobNotFoundForUnknownBlobs(t *testing.T) {
+	store := newTestLocalStore(t)
+	ctx := context.Background()
+
+	_, err := store.Get(ctx, primitive.NewObjectID())
+	require.Equal(t, ErrBlobNotFound, err)
+
+	_, err = store.Stat(ctx, primitive.NewObjectID())
+	require.Equal(t, ErrBlobNotFound, err)
+
+	require.Equal(t, ErrBlobNotFound, store.Delete(ctx, primitive.NewObjectID()))
+}
@@ -0,0 +1,160 @@
+package dao
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"content-service-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// sortKeyTypes lists the BSON types a page token may hold for each sort key. Tokens come back from
+// clients, so their values are checked against these before being used in a filter: anything else,
+// in particular an embedded document, could otherwise be run by Mongo as a query operator. Null stands
+// for files that lack the field.
+var sortKeyTypes = map[string][]bsontype.Type{
+	"id":        {bsontype.ObjectID},
+	"name":      {bsontype.String, bsontype.Null},
+	"extension": {bsontype.String, bsontype.Null},
+	"size":      {bsontype.Int64, bsontype.Int32, bsontype.Double, bsontype.Null},
+	"timestamp": {bsontype.DateTime, bsontype.Null},
+}
+
+// pageToken is the decoded form of the opaque token handed out for the next page. It holds the sort
+// order it was issued for along with the sort key values of the last file on the previous page.
+type pageToken struct {
+	Sort   string          `bson:"s"`
+	Values []bson.RawValue `bson:"v"`
+}
+
+// sortKeys returns the requested order with the file ID appended as a tie-breaker, so that the order
+// is total and every file lands on exactly one page.
+func sortKeys(fields []models.SortField) []models.SortField {
+	keys := make([]models.SortField, 0, len(fields)+1)
+	for _, field := range fields {
+		keys = append(keys, field)
+		if field.Field == "id" {
+			return keys
+		}
+	}
+	return append(keys, models.SortField{Field: "id"})
+}
+
+func sortDocument(keys []models.SortField) bson.D {
+	document := bson.D{}
+	for _, key := range keys {
+		direction := 1
+		if key.Descending {
+			direction = -1
+		}
+		document = append(document, bson.E{Key: fieldPath(key.Field), Value: direction})
+	}
+	return document
+}
+
+func sortSpec(keys []models.SortField) string {
+	spec := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key.Descending {
+			spec = append(spec, "-"+key.Field)
+		} else {
+			spec = append(spec, key.Field)
+		}
+	}
+	return strings.Join(spec, ",")
+}
+
+// projection includes the sort keys alongside the requested fields, since the next page token is
+// built from them.
+func projection(fields []string, keys []models.SortField) bson.M {
+	document := bson.M{}
+	for _, field := range fields {
+		document[fieldPath(field)] = 1
+	}
+	for _, key := range keys {
+		document[fieldPath(key.Field)] = 1
+	}
+	return document
+}
+
+// afterToken decodes a page token into a filter matching the files that sort after the position it
+// records: those with a greater first key, or an equal first key and a greater second key, and so on.
+func afterToken(token string, keys []models.SortField) (bson.M, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	var decoded pageToken
+	if err := bson.Unmarshal(raw, &decoded); err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	if decoded.Sort != sortSpec(keys) || len(decoded.Values) != len(keys) {
+		return nil, ErrInvalidPageToken
+	}
+
+	for i, key := range keys {
+		if !validSortValue(key.Field, decoded.Values[i]) {
+			return nil, ErrInvalidPageToken
+		}
+	}
+
+	clauses := bson.A{}
+	for i, key := range keys {
+		clause := bson.M{}
+		for j := 0; j < i; j++ {
+			clause[fieldPath(keys[j].Field)] = decoded.Values[j]
+		}
+
+		operator := "$gt"
+		if key.Descending {
+			operator = "$lt"
+		}
+		clause[fieldPath(key.Field)] = bson.M{operator: decoded.Values[i]}
+
+		clauses = append(clauses, clause)
+	}
+
+	return bson.M{"$or": clauses}, nil
+}
+
+func validSortValue(field string, value bson.RawValue) bool {
+	for _, valueType := range sortKeyTypes[field] {
+		if value.Type == valueType {
+			return value.Validate() == nil
+		}
+	}
+	return false
+}
+
+func newPageToken(last bson.Raw, keys []models.SortField) (string, error) {
+	token := pageToken{Sort: sortSpec(keys)}
+	for _, key := range keys {
+		value, err := last.LookupErr(fieldPath(key.Field))
+		if err != nil {
+			value = bson.RawValue{Type: bsontype.Null}
+		}
+		token.Values = append(token.Values, value)
+	}
+
+	raw, err := bson.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// fieldPath maps a response field name to its path in the file collection. The two only differ for the ID.
+func fieldPath(field string) string {
+	if field == "id" {
+		return "_id"
+	}
+	return field
+}
@@ -0,0 +1,54 @@
+package dao
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"content-service-api/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestPageToken(t *testing.T, sort string, values ...interface{}) string {
+	token := bson.M{"s": sort, "v": values}
+	raw, err := bson.Marshal(token)
+	require.Nil(t, err)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func TestPageToken_ShouldRoundTripLastFile(t *testing.T) {
+	keys := sortKeys([]models.SortField{{Field: "name"}, {Field: "timestamp", Descending: true}})
+	last, err := bson.Marshal(bson.M{"_id": primitive.NewObjectID(), "name": "a.txt", "timestamp": time.Now()})
+	require.Nil(t, err)
+
+	token, err := newPageToken(last, keys)
+	require.Nil(t, err)
+
+	filter, err := afterToken(token, keys)
+	require.Nil(t, err)
+	require.Len(t, filter["$or"], 3)
+}
+
+func TestPageToken_ShouldRejectValuesOfTheWrongType(t *testing.T) {
+	keys := sortKeys([]models.SortField{{Field: "name"}})
+	id := primitive.NewObjectID()
+
+	_, err := afterToken(newTestPageToken(t, "name,id", "a.txt", id), keys)
+	require.Nil(t, err)
+
+	tokens := []string{
+		newTestPageToken(t, "name,id", bson.M{"$where": "sleep(1000)"}, id),
+		newTestPageToken(t, "name,id", bson.M{"$regex": "^(a+)+$"}, id),
+		newTestPageToken(t, "name,id", bson.A{"a"}, id),
+		newTestPageToken(t, "name,id", 1, id),
+		newTestPageToken(t, "name,id", "a.txt", "not an id"),
+		newTestPageToken(t, "name,id", "a.txt", nil),
+	}
+	for _, token := range tokens {
+		_, err := afterToken(token, keys)
+		require.Equal(t, ErrInvalidPageToken, err)
+	}
+}
@@ -0,0 +1,219 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// s3PartSize is the size of the parts large blobs are uploaded in. Anything smaller is uploaded in a
+// single request.
+const s3PartSize = 8 << 20
+
+// S3Config describes how to reach an S3 compatible object store. Endpoint and the credentials may be
+// left empty to use AWS itself with the default credential chain; MinIO and most other S3 compatible
+// stores need PathStyle set.
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool
+}
+
+// S3Store keeps blobs as objects in an S3 compatible bucket, keyed by their ID under an optional prefix.
+type S3Store struct {
+	Client   s3iface.S3API
+	Uploader *s3manager.Uploader
+	Bucket   string
+	Prefix   string
+}
+
+func NewS3Store(config S3Config) (*S3Store, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("no bucket configured")
+	}
+
+	awsConfig := aws.NewConfig().WithRegion(config.Region).WithS3ForcePathStyle(config.PathStyle)
+	if config.Endpoint != "" {
+		awsConfig = awsConfig.WithEndpoint(config.Endpoint)
+	}
+	if config.AccessKeyID != "" {
+		awsConfig = awsConfig.WithCredentials(credentials.NewStaticCredentials(config.AccessKeyID, config.SecretAccessKey, ""))
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.New(sess)
+	return &S3Store{
+		Client: client,
+		Uploader: s3manager.NewUploaderWithClient(client, func(uploader *s3manager.Uploader) {
+			uploader.PartSize = s3PartSize
+		}),
+		Bucket: config.Bucket,
+		Prefix: config.Prefix,
+	}, nil
+}
+
+// Put streams source into the bucket, switching to a multipart upload once it exceeds a single part.
+// A failed multipart upload is aborted so its parts don't linger in the bucket.
+func (s *S3Store) Put(ctx context.Context, name string, source io.Reader) (*BlobInfo, error) {
+	blobID := primitive.NewObjectID()
+	counter := &countingReader{reader: source}
+
+	_, err := s.Uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.key(blobID)),
+		Body:   counter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlobInfo{ID: blobID, Size: counter.count}, nil
+}
+
+func (s *S3Store) Get(ctx context.Context, blobID primitive.ObjectID) (FileStream, error) {
+	info, err := s.Stat(ctx, blobID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &objectReader{ctx: ctx, store: s, key: s.key(blobID), size: info.Size}, nil
+}
+
+// Delete removes the object. S3 reports success for keys that don't exist, so unlike the other stores
+// it never returns ErrBlobNotFound.
+func (s *S3Store) Delete(ctx context.Context, blobID primitive.ObjectID) error {
+	_, err := s.Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.key(blobID)),
+	})
+	return err
+}
+
+func (s *S3Store) Stat(ctx context.Context, blobID primitive.ObjectID) (*BlobInfo, error) {
+	head, err := s.Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.key(blobID)),
+	})
+	if isS3NotFound(err) {
+		return nil, ErrBlobNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &BlobInfo{ID: blobID, Size: aws.Int64Value(head.ContentLength)}, nil
+}
+
+func (s *S3Store) key(blobID primitive.ObjectID) string {
+	return s.Prefix + blobID.Hex()
+}
+
+func isS3NotFound(err error) bool {
+	var requestFailure awserr.RequestFailure
+	return errors.As(err, &requestFailure) && requestFailure.StatusCode() == http.StatusNotFound
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// objectReader reads an S3 object through a single streaming GET. Seeking drops the current response,
+// and the next read requests the rest of the object starting at the new offset.
+type objectReader struct {
+	ctx    context.Context
+	store  *S3Store
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (o *objectReader) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+
+	if o.body == nil {
+		object, err := o.store.Client.GetObjectWithContext(o.ctx, &s3.GetObjectInput{
+			Bucket: aws.String(o.store.Bucket),
+			Key:    aws.String(o.key),
+			Range:  aws.String(fmt.Sprintf("bytes=%v-", o.offset)),
+		})
+		if isS3NotFound(err) {
+			return 0, ErrBlobNotFound
+		} else if err != nil {
+			return 0, err
+		}
+		o.body = object.Body
+	}
+
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	if err == io.EOF && o.offset < o.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (o *objectReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = o.offset + offset
+	case io.SeekEnd:
+		target = o.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if target < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if target != o.offset {
+		if err := o.Close(); err != nil {
+			logrus.WithError(err).Error("Error closing object body")
+		}
+		o.offset = target
+	}
+
+	return target, nil
+}
+
+func (o *objectReader) Close() error {
+	if o.body == nil {
+		return nil
+	}
+
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
@@ -0,0 +1,200 @@
+package dao
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeS3 implements just enough of the S3 REST API, with path style addressing, for S3Store.
+type fakeS3 struct {
+	mu               sync.Mutex
+	objects          map[string][]byte
+	uploads          map[string]map[int][]byte
+	multipartUploads int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := r.URL.Path
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+
+	switch {
+	case r.Method == http.MethodPost && query["uploads"] != nil:
+		f.multipartUploads++
+		uploadID = strconv.Itoa(f.multipartUploads)
+		f.uploads[uploadID] = make(map[int][]byte)
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			UploadID string   `xml:"UploadId"`
+		}{UploadID: uploadID})
+	case r.Method == http.MethodPut && uploadID != "":
+		part, _ := strconv.Atoi(query.Get("partNumber"))
+		body, _ := ioutil.ReadAll(r.Body)
+		f.uploads[uploadID][part] = body
+		w.Header().Set("ETag", fmt.Sprintf("%q", strconv.Itoa(part)))
+	case r.Method == http.MethodPost && uploadID != "":
+		parts := f.uploads[uploadID]
+		numbers := make([]int, 0, len(parts))
+		for number := range parts {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+
+		var object []byte
+		for _, number := range numbers {
+			object = append(object, parts[number]...)
+		}
+		f.objects[key] = object
+		delete(f.uploads, uploadID)
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Key     string   `xml:"Key"`
+		}{Key: key})
+	case r.Method == http.MethodDelete && uploadID != "":
+		delete(f.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		f.objects[key] = body
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodHead, r.Method == http.MethodGet:
+		object, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				writeXML(w, struct {
+					XMLName xml.Name `xml:"Error"`
+					Code    string   `xml:"Code"`
+				}{Code: "NoSuchKey"})
+			}
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(object))
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func writeXML(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	if err := xml.NewEncoder(w).Encode(body); err != nil {
+		panic(err)
+	}
+}
+
+func newTestS3Store(t *testing.T) (*S3Store, *fakeS3) {
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3Store(S3Config{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		Bucket:          "content",
+		Prefix:          "blobs/",
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+		PathStyle:       true,
+	})
+	require.Nil(t, err)
+	return store, fake
+}
+
+func TestS3Store_ShouldRoundTripSmallBlobs(t *testing.T) {
+	store, fake := newTestS3Store(t)
+	ctx := context.Background()
+
+	blob, err := store.Put(ctx, "test.txt", strings.NewReader("test content"))
+	require.Nil(t, err)
+	require.Equal(t, int64(12), blob.Size)
+	require.Equal(t, []byte("test content"), fake.objects["/content/blobs/"+blob.ID.Hex()])
+	require.Equal(t, 0, fake.multipartUploads)
+
+	info, err := store.Stat(ctx, blob.ID)
+	require.Nil(t, err)
+	require.Equal(t, blob, info)
+
+	stream, err := store.Get(ctx, blob.ID)
+	require.Nil(t, err)
+	content, err := ioutil.ReadAll(stream)
+	require.Nil(t, err)
+	require.Nil(t, stream.Close())
+	require.Equal(t, "test content", string(content))
+
+	require.Nil(t, store.Delete(ctx, blob.ID))
+	_, err = store.Stat(ctx, blob.ID)
+	require.Equal(t, ErrBlobNotFound, err)
+}
+
+func TestS3Store_ShouldUseMultipartUploadsForLargeBlobs(t *testing.T) {
+	store, fake := newTestS3Store(t)
+	ctx := context.Background()
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), (s3PartSize*2+1024)/16)
+	blob, err := store.Put(ctx, "large.bin", io.LimitReader(bytes.NewReader(content), int64(len(content))))
+	require.Nil(t, err)
+	require.Equal(t, int64(len(content)), blob.Size)
+	require.Equal(t, 1, fake.multipartUploads)
+	require.Equal(t, content, fake.objects["/content/blobs/"+blob.ID.Hex()])
+	require.Empty(t, fake.uploads)
+}
+
+func TestS3Store_ShouldReadFromSeekOffsets(t *testing.T) {
+	store, _ := newTestS3Store(t)
+	ctx := context.Background()
+
+	blob, err := store.Put(ctx, "test.txt", strings.NewReader("0123456789"))
+	require.Nil(t, err)
+
+	stream, err := store.Get(ctx, blob.ID)
+	require.Nil(t, err)
+	defer stream.Close()
+
+	head := make([]byte, 2)
+	_, err = io.ReadFull(stream, head)
+	require.Nil(t, err)
+	require.Equal(t, "01", string(head))
+
+	_, err = stream.Seek(-3, io.SeekEnd)
+	require.Nil(t, err)
+	tail, err := ioutil.ReadAll(stream)
+	require.Nil(t, err)
+	require.Equal(t, "789", string(tail))
+
+	_, err = stream.Seek(4, io.SeekStart)
+	require.Nil(t, err)
+	_, err = io.ReadFull(stream, head)
+	require.Nil(t, err)
+	require.Equal(t, "45", string(head))
+}
+
+func TestS3Store_ShouldReturnErrBlobNotFoundForUnknownBlobs(t *testing.T) {
+	store, _ := newTestS3Store(t)
+
+	_, err := store.Get(context.Background(), primitive.NewObjectID())
+	require.Equal(t, ErrBlobNotFound, err)
+}
@@ -0,0 +1,112 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"content-service-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrShareUnavailable = errors.New("share has expired or has no downloads left")
+
+func (db *Handler) CreateShare(ctx context.Context, share *models.Share) error {
+	result, err := db.getShareCollection().InsertOne(ctx, share)
+	if err != nil {
+		return err
+	}
+
+	share.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (db *Handler) GetShare(ctx context.Context, shareID primitive.ObjectID) (*models.Share, error) {
+	result := db.getShareCollection().FindOne(ctx, bson.M{"_id": shareID})
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var share models.Share
+	if err := result.Decode(&share); err != nil {
+		return nil, err
+	}
+
+	return &share, nil
+}
+
+// GetShares lists the shares of a file that can still be used, newest first.
+func (db *Handler) GetShares(ctx context.Context, fileID primitive.ObjectID) ([]models.Share, error) {
+	filter := activeShareFilter(time.Now())
+	filter["fileId"] = fileID
+
+	cursor, err := db.getShareCollection().Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	shares := []models.Share{}
+	if err := cursor.All(ctx, &shares); err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+// ClaimShareDownload counts a download against a share. The check and the increment are a single
+// update, so concurrent downloads can never exceed the share's limit.
+func (db *Handler) ClaimShareDownload(ctx context.Context, shareID primitive.ObjectID) (*models.Share, error) {
+	filter := activeShareFilter(time.Now())
+	filter["_id"] = shareID
+
+	result := db.getShareCollection().FindOneAndUpdate(
+		ctx,
+		filter,
+		bson.M{"$inc": bson.M{"downloads": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if result.Err() == mongo.ErrNoDocuments {
+		return nil, ErrShareUnavailable
+	} else if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var share models.Share
+	if err := result.Decode(&share); err != nil {
+		return nil, err
+	}
+
+	return &share, nil
+}
+
+// DeleteShare revokes a share of the given file.
+func (db *Handler) DeleteShare(ctx context.Context, fileID primitive.ObjectID, shareID primitive.ObjectID) error {
+	result, err := db.getShareCollection().DeleteOne(ctx, bson.M{"_id": shareID, "fileId": fileID})
+	if err != nil {
+		return err
+	} else if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// activeShareFilter matches shares that have not expired and still have downloads left, as Share.Active
+// reports for a single share.
+func activeShareFilter(now time.Time) bson.M {
+	return bson.M{
+		"expires": bson.M{"$gt": now},
+		"$or": bson.A{
+			bson.M{"maxDownloads": bson.M{"$lte": 0}},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$downloads", "$maxDownloads"}}},
+		},
+	}
+}
+
+func (db *Handler) getShareCollection() *mongo.Collection {
+	return db.Client.Database(db.Database).Collection(db.ShareCollection)
+}
@@ -0,0 +1,314 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"content-service-api/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// UploadLifetime is how long a resumable upload is kept after the last chunk was received.
+	UploadLifetime = 24 * time.Hour
+
+	// completionTimeout is how long a completion is assumed to still be running before another
+	// request is allowed to take it over, e.g. because the pod running it was stopped.
+	completionTimeout = 5 * time.Minute
+)
+
+var (
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match the number of bytes received")
+	ErrUploadTooLarge       = errors.New("chunk would exceed the length of the upload")
+	ErrUploadIncomplete     = errors.New("upload has not received all of its bytes")
+	ErrUploadCompleting     = errors.New("upload is already being completed")
+)
+
+// CreateUpload starts a resumable upload. The file it will create is checked up front, so that a
+// client does not upload all of its bytes only to find the name is taken.
+func (db *Handler) CreateUpload(ctx context.Context, upload *models.Upload) error {
+	if !validName(upload.File.Name) {
+		return ErrInvalidName
+	}
+
+	if upload.File.Parent != nil {
+		if _, err := db.GetFolder(ctx, *upload.File.Parent); err != nil {
+			return err
+		}
+	}
+
+	if err := db.checkNameAvailable(ctx, upload.File.Parent, upload.File.Owner, upload.File.Name, primitive.NilObjectID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	upload.Offset = 0
+	upload.Chunks = []models.UploadChunk{}
+	upload.Created = now
+	upload.Expires = now.Add(UploadLifetime)
+
+	result, err := db.getUploadCollection().InsertOne(ctx, upload)
+	if err != nil {
+		return err
+	}
+
+	upload.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetUpload returns an upload that has not expired.
+func (db *Handler) GetUpload(ctx context.Context, uploadID primitive.ObjectID) (*models.Upload, error) {
+	result := db.getUploadCollection().FindOne(ctx, bson.M{"_id": uploadID, "expires": bson.M{"$gt": time.Now()}})
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var upload models.Upload
+	if err := result.Decode(&upload); err != nil {
+		return nil, err
+	}
+
+	return &upload, nil
+}
+
+// AppendUpload stores source as the next chunk of an upload, provided the upload has received exactly
+// offset bytes so far. Everything source yields before io.EOF is kept, however short. The offset is only
+// advanced by a single update that checks it again, so of two concurrent requests for the same offset
+// only one is kept.
+func (db *Handler) AppendUpload(ctx context.Context, uploadID primitive.ObjectID, offset int64, source io.Reader) (*models.Upload, error) {
+	upload, err := db.GetUpload(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	} else if upload.Offset != offset || upload.Completed {
+		return nil, ErrUploadOffsetMismatch
+	}
+
+	remaining := upload.Length - upload.Offset
+	blob, err := db.BlobStore.Put(ctx, upload.File.Name, io.LimitReader(source, remaining+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if blob.Size == 0 || blob.Size > remaining {
+		if err := db.deleteContent(ctx, blob.ID); err != nil {
+			logrus.WithError(err).Error("Error deleting upload chunk")
+		}
+		if blob.Size > remaining {
+			return nil, ErrUploadTooLarge
+		}
+		return upload, nil
+	}
+
+	result := db.getUploadCollection().FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": uploadID, "offset": offset, "completed": false},
+		bson.M{
+			"$push": bson.M{"chunks": models.UploadChunk{BlobID: blob.ID, Size: blob.Size}},
+			"$inc":  bson.M{"offset": blob.Size},
+			"$set":  bson.M{"expires": time.Now().Add(UploadLifetime)},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if result.Err() != nil {
+		if err := db.deleteContent(ctx, blob.ID); err != nil {
+			logrus.WithError(err).Error("Error deleting upload chunk")
+		}
+		if result.Err() == mongo.ErrNoDocuments {
+			return nil, ErrUploadOffsetMismatch
+		}
+		return nil, result.Err()
+	}
+
+	if err := result.Decode(upload); err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// CompleteUpload creates the upload's file from its chunks and then discards the chunks. The upload
+// itself is kept, marked as completed and with the ID of the file, until it expires so that clients can
+// still query it.
+func (db *Handler) CompleteUpload(ctx context.Context, uploadID primitive.ObjectID) (*models.Upload, error) {
+	now := time.Now()
+	result := db.getUploadCollection().FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"_id":       uploadID,
+			"completed": false,
+			"expires":   bson.M{"$gt": now},
+			"$expr":     bson.M{"$eq": bson.A{"$offset", "$length"}},
+			"$or": bson.A{
+				bson.M{"completing": bson.M{"$exists": false}},
+				bson.M{"completing": bson.M{"$lt": now.Add(-completionTimeout)}},
+			},
+		},
+		bson.M{"$set": bson.M{"completing": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if result.Err() == mongo.ErrNoDocuments {
+		upload, err := db.GetUpload(ctx, uploadID)
+		switch {
+		case err != nil:
+			return nil, err
+		case upload.Completed:
+			return upload, nil
+		case upload.Offset != upload.Length:
+			return nil, ErrUploadIncomplete
+		default:
+			return nil, ErrUploadCompleting
+		}
+	} else if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var upload models.Upload
+	if err := result.Decode(&upload); err != nil {
+		return nil, err
+	}
+
+	source := newChunkSequence(ctx, db.BlobStore, upload.Chunks)
+	defer func() {
+		if err := source.Close(); err != nil {
+			logrus.WithError(err).Error("Error closing upload chunk")
+		}
+	}()
+
+	file := upload.File
+	file.Timestamp = now
+	created, err := db.UploadFile(ctx, &file, source)
+	if err != nil {
+		if _, err := db.getUploadCollection().UpdateOne(ctx, bson.M{"_id": uploadID}, bson.M{"$unset": bson.M{"completing": ""}}); err != nil {
+			logrus.WithError(err).Error("Error releasing upload")
+		}
+		return nil, err
+	}
+
+	_, err = db.getUploadCollection().UpdateOne(
+		ctx,
+		bson.M{"_id": uploadID},
+		bson.M{"$set": bson.M{"completed": true, "fileId": created.ID, "chunks": bson.A{}}, "$unset": bson.M{"completing": ""}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	db.deleteChunks(ctx, upload.Chunks)
+
+	upload.Completed = true
+	upload.FileID = &created.ID
+	upload.Completing = nil
+	upload.Chunks = []models.UploadChunk{}
+	return &upload, nil
+}
+
+// DeleteUpload terminates an upload and discards the bytes received so far.
+func (db *Handler) DeleteUpload(ctx context.Context, uploadID primitive.ObjectID) error {
+	result := db.getUploadCollection().FindOneAndDelete(ctx, bson.M{"_id": uploadID})
+	if result.Err() != nil {
+		return result.Err()
+	}
+
+	var upload models.Upload
+	if err := result.Decode(&upload); err != nil {
+		return err
+	}
+
+	db.deleteChunks(ctx, upload.Chunks)
+	return nil
+}
+
+// DeleteExpiredUploads removes uploads that have not received anything within UploadLifetime, along
+// with their chunks, and returns how many were removed.
+func (db *Handler) DeleteExpiredUploads(ctx context.Context) (int, error) {
+	cursor, err := db.getUploadCollection().Find(ctx, bson.M{"expires": bson.M{"$lte": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+
+	var expired []models.Upload
+	if err := cursor.All(ctx, &expired); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, upload := range expired {
+		if err := db.DeleteUpload(ctx, upload.ID); err != nil && err != mongo.ErrNoDocuments {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+func (db *Handler) deleteChunks(ctx context.Context, chunks []models.UploadChunk) {
+	for _, chunk := range chunks {
+		if err := db.deleteContent(ctx, chunk.BlobID); err != nil {
+			logrus.WithError(err).WithField("blob", chunk.BlobID.Hex()).Error("Error deleting upload chunk")
+		}
+	}
+}
+
+func (db *Handler) getUploadCollection() *mongo.Collection {
+	return db.Client.Database(db.Database).Collection(db.UploadCollection)
+}
+
+// chunkSequence reads the chunks of an upload one after another, opening each only once the previous
+// one has been read to the end.
+type chunkSequence struct {
+	ctx     context.Context
+	store   BlobStore
+	chunks  []models.UploadChunk
+	current FileStream
+}
+
+func newChunkSequence(ctx context.Context, store BlobStore, chunks []models.UploadChunk) *chunkSequence {
+	return &chunkSequence{ctx: ctx, store: store, chunks: chunks}
+}
+
+func (c *chunkSequence) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.chunks) == 0 {
+				return 0, io.EOF
+			}
+
+			stream, err := c.store.Get(c.ctx, c.chunks[0].BlobID)
+			if err != nil {
+				return 0, err
+			}
+			c.current = stream
+			c.chunks = c.chunks[1:]
+		}
+
+		n, err := c.current.Read(p)
+		if err == io.EOF {
+			if err := c.Close(); err != nil {
+				return n, err
+			}
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+func (c *chunkSequence) Close() error {
+	if c.current == nil {
+		return nil
+	}
+
+	err := c.current.Close()
+	c.current = nil
+	return err
+}
@@ -0,0 +1,47 @@
+package dao
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"content-service-api/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestChunkSequence_ShouldReadChunksInOrder(t *testing.T) {
+	store := newTestLocalStore(t)
+	ctx := context.Background()
+
+	var chunks []models.UploadChunk
+	for _, content := range []string{"first ", "", "second ", "third"} {
+		blob, err := store.Put(ctx, "test.txt", strings.NewReader(content))
+		require.Nil(t, err)
+		chunks = append(chunks, models.UploadChunk{BlobID: blob.ID, Size: blob.Size})
+	}
+
+	sequence := newChunkSequence(ctx, store, chunks)
+	content, err := ioutil.ReadAll(sequence)
+	require.Nil(t, err)
+	require.Equal(t, "first second third", string(content))
+	require.Nil(t, sequence.Close())
+}
+
+func TestChunkSequence_ShouldFailIfChunkIsMissing(t *testing.T) {
+	store := newTestLocalStore(t)
+	ctx := context.Background()
+
+	blob, err := store.Put(ctx, "test.txt", strings.NewReader("first"))
+	require.Nil(t, err)
+
+	sequence := newChunkSequence(ctx, store, []models.UploadChunk{
+		{BlobID: blob.ID, Size: blob.Size},
+		{BlobID: primitive.NewObjectID(), Size: 5},
+	})
+	_, err = ioutil.ReadAll(sequence)
+	require.Equal(t, ErrBlobNotFound, err)
+	require.Nil(t, sequence.Close())
+}
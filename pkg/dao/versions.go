@@ -0,0 +1,188 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"content-service-api/models"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrVersionNotFound = errors.New("version not found")
+	ErrVersionConflict = errors.New("file was modified concurrently, please retry")
+)
+
+// GetFileVersions returns every revision of a file, oldest first. Files uploaded before versioning was
+// introduced are reported as having a single revision.
+func (db *Handler) GetFileVersions(ctx context.Context, fileID primitive.ObjectID) ([]models.FileVersion, error) {
+	fileRequest, err := db.getFileRequest(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileVersions(fileRequest), nil
+}
+
+func (db *Handler) GetFileVersion(ctx context.Context, fileID primitive.ObjectID, version int) (*models.FileVersion, error) {
+	versions, err := db.GetFileVersions(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range versions {
+		if v.Version == version {
+			return &v, nil
+		}
+	}
+
+	return nil, ErrVersionNotFound
+}
+
+func (db *Handler) OpenFileVersion(ctx context.Context, fileID primitive.ObjectID, version int) (FileStream, error) {
+	fileVersion, err := db.GetFileVersion(ctx, fileID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.openContent(ctx, fileVersion.FileID)
+}
+
+// UploadFileVersion stores source as a new revision of an existing file and makes it current.
+func (db *Handler) UploadFileVersion(ctx context.Context, fileID primitive.ObjectID, versionRequest *models.FileVersion, source io.Reader) error {
+	content, err := db.storeContent(ctx, versionRequest.Name, source)
+	if err != nil {
+		return err
+	}
+
+	versionRequest.FileID = content.FileID
+	versionRequest.Size = content.Size
+	versionRequest.Hash = content.Hash
+	versionRequest.ContentType = content.ContentType
+
+	if err := db.appendVersion(ctx, fileID, versionRequest); err != nil {
+		if err := db.releaseContent(ctx, content.FileID); err != nil {
+			logrus.WithError(err).Error("Error releasing file content")
+		}
+		return err
+	}
+
+	if err := db.DeleteDerived(ctx, fileID, versionRequest.Hash); err != nil {
+		logrus.WithError(err).Error("Error deleting outdated derived content")
+	}
+
+	return nil
+}
+
+// RestoreFileVersion makes an earlier revision current again. The history is preserved: the restored
+// content is recorded as a new revision pointing at the same GridFS object.
+func (db *Handler) RestoreFileVersion(ctx context.Context, fileID primitive.ObjectID, version int) (*models.FileVersion, error) {
+	fileVersion, err := db.GetFileVersion(ctx, fileID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.contentRefs().retain(ctx, fileVersion.FileID); err != nil {
+		return nil, err
+	}
+
+	fileVersion.Timestamp = time.Now()
+	if err := db.appendVersion(ctx, fileID, fileVersion); err != nil {
+		if err := db.releaseContent(ctx, fileVersion.FileID); err != nil {
+			logrus.WithError(err).Error("Error releasing file content")
+		}
+		return nil, err
+	}
+
+	if err := db.DeleteDerived(ctx, fileID, fileVersion.Hash); err != nil {
+		logrus.WithError(err).Error("Error deleting outdated derived content")
+	}
+
+	return fileVersion, nil
+}
+
+// appendVersion records versionRequest as the newest revision of a file, assigning its version number.
+// The update only applies if the file's current version is unchanged since it was read.
+func (db *Handler) appendVersion(ctx context.Context, fileID primitive.ObjectID, versionRequest *models.FileVersion) error {
+	fileRequest, err := db.getFileRequest(ctx, fileID)
+	if err != nil {
+		return err
+	}
+
+	versions := fileVersions(fileRequest)
+	versionRequest.Version = versions[len(versions)-1].Version + 1
+	versions = append(versions, *versionRequest)
+
+	filter := bson.M{"_id": fileID, "version": fileRequest.Version}
+	if fileRequest.Version == 0 {
+		filter["version"] = bson.M{"$exists": false}
+	}
+
+	update := currentVersionFields(versionRequest)
+	update["versions"] = versions
+	result, err := db.getFileCollection().UpdateOne(ctx, filter, bson.M{"$set": update})
+	if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// currentVersionFields returns the fields of a file that describe its current revision. The name and
+// extension are not among them: they belong to the file, which keeps them whatever the name of the
+// revision uploaded, so that a new revision neither renames the file nor leaves its name and extension
+// disagreeing.
+func currentVersionFields(version *models.FileVersion) bson.M {
+	return bson.M{
+		"timestamp":   version.Timestamp,
+		"size":        version.Size,
+		"contentType": version.ContentType,
+		"fileBytes":   version.FileID,
+		"hash":        version.Hash,
+		"version":     version.Version,
+	}
+}
+
+func (db *Handler) getFileRequest(ctx context.Context, fileID primitive.ObjectID) (*models.FileRequest, error) {
+	result := db.getFileCollection().FindOne(ctx, map[string]interface{}{"_id": fileID})
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var fileRequest models.FileRequest
+	if err := result.Decode(&fileRequest); err != nil {
+		return nil, err
+	}
+
+	return &fileRequest, nil
+}
+
+func fileVersions(fileRequest *models.FileRequest) []models.FileVersion {
+	if len(fileRequest.Versions) > 0 {
+		return fileRequest.Versions
+	}
+
+	return []models.FileVersion{{
+		Version:     1,
+		Name:        fileRequest.Name,
+		Timestamp:   fileRequest.Timestamp,
+		Extension:   fileRequest.Extension,
+		Size:        fileRequest.Size,
+		ContentType: fileRequest.ContentType,
+		FileID:      fileRequest.FileID,
+		Hash:        fileRequest.Hash,
+	}}
+}
+
+// IsNotFound reports whether err means the requested document, revision or blob does not exist.
+func IsNotFound(err error) bool {
+	return err == mongo.ErrNoDocuments || err == ErrVersionNotFound || err == ErrBlobNotFound
+}
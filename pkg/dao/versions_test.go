@@ -0,0 +1,31 @@
+package dao
+
+import (
+	"testing"
+	"time"
+
+	"content-service-api/models"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestHandler_CurrentVersionFields_ShouldKeepNameAndExtensionOfFile(t *testing.T) {
+	version := &models.FileVersion{
+		Version:     2,
+		Name:        "report.pdf",
+		Timestamp:   time.Now(),
+		Extension:   ".pdf",
+		Size:        4,
+		ContentType: "application/pdf",
+		FileID:      primitive.NewObjectID(),
+		Hash:        "abc",
+	}
+
+	fields := currentVersionFields(version)
+	require.NotContains(t, fields, "name")
+	require.NotContains(t, fields, "extension")
+	require.Equal(t, "application/pdf", fields["contentType"])
+	require.Equal(t, version.FileID, fields["fileBytes"])
+	require.Equal(t, 2, fields["version"])
+}
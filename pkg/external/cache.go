@@ -0,0 +1,178 @@
+package external
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"content-service-api/models"
+)
+
+const (
+	DefaultCacheTTL         = 5 * time.Minute
+	DefaultCacheNegativeTTL = 30 * time.Second
+	DefaultCacheSize        = 10000
+)
+
+// CacheConfig controls how long token validations are remembered. MaxEntries bounds the number of
+// tokens held at once; the least recently used entry is evicted to make room for a new one.
+type CacheConfig struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	MaxEntries  int
+}
+
+// CacheStats counts cache activity since the cache was created.
+type CacheStats struct {
+	Hits         int64 `json:"hits"`
+	NegativeHits int64 `json:"negativeHits"`
+	Misses       int64 `json:"misses"`
+	Evictions    int64 `json:"evictions"`
+	Entries      int   `json:"entries"`
+}
+
+// CachingHandler remembers the outcome of token validations so that repeated requests with the same
+// token do not each need a round trip to the login service. Successful validations are kept for TTL
+// and rejections for NegativeTTL. Errors that say nothing about the token itself, such as the login
+// service being unreachable, are never cached. Tokens are only stored as SHA-256 hashes.
+type CachingHandler struct {
+	next   ExtHandler
+	config CacheConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	stats   CacheStats
+}
+
+type cacheEntry struct {
+	key       string
+	principal *models.Principal
+	err       error
+	expires   time.Time
+}
+
+// NewCachingHandler wraps next with a validation cache. Zero values in config are replaced by the
+// package defaults.
+func NewCachingHandler(next ExtHandler, config CacheConfig) *CachingHandler {
+	if config.TTL <= 0 {
+		config.TTL = DefaultCacheTTL
+	}
+	if config.NegativeTTL <= 0 {
+		config.NegativeTTL = DefaultCacheNegativeTTL
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = DefaultCacheSize
+	}
+
+	return &CachingHandler{
+		next:    next,
+		config:  config,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (c *CachingHandler) ValidateToken(token string) (*models.Principal, error) {
+	key := hashToken(token)
+
+	if entry, ok := c.lookup(key); ok {
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		return copyPrincipal(entry.principal), nil
+	}
+
+	principal, err := c.next.ValidateToken(token)
+	switch {
+	case err == nil:
+		// Never remember a token for longer than the validator said it would remain valid.
+		expires := c.now().Add(c.config.TTL)
+		if !principal.ExpiresAt.IsZero() && principal.ExpiresAt.Before(expires) {
+			expires = principal.ExpiresAt
+		}
+		c.store(&cacheEntry{key: key, principal: copyPrincipal(principal), expires: expires})
+	case IsRejected(err):
+		c.store(&cacheEntry{key: key, err: err, expires: c.now().Add(c.config.NegativeTTL)})
+	}
+
+	return principal, err
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *CachingHandler) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+func (c *CachingHandler) lookup(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(element)
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.lru.MoveToFront(element)
+	if entry.err != nil {
+		c.stats.NegativeHits++
+	} else {
+		c.stats.Hits++
+	}
+	return entry, true
+}
+
+func (c *CachingHandler) store(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[entry.key]; ok {
+		c.remove(element)
+	}
+
+	for c.lru.Len() >= c.config.MaxEntries {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+
+	c.entries[entry.key] = c.lru.PushFront(entry)
+}
+
+func (c *CachingHandler) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// copyPrincipal keeps callers from modifying the cached principal.
+func copyPrincipal(principal *models.Principal) *models.Principal {
+	if principal == nil {
+		return nil
+	}
+
+	cp := *principal
+	cp.Roles = append([]string(nil), principal.Roles...)
+	cp.Scopes = append([]string(nil), principal.Scopes...)
+	return &cp
+}
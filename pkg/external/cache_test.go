@@ -0,0 +1,143 @@
+package external
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func newTestCache(requestor *mocks.Requestor, config CacheConfig) (*CachingHandler, *testClock) {
+	clock := &testClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cache := NewCachingHandler(&Handler{HttpClient: requestor, LoginServiceURL: "test"}, config)
+	cache.now = clock.Now
+	return cache, clock
+}
+
+func tokenResponse(status int, body string) func(*http.Request) *http.Response {
+	return func(*http.Request) *http.Response {
+		return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader(body))}
+	}
+}
+
+func tokenIs(token string) interface{} {
+	return mock.MatchedBy(func(req *http.Request) bool {
+		return req.Header.Get("Authorization") == "Bearer "+token
+	})
+}
+
+func TestCache_ValidateToken_ShouldCacheSuccessfulValidations(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(tokenResponse(http.StatusOK, `{"userId": "test"}`), nil)
+
+	cache, clock := newTestCache(requestor, CacheConfig{TTL: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		principal, err := cache.ValidateToken("test")
+		require.Nil(t, err)
+		require.Equal(t, "test", principal.UserID)
+	}
+	requestor.AssertNumberOfCalls(t, "Do", 1)
+
+	clock.now = clock.now.Add(time.Minute)
+	_, err := cache.ValidateToken("test")
+	require.Nil(t, err)
+	requestor.AssertNumberOfCalls(t, "Do", 2)
+
+	require.Equal(t, CacheStats{Hits: 2, Misses: 2, Entries: 1}, cache.Stats())
+}
+
+func TestCache_ValidateToken_ShouldCacheRejections(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(tokenResponse(http.StatusUnauthorized, ""), nil)
+
+	cache, clock := newTestCache(requestor, CacheConfig{NegativeTTL: 10 * time.Second})
+
+	for i := 0; i < 2; i++ {
+		_, err := cache.ValidateToken("test")
+		require.NotNil(t, err)
+		require.True(t, IsRejected(err))
+	}
+	requestor.AssertNumberOfCalls(t, "Do", 1)
+
+	clock.now = clock.now.Add(10 * time.Second)
+	_, err := cache.ValidateToken("test")
+	require.NotNil(t, err)
+	requestor.AssertNumberOfCalls(t, "Do", 2)
+	require.Equal(t, int64(1), cache.Stats().NegativeHits)
+}
+
+func TestCache_ValidateToken_ShouldNotCacheLoginServiceFailures(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(nil, errors.New("test")).Once()
+	requestor.On("Do", mock.Anything).Return(tokenResponse(http.StatusServiceUnavailable, ""), nil).Once()
+	requestor.On("Do", mock.Anything).Return(tokenResponse(http.StatusOK, `{"userId": "test"}`), nil).Once()
+
+	cache, _ := newTestCache(requestor, CacheConfig{})
+
+	_, err := cache.ValidateToken("test")
+	require.NotNil(t, err)
+
+	_, err = cache.ValidateToken("test")
+	require.NotNil(t, err)
+	require.False(t, IsRejected(err))
+
+	principal, err := cache.ValidateToken("test")
+	require.Nil(t, err)
+	require.Equal(t, "test", principal.UserID)
+	requestor.AssertNumberOfCalls(t, "Do", 3)
+}
+
+func TestCache_ValidateToken_ShouldEvictLeastRecentlyUsedToken(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	for _, token := range []string{"a", "b", "c"} {
+		requestor.On("Do", tokenIs(token)).Return(tokenResponse(http.StatusOK, `{"userId": "`+token+`"}`), nil)
+	}
+
+	cache, _ := newTestCache(requestor, CacheConfig{MaxEntries: 2})
+
+	for _, token := range []string{"a", "b", "a", "c", "a"} {
+		principal, err := cache.ValidateToken(token)
+		require.Nil(t, err)
+		require.Equal(t, token, principal.UserID)
+	}
+	requestor.AssertNumberOfCalls(t, "Do", 3)
+
+	_, err := cache.ValidateToken("b")
+	require.Nil(t, err)
+	requestor.AssertNumberOfCalls(t, "Do", 4)
+
+	stats := cache.Stats()
+	require.Equal(t, int64(2), stats.Evictions)
+	require.Equal(t, 2, stats.Entries)
+}
+
+func TestCache_ValidateToken_ShouldNotShareCachedPrincipal(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(tokenResponse(http.StatusOK, `{"userId": "test", "roles": ["user"]}`), nil)
+
+	cache, _ := newTestCache(requestor, CacheConfig{})
+
+	principal, err := cache.ValidateToken("test")
+	require.Nil(t, err)
+	principal.Roles[0] = "admin"
+
+	principal, err = cache.ValidateToken("test")
+	require.Nil(t, err)
+	require.False(t, principal.IsAdmin())
+}
@@ -1,9 +1,14 @@
 package external
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+
+	"content-service-api/models"
+
+	"github.com/sirupsen/logrus"
 )
 
 type Requestor interface {
@@ -11,7 +16,45 @@ type Requestor interface {
 }
 
 type ExtHandler interface {
-	ValidateToken(token string) error
+	ValidateToken(token string) (*models.Principal, error)
+}
+
+// StatusError is returned when the login service answers with anything other than 200.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("non-200 status code received: %v", e.StatusCode)
+}
+
+// TokenError is returned when a token is examined locally and found to be invalid.
+type TokenError struct {
+	Reason string
+}
+
+func (e *TokenError) Error() string {
+	return fmt.Sprintf("invalid token: %v", e.Reason)
+}
+
+// IsRejected reports whether err means the login service looked at the token and refused it, as
+// opposed to the service being unreachable or failing.
+func IsRejected(err error) bool {
+	var tokenErr *TokenError
+	if errors.As(err, &tokenErr) {
+		return true
+	}
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+
+	switch statusErr.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return statusErr.StatusCode >= 400 && statusErr.StatusCode < 500
 }
 
 type Handler struct {
@@ -19,26 +62,48 @@ type Handler struct {
 	LoginServiceURL string
 }
 
-func (e *Handler) ValidateToken(token string) error {
+// ValidateToken checks a token with the login service and returns the principal it was issued to.
+func (e *Handler) ValidateToken(token string) (*models.Principal, error) {
 	if e.LoginServiceURL == "" {
-		return errors.New("login service url cannot be emtpy")
+		return nil, errors.New("login service url cannot be emtpy")
 	}
 
 	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%v/token", e.LoginServiceURL), nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %v", token))
 
 	resp, err := e.HttpClient.Do(req)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if resp.Body != nil {
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				logrus.WithError(err).Error("Error closing response body")
+			}
+		}()
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return errors.New(fmt.Sprintf("non-200 status code received: %v", resp.StatusCode))
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	if resp.Body == nil {
+		return nil, errors.New("token response was empty")
+	}
+
+	var principal models.Principal
+	if err := json.NewDecoder(resp.Body).Decode(&principal); err != nil {
+		return nil, fmt.Errorf("error decoding token response: %v", err)
+	}
+
+	if principal.UserID == "" {
+		return nil, errors.New("token response did not identify a user")
 	}
 
-	return nil
+	return &principal, nil
 }
@@ -3,9 +3,12 @@ package external
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 
+	"content-service-api/models"
 	"content-service-api/pkg/testhelper/mocks"
 
 	"github.com/stretchr/testify/mock"
@@ -20,7 +23,7 @@ func TestExternal_ValidateToken_ShouldReturnErrorIfLoginServiceURLIsEmpty(t *tes
 		LoginServiceURL: "",
 	}
 
-	err := handler.ValidateToken("test")
+	_, err := handler.ValidateToken("test")
 	require.NotNil(t, err)
 	require.Equal(t, "login service url cannot be emtpy", err.Error())
 }
@@ -34,7 +37,7 @@ func TestExternal_ValidateToken_ShouldReturnErrorIfErrorOccursPerformingRequest(
 		LoginServiceURL: "test",
 	}
 
-	err := handler.ValidateToken("test")
+	_, err := handler.ValidateToken("test")
 	require.NotNil(t, err)
 	require.Equal(t, "test", err.Error())
 }
@@ -48,19 +51,58 @@ func TestExternal_ValidateToken_ShouldReturnErrorIfResponseCodeIsNot200(t *testi
 		LoginServiceURL: "test",
 	}
 
-	err := handler.ValidateToken("test")
+	_, err := handler.ValidateToken("test")
 	require.NotNil(t, err)
 	require.Equal(t, fmt.Sprintf("non-200 status code received: %v", http.StatusTeapot), err.Error())
 }
 
-func TestExternal_ValidateToken_ShouldReturnNilOnSuccess(t *testing.T) {
+func TestExternal_ValidateToken_ShouldReturnErrorIfResponseCannotBeDecoded(t *testing.T) {
 	requestor := &mocks.Requestor{}
-	requestor.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK}, nil)
+	requestor.On("Do", mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader("test")),
+	}, nil)
 
 	handler := Handler{
 		HttpClient:      requestor,
 		LoginServiceURL: "test",
 	}
 
-	require.Nil(t, handler.ValidateToken("test"))
+	_, err := handler.ValidateToken("test")
+	require.NotNil(t, err)
+}
+
+func TestExternal_ValidateToken_ShouldReturnErrorIfResponseHasNoUserID(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"roles": ["admin"]}`)),
+	}, nil)
+
+	handler := Handler{
+		HttpClient:      requestor,
+		LoginServiceURL: "test",
+	}
+
+	_, err := handler.ValidateToken("test")
+	require.NotNil(t, err)
+	require.Equal(t, "token response did not identify a user", err.Error())
+}
+
+func TestExternal_ValidateToken_ShouldReturnPrincipalOnSuccess(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"userId": "test", "roles": ["admin"]}`)),
+	}, nil)
+
+	handler := Handler{
+		HttpClient:      requestor,
+		LoginServiceURL: "test",
+	}
+
+	principal, err := handler.ValidateToken("test")
+	require.Nil(t, err)
+	require.Equal(t, &models.Principal{UserID: "test", Roles: []string{"admin"}}, principal)
+	require.True(t, principal.IsAdmin())
 }
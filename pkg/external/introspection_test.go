@@ -0,0 +1,183 @@
+package external
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"content-service-api/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testIntrospectionNow = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newIntrospectionServer answers introspection requests for the client "client" with the response
+// registered for the token, and reports every other token as inactive.
+func newIntrospectionServer(t *testing.T, tokens map[string]map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// RFC 6749 has clients form encode their credentials before using them for basic auth.
+		clientID, secret, ok := r.BasicAuth()
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+		if !ok || clientID != "client" || secret != "s3cr3t!" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Nil(t, r.ParseForm())
+		require.Equal(t, "access_token", r.PostForm.Get("token_type_hint"))
+
+		response, ok := tokens[r.PostForm.Get("token")]
+		if !ok {
+			response = map[string]interface{}{"active": false}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		require.Nil(t, json.NewEncoder(w).Encode(response))
+	}))
+}
+
+func newTestIntrospectionHandler(t *testing.T, server *httptest.Server, config IntrospectionConfig) *IntrospectionHandler {
+	config.URL = server.URL
+	if config.ClientID == "" {
+		config.ClientID, config.ClientSecret = "client", "s3cr3t!"
+	}
+
+	handler, err := NewIntrospectionHandler(server.Client(), config)
+	require.Nil(t, err)
+	handler.now = func() time.Time { return testIntrospectionNow }
+	return handler
+}
+
+func activeToken() map[string]interface{} {
+	return map[string]interface{}{
+		"active": true,
+		"sub":    "test",
+		"scope":  "files:read files:write",
+		"aud":    "content-service-api",
+		"exp":    testIntrospectionNow.Add(time.Hour).Unix(),
+	}
+}
+
+func TestIntrospection_ValidateToken_ShouldReturnSubjectAndScopes(t *testing.T) {
+	server := newIntrospectionServer(t, map[string]map[string]interface{}{"test": activeToken()})
+	defer server.Close()
+
+	handler := newTestIntrospectionHandler(t, server, IntrospectionConfig{
+		RequiredScopes: []string{"files:read"},
+		Audience:       "content-service-api",
+	})
+
+	principal, err := handler.ValidateToken("test")
+	require.Nil(t, err)
+	require.Equal(t, &models.Principal{
+		UserID:    "test",
+		Scopes:    []string{"files:read", "files:write"},
+		ExpiresAt: time.Unix(testIntrospectionNow.Add(time.Hour).Unix(), 0),
+	}, principal)
+	require.True(t, principal.HasScope("files:write"))
+}
+
+func TestIntrospection_ValidateToken_ShouldRejectInvalidTokens(t *testing.T) {
+	tokens := map[string]map[string]interface{}{}
+	modify := map[string]func(map[string]interface{}){
+		"token is not active":                    func(r map[string]interface{}) { r["active"] = false },
+		"token has expired":                      func(r map[string]interface{}) { r["exp"] = testIntrospectionNow.Unix() },
+		"token is missing scope 'files:read'":    func(r map[string]interface{}) { r["scope"] = "files:write" },
+		"token was not issued for this audience": func(r map[string]interface{}) { r["aud"] = []string{"test"} },
+		"token has no subject":                   func(r map[string]interface{}) { delete(r, "sub") },
+	}
+	for reason, m := range modify {
+		response := activeToken()
+		m(response)
+		tokens[reason] = response
+	}
+
+	server := newIntrospectionServer(t, tokens)
+	defer server.Close()
+
+	handler := newTestIntrospectionHandler(t, server, IntrospectionConfig{
+		RequiredScopes: []string{"files:read"},
+		Audience:       "content-service-api",
+	})
+
+	for reason := range tokens {
+		_, err := handler.ValidateToken(reason)
+		require.NotNil(t, err, reason)
+		require.Equal(t, "invalid token: "+reason, err.Error())
+		require.True(t, IsRejected(err))
+	}
+
+	_, err := handler.ValidateToken("unknown")
+	require.NotNil(t, err)
+	require.True(t, IsRejected(err))
+}
+
+func TestIntrospection_ValidateToken_ShouldFallBackToUsername(t *testing.T) {
+	response := activeToken()
+	delete(response, "sub")
+	response["username"] = "user"
+
+	server := newIntrospectionServer(t, map[string]map[string]interface{}{"test": response})
+	defer server.Close()
+
+	principal, err := newTestIntrospectionHandler(t, server, IntrospectionConfig{}).ValidateToken("test")
+	require.Nil(t, err)
+	require.Equal(t, "user", principal.UserID)
+}
+
+func TestIntrospection_ValidateToken_ShouldNotRejectTokenIfClientIsUnauthorized(t *testing.T) {
+	server := newIntrospectionServer(t, map[string]map[string]interface{}{"test": activeToken()})
+	defer server.Close()
+
+	handler := newTestIntrospectionHandler(t, server, IntrospectionConfig{ClientID: "client", ClientSecret: "wrong"})
+
+	_, err := handler.ValidateToken("test")
+	require.NotNil(t, err)
+	require.False(t, IsRejected(err))
+}
+
+func TestIntrospection_ValidateToken_ShouldNotBeCachedPastExpiry(t *testing.T) {
+	response := activeToken()
+	response["exp"] = testIntrospectionNow.Add(time.Minute).Unix()
+
+	requests := 0
+	server := newIntrospectionServer(t, map[string]map[string]interface{}{"test": response})
+	defer server.Close()
+
+	handler := newTestIntrospectionHandler(t, server, IntrospectionConfig{})
+	counting := &countingHandler{next: handler, count: &requests}
+
+	cache := NewCachingHandler(counting, CacheConfig{TTL: time.Hour})
+	now := testIntrospectionNow
+	cache.now = func() time.Time { return now }
+
+	_, err := cache.ValidateToken("test")
+	require.Nil(t, err)
+
+	now = now.Add(30 * time.Second)
+	_, err = cache.ValidateToken("test")
+	require.Nil(t, err)
+	require.Equal(t, 1, requests)
+
+	now = now.Add(30 * time.Second)
+	handler.now = func() time.Time { return now }
+	_, err = cache.ValidateToken("test")
+	require.NotNil(t, err)
+	require.Equal(t, 2, requests)
+}
+
+type countingHandler struct {
+	next  ExtHandler
+	count *int
+}
+
+func (c *countingHandler) ValidateToken(token string) (*models.Principal, error) {
+	*c.count++
+	return c.next.ValidateToken(token)
+}
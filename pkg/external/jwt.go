@@ -0,0 +1,403 @@
+package external
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"content-service-api/models"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	DefaultJWKSRefreshInterval = time.Hour
+	DefaultJWTLeeway           = 30 * time.Second
+
+	// minJWKSRefreshInterval limits how often an unknown key ID can force the key set to be fetched
+	// again, so that tokens with made up key IDs cannot be used to hammer the identity provider.
+	minJWKSRefreshInterval = time.Minute
+)
+
+// JWTConfig describes which tokens JWTHandler accepts. Issuer and Audience are only checked when set.
+// RefreshInterval is how long a fetched key set is used before it is fetched again, and Leeway is
+// the clock skew allowed when checking exp and nbf.
+type JWTConfig struct {
+	JWKSURL         string
+	Issuer          string
+	Audience        string
+	RefreshInterval time.Duration
+	Leeway          time.Duration
+}
+
+// JWTHandler validates RS256 and ES256 signed JWTs locally against the keys published in a JWKS
+// document. The subject of the token becomes the principal's user ID and its roles claim the
+// principal's roles.
+type JWTHandler struct {
+	HttpClient Requestor
+	Config     JWTConfig
+
+	now func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetched   time.Time
+	attempted time.Time
+	fetchErr  error
+	fetches   singleflight.Group
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	Expires   *int64      `json:"exp"`
+	NotBefore *int64      `json:"nbf"`
+	Roles     []string    `json:"roles"`
+}
+
+// jwtAudience accepts the aud claim as either a single string or a list of strings.
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("aud must be a string or a list of strings")
+	}
+	*a = list
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func NewJWTHandler(client Requestor, config JWTConfig) (*JWTHandler, error) {
+	if config.JWKSURL == "" {
+		return nil, errors.New("jwks url cannot be empty")
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = DefaultJWKSRefreshInterval
+	}
+	if config.Leeway < 0 {
+		config.Leeway = 0
+	}
+
+	return &JWTHandler{
+		HttpClient: client,
+		Config:     config,
+		now:        time.Now,
+	}, nil
+}
+
+// ValidateToken verifies the token's signature and claims and returns the principal it identifies.
+func (j *JWTHandler) ValidateToken(token string) (*models.Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, &TokenError{Reason: "token is not a JWT"}
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, &TokenError{Reason: fmt.Sprintf("malformed header: %v", err)}
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, &TokenError{Reason: "malformed signature"}
+	}
+
+	key, err := j.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, &TokenError{Reason: fmt.Sprintf("malformed claims: %v", err)}
+	}
+
+	if err := j.checkClaims(&claims); err != nil {
+		return nil, err
+	}
+
+	return &models.Principal{
+		UserID:    claims.Subject,
+		Roles:     claims.Roles,
+		ExpiresAt: time.Unix(*claims.Expires, 0),
+	}, nil
+}
+
+func (j *JWTHandler) checkClaims(claims *jwtClaims) error {
+	now := j.now()
+
+	if claims.Expires == nil {
+		return &TokenError{Reason: "token has no expiry"}
+	} else if !now.Before(time.Unix(*claims.Expires, 0).Add(j.Config.Leeway)) {
+		return &TokenError{Reason: "token has expired"}
+	}
+
+	if claims.NotBefore != nil && now.Add(j.Config.Leeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return &TokenError{Reason: "token is not valid yet"}
+	}
+
+	if j.Config.Issuer != "" && claims.Issuer != j.Config.Issuer {
+		return &TokenError{Reason: fmt.Sprintf("unexpected issuer '%v'", claims.Issuer)}
+	}
+
+	if j.Config.Audience != "" {
+		found := false
+		for _, aud := range claims.Audience {
+			if aud == j.Config.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &TokenError{Reason: "token was not issued for this audience"}
+		}
+	}
+
+	if claims.Subject == "" {
+		return &TokenError{Reason: "token has no subject"}
+	}
+
+	return nil
+}
+
+// key returns the public key with the given ID. The key set is fetched when it is missing or stale,
+// and also when it does not contain the key, since that usually means the keys have been rotated.
+// Fetches are made without holding the lock, shared by all requests waiting on them, and, successful
+// or not, at most once every minJWKSRefreshInterval.
+func (j *JWTHandler) key(kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	key, ok := j.keys[kid]
+	fresh := j.now().Sub(j.fetched) < j.Config.RefreshInterval
+	throttled := j.now().Sub(j.attempted) < minJWKSRefreshInterval
+	haveKeys, fetchErr := j.keys != nil, j.fetchErr
+	j.mu.Unlock()
+
+	switch {
+	case ok && (fresh || throttled):
+		return key, nil
+	case throttled && haveKeys:
+		return nil, &TokenError{Reason: fmt.Sprintf("unknown key '%v'", kid)}
+	case throttled && fetchErr != nil:
+		return nil, fetchErr
+	}
+
+	keys, err, _ := j.fetches.Do("", func() (interface{}, error) {
+		keys, err := j.fetchKeys()
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.attempted = j.now()
+		j.fetchErr = err
+		if err != nil {
+			return nil, err
+		}
+		j.keys = keys
+		j.fetched = j.attempted
+		return keys, nil
+	})
+	if err != nil {
+		if ok {
+			logrus.WithError(err).Warn("Error refreshing JWKS, continuing with previously fetched keys")
+			return key, nil
+		}
+		return nil, err
+	}
+
+	if key, ok = keys.(map[string]crypto.PublicKey)[kid]; !ok {
+		return nil, &TokenError{Reason: fmt.Sprintf("unknown key '%v'", kid)}
+	}
+	return key, nil
+}
+
+func (j *JWTHandler) fetchKeys() (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequest(http.MethodGet, j.Config.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := j.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Body != nil {
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				logrus.WithError(err).Error("Error closing response body")
+			}
+		}()
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	if resp.Body == nil {
+		return nil, errors.New("jwks response was empty")
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("error decoding jwks: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			logrus.WithError(err).WithField("kid", k.Kid).Warn("Skipping unusable JWKS key")
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve '%v'", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type '%v'", k.Kty)
+	}
+}
+
+// verifySignature checks signature over signed for the given algorithm. The algorithm must match the
+// type of the key, so that a token cannot pick a weaker or different scheme than the key was issued for.
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return &TokenError{Reason: "algorithm does not match key"}
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return &TokenError{Reason: "signature verification failed"}
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return &TokenError{Reason: "algorithm does not match key"}
+		}
+		if len(signature) != 64 {
+			return &TokenError{Reason: "signature verification failed"}
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return &TokenError{Reason: "signature verification failed"}
+		}
+	default:
+		return &TokenError{Reason: fmt.Sprintf("unsupported algorithm '%v'", alg)}
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	} else if len(data) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// ChainHandler tries each handler in turn and returns the first principal one of them produces. If
+// they all fail, the error from the last one is returned.
+type ChainHandler []ExtHandler
+
+func (c ChainHandler) ValidateToken(token string) (*models.Principal, error) {
+	err := errors.New("no token validators configured")
+	for _, handler := range c {
+		var principal *models.Principal
+		if principal, err = handler.ValidateToken(token); err == nil {
+			return principal, nil
+		}
+	}
+	return nil, err
+}
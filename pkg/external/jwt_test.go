@@ -0,0 +1,385 @@
+package external
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"content-service-api/models"
+	"content-service-api/pkg/testhelper/mocks"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	testECKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testJWTNow    = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func encodeSegment(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signJWT(t *testing.T, alg string, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encodeSegment(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case "RS256":
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, digest[:])
+		require.Nil(t, err)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, testECKey, digest[:])
+		require.Nil(t, err)
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":   "test",
+		"iss":   "https://login.example.com",
+		"aud":   []string{"content-service-api"},
+		"exp":   testJWTNow.Add(time.Hour).Unix(),
+		"nbf":   testJWTNow.Add(-time.Minute).Unix(),
+		"roles": []string{"admin"},
+	}
+}
+
+func jwksResponse(keys map[string]crypto.PublicKey) func(*http.Request) *http.Response {
+	set := map[string][]map[string]string{"keys": {}}
+	for kid, key := range keys {
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			set["keys"] = append(set["keys"], map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			set["keys"] = append(set["keys"], map[string]string{
+				"kty": "EC",
+				"kid": kid,
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(k.X.Bytes()),
+				"y":   base64.RawURLEncoding.EncodeToString(k.Y.Bytes()),
+			})
+		}
+	}
+	body, _ := json.Marshal(set)
+
+	return func(*http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(string(body)))}
+	}
+}
+
+func newTestJWTHandler(t *testing.T, requestor *mocks.Requestor) *JWTHandler {
+	handler, err := NewJWTHandler(requestor, JWTConfig{
+		JWKSURL:  "https://login.example.com/.well-known/jwks.json",
+		Issuer:   "https://login.example.com",
+		Audience: "content-service-api",
+	})
+	require.Nil(t, err)
+	handler.now = func() time.Time { return testJWTNow }
+	return handler
+}
+
+func TestJWT_ValidateToken_ShouldAcceptValidTokens(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jwksResponse(map[string]crypto.PublicKey{
+		"rsa": &testRSAKey.PublicKey,
+		"ec":  &testECKey.PublicKey,
+	}), nil)
+
+	handler := newTestJWTHandler(t, requestor)
+
+	for alg, kid := range map[string]string{"RS256": "rsa", "ES256": "ec"} {
+		principal, err := handler.ValidateToken(signJWT(t, alg, kid, validClaims()))
+		require.Nil(t, err, alg)
+		require.Equal(t, &models.Principal{
+			UserID:    "test",
+			Roles:     []string{"admin"},
+			ExpiresAt: time.Unix(testJWTNow.Add(time.Hour).Unix(), 0),
+		}, principal)
+	}
+	requestor.AssertNumberOfCalls(t, "Do", 1)
+}
+
+func TestJWT_ValidateToken_ShouldRejectInvalidClaims(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jwksResponse(map[string]crypto.PublicKey{"rsa": &testRSAKey.PublicKey}), nil)
+
+	handler := newTestJWTHandler(t, requestor)
+
+	tests := map[string]func(claims map[string]interface{}){
+		"token has expired":                      func(c map[string]interface{}) { c["exp"] = testJWTNow.Add(-time.Minute).Unix() },
+		"token has no expiry":                    func(c map[string]interface{}) { delete(c, "exp") },
+		"token is not valid yet":                 func(c map[string]interface{}) { c["nbf"] = testJWTNow.Add(time.Minute).Unix() },
+		"unexpected issuer 'test'":               func(c map[string]interface{}) { c["iss"] = "test" },
+		"token was not issued for this audience": func(c map[string]interface{}) { c["aud"] = "test" },
+		"token has no subject":                   func(c map[string]interface{}) { delete(c, "sub") },
+	}
+
+	for reason, modify := range tests {
+		claims := validClaims()
+		modify(claims)
+
+		_, err := handler.ValidateToken(signJWT(t, "RS256", "rsa", claims))
+		require.NotNil(t, err, reason)
+		require.Equal(t, "invalid token: "+reason, err.Error())
+		require.True(t, IsRejected(err))
+	}
+}
+
+func TestJWT_ValidateToken_ShouldAllowClockSkewWithinLeeway(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jwksResponse(map[string]crypto.PublicKey{"rsa": &testRSAKey.PublicKey}), nil)
+
+	handler := newTestJWTHandler(t, requestor)
+	handler.Config.Leeway = time.Minute
+
+	claims := validClaims()
+	claims["exp"] = testJWTNow.Add(-30 * time.Second).Unix()
+
+	_, err := handler.ValidateToken(signJWT(t, "RS256", "rsa", claims))
+	require.Nil(t, err)
+}
+
+func TestJWT_ValidateToken_ShouldRejectBadSignatures(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jwksResponse(map[string]crypto.PublicKey{
+		"rsa": &testRSAKey.PublicKey,
+		"ec":  &testECKey.PublicKey,
+	}), nil)
+
+	handler := newTestJWTHandler(t, requestor)
+
+	token := signJWT(t, "RS256", "rsa", validClaims())
+	parts := strings.Split(token, ".")
+	claims := validClaims()
+	claims["roles"] = []string{"admin", "superuser"}
+	tampered := parts[0] + "." + encodeSegment(claims) + "." + parts[2]
+
+	_, err := handler.ValidateToken(tampered)
+	require.NotNil(t, err)
+	require.Equal(t, "invalid token: signature verification failed", err.Error())
+
+	_, err = handler.ValidateToken(signJWT(t, "ES256", "rsa", validClaims()))
+	require.NotNil(t, err)
+	require.Equal(t, "invalid token: algorithm does not match key", err.Error())
+
+	unsigned := encodeSegment(map[string]string{"alg": "none", "kid": "rsa"}) + "." + encodeSegment(validClaims()) + "."
+	_, err = handler.ValidateToken(unsigned)
+	require.NotNil(t, err)
+	require.Equal(t, "invalid token: unsupported algorithm 'none'", err.Error())
+
+	_, err = handler.ValidateToken("test")
+	require.NotNil(t, err)
+	require.True(t, IsRejected(err))
+}
+
+func TestJWT_ValidateToken_ShouldRefetchKeysOnRotation(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jwksResponse(map[string]crypto.PublicKey{"rsa": &testRSAKey.PublicKey}), nil).Once()
+	requestor.On("Do", mock.Anything).Return(jwksResponse(map[string]crypto.PublicKey{"ec": &testECKey.PublicKey}), nil).Once()
+
+	handler := newTestJWTHandler(t, requestor)
+	now := testJWTNow
+	handler.now = func() time.Time { return now }
+
+	_, err := handler.ValidateToken(signJWT(t, "RS256", "rsa", validClaims()))
+	require.Nil(t, err)
+
+	// Unknown key IDs only trigger a refetch once the current key set is old enough.
+	_, err = handler.ValidateToken(signJWT(t, "ES256", "ec", validClaims()))
+	require.NotNil(t, err)
+	require.Equal(t, "invalid token: unknown key 'ec'", err.Error())
+	requestor.AssertNumberOfCalls(t, "Do", 1)
+
+	now = now.Add(minJWKSRefreshInterval)
+	_, err = handler.ValidateToken(signJWT(t, "ES256", "ec", validClaims()))
+	require.Nil(t, err)
+	requestor.AssertNumberOfCalls(t, "Do", 2)
+}
+
+func TestJWT_ValidateToken_ShouldKeepUsingKeysIfRefreshFails(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jwksResponse(map[string]crypto.PublicKey{"rsa": &testRSAKey.PublicKey}), nil).Once()
+	requestor.On("Do", mock.Anything).Return(nil, errors.New("test"))
+
+	handler := newTestJWTHandler(t, requestor)
+	now := testJWTNow
+	handler.now = func() time.Time { return now }
+
+	_, err := handler.ValidateToken(signJWT(t, "RS256", "rsa", validClaims()))
+	require.Nil(t, err)
+
+	now = now.Add(DefaultJWKSRefreshInterval)
+	claims := validClaims()
+	claims["exp"] = now.Add(time.Hour).Unix()
+	_, err = handler.ValidateToken(signJWT(t, "RS256", "rsa", claims))
+	require.Nil(t, err)
+	requestor.AssertNumberOfCalls(t, "Do", 2)
+}
+
+func TestJWT_ValidateToken_ShouldReturnErrorIfKeysCannotBeFetched(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusInternalServerError}, nil)
+
+	handler := newTestJWTHandler(t, requestor)
+
+	_, err := handler.ValidateToken(signJWT(t, "RS256", "rsa", validClaims()))
+	require.NotNil(t, err)
+	require.False(t, IsRejected(err))
+}
+
+func TestJWT_ValidateToken_ShouldFetchKeysOnceWithoutBlockingKnownKeys(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jwksResponse(map[string]crypto.PublicKey{"rsa": &testRSAKey.PublicKey}), nil).Once()
+	requestor.On("Do", mock.Anything).Return(jwksResponse(map[string]crypto.PublicKey{
+		"rsa": &testRSAKey.PublicKey,
+		"ec":  &testECKey.PublicKey,
+	}), nil).Run(func(mock.Arguments) {
+		close(started)
+		<-release
+	})
+
+	handler := newTestJWTHandler(t, requestor)
+	now := testJWTNow
+	var mu sync.Mutex
+	handler.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	_, err := handler.ValidateToken(signJWT(t, "RS256", "rsa", validClaims()))
+	require.Nil(t, err)
+
+	mu.Lock()
+	now = now.Add(minJWKSRefreshInterval)
+	mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := handler.ValidateToken(signJWT(t, "ES256", "ec", validClaims()))
+			errs <- err
+		}()
+	}
+
+	// Tokens signed with known keys are validated while the key set is being fetched.
+	<-started
+	validated := make(chan error, 1)
+	go func() {
+		_, err := handler.ValidateToken(signJWT(t, "RS256", "rsa", validClaims()))
+		validated <- err
+	}()
+	select {
+	case err := <-validated:
+		require.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("validation waited for the key set to be fetched")
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.Nil(t, err)
+	}
+	requestor.AssertNumberOfCalls(t, "Do", 2)
+}
+
+func TestJWT_ValidateToken_ShouldLimitRetriesOfFailedFetches(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(jwksResponse(map[string]crypto.PublicKey{"rsa": &testRSAKey.PublicKey}), nil).Once()
+	requestor.On("Do", mock.Anything).Return(nil, errors.New("test"))
+
+	handler := newTestJWTHandler(t, requestor)
+	now := testJWTNow
+	handler.now = func() time.Time { return now }
+
+	_, err := handler.ValidateToken(signJWT(t, "RS256", "rsa", validClaims()))
+	require.Nil(t, err)
+
+	now = now.Add(DefaultJWKSRefreshInterval)
+	claims := validClaims()
+	claims["exp"] = now.Add(2 * time.Hour).Unix()
+	for i := 0; i < 3; i++ {
+		_, err = handler.ValidateToken(signJWT(t, "RS256", "rsa", claims))
+		require.Nil(t, err)
+		_, err = handler.ValidateToken(signJWT(t, "ES256", "ec", claims))
+		require.NotNil(t, err)
+	}
+	requestor.AssertNumberOfCalls(t, "Do", 2)
+
+	now = now.Add(minJWKSRefreshInterval)
+	_, err = handler.ValidateToken(signJWT(t, "RS256", "rsa", claims))
+	require.Nil(t, err)
+	requestor.AssertNumberOfCalls(t, "Do", 3)
+}
+
+func TestJWT_ValidateToken_ShouldLimitRetriesIfKeysWereNeverFetched(t *testing.T) {
+	requestor := &mocks.Requestor{}
+	requestor.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusInternalServerError}, nil)
+
+	handler := newTestJWTHandler(t, requestor)
+
+	for i := 0; i < 3; i++ {
+		_, err := handler.ValidateToken(signJWT(t, "RS256", "rsa", validClaims()))
+		require.NotNil(t, err)
+		require.False(t, IsRejected(err))
+	}
+	requestor.AssertNumberOfCalls(t, "Do", 1)
+}
+
+func TestChain_ValidateToken_ShouldFallBackToNextHandler(t *testing.T) {
+	jwtRequestor := &mocks.Requestor{}
+	jwtRequestor.On("Do", mock.Anything).Return(jwksResponse(map[string]crypto.PublicKey{"rsa": &testRSAKey.PublicKey}), nil)
+
+	remoteRequestor := &mocks.Requestor{}
+	remoteRequestor.On("Do", mock.Anything).Return(tokenResponse(http.StatusOK, `{"userId": "remote"}`), nil)
+
+	chain := ChainHandler{
+		newTestJWTHandler(t, jwtRequestor),
+		&Handler{HttpClient: remoteRequestor, LoginServiceURL: "test"},
+	}
+
+	principal, err := chain.ValidateToken(signJWT(t, "RS256", "rsa", validClaims()))
+	require.Nil(t, err)
+	require.Equal(t, "test", principal.UserID)
+	remoteRequestor.AssertNotCalled(t, "Do", mock.Anything)
+
+	principal, err = chain.ValidateToken("opaque")
+	require.Nil(t, err)
+	require.Equal(t, "remote", principal.UserID)
+}
@@ -0,0 +1,197 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const metadataPrefix = "meta."
+
+var (
+	// paramPattern splits a query parameter into its field and optional operator, e.g. "size[gt]".
+	paramPattern = regexp.MustCompile(`^([A-Za-z0-9_.-]+)(?:\[([a-z]+)\])?$`)
+	// metadataKeyPattern restricts metadata keys to characters that are safe to use in a Mongo field path.
+	metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+// ValidMetadataKey reports whether key can be used as a metadata key. Keys are stored and queried as
+// part of a Mongo field path, so the same rule applies wherever they are accepted.
+func ValidMetadataKey(key string) bool {
+	return metadataKeyPattern.MatchString(key)
+}
+
+type valueType int
+
+const (
+	stringType valueType = iota
+	intType
+	boolType
+	timeType
+	objectIDType
+	nullableObjectIDType
+)
+
+type field struct {
+	path      string
+	valueType valueType
+	operators map[string]bool
+}
+
+var (
+	equality   = []string{"eq", "ne", "in", "nin"}
+	comparison = []string{"eq", "ne", "gt", "gte", "lt", "lte", "in", "nin"}
+	text       = []string{"eq", "ne", "in", "nin", "prefix"}
+)
+
+// fields lists everything GET /files can filter on, keyed by query parameter name. Anything else is
+// rejected rather than passed through to the database.
+var fields = map[string]field{
+	"id":        newField("_id", objectIDType, equality),
+	"name":      newField("name", stringType, text),
+	"extension": newField("extension", stringType, equality),
+	"size":      newField("size", intType, comparison),
+	"timestamp": newField("timestamp", timeType, comparison),
+	"hidden":    newField("hidden", boolType, []string{"eq", "ne"}),
+	"hash":      newField("hash", stringType, equality),
+	"version":   newField("version", intType, comparison),
+	"parent":    newField("parent", nullableObjectIDType, equality),
+	"tag":       newField("tags", stringType, []string{"eq", "ne", "in", "nin", "all"}),
+	"owner":     newField("owner", stringType, equality),
+}
+
+var metadataField = newField("", stringType, text)
+
+func newField(path string, valueType valueType, operators []string) field {
+	f := field{path: path, valueType: valueType, operators: make(map[string]bool)}
+	for _, operator := range operators {
+		f.operators[operator] = true
+	}
+	return f
+}
+
+// Parse converts query parameters into a Mongo filter. Parameters take the form field=value or
+// field[op]=value, where op is one of eq (the default), ne, gt, gte, lt, lte, in, nin, all or prefix
+// depending on the field; in, nin and all take comma separated lists. Values are converted to the field's
+// type, and only known fields and operators are accepted, so no part of the input can end up being
+// interpreted as a Mongo operator. Prefixes are matched literally; arbitrary regular expressions are not
+// offered, since Mongo evaluates them with a backtracking engine. Parameters named in ignore are skipped.
+func Parse(params map[string][]string, ignore ...string) (map[string]interface{}, error) {
+	skip := make(map[string]bool)
+	for _, name := range ignore {
+		skip[name] = true
+	}
+
+	query := make(map[string]interface{})
+	for param, values := range params {
+		if skip[param] {
+			continue
+		}
+
+		match := paramPattern.FindStringSubmatch(param)
+		if match == nil {
+			return nil, fmt.Errorf("invalid filter parameter '%v'", param)
+		}
+
+		name, operator := match[1], match[2]
+		if operator == "" {
+			operator = "eq"
+		}
+
+		f, ok := fields[name]
+		if strings.HasPrefix(name, metadataPrefix) {
+			key := strings.TrimPrefix(name, metadataPrefix)
+			if !ValidMetadataKey(key) {
+				return nil, fmt.Errorf("invalid metadata key '%v'", key)
+			}
+			f, ok = metadataField, true
+			f.path = "metadata." + key
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("unknown filter field '%v'", name)
+		} else if !f.operators[operator] {
+			return nil, fmt.Errorf("operator '%v' is not supported for field '%v'", operator, name)
+		}
+
+		// Repeating a tag means the file must carry all of them; anything else may only be given once.
+		if len(values) > 1 {
+			if f.path != "tags" || operator != "eq" {
+				return nil, fmt.Errorf("filter parameter '%v' given more than once", param)
+			}
+			operator = "all"
+			values = []string{strings.Join(values, ",")}
+		}
+
+		condition, err := buildCondition(f, operator, values[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for '%v': %v", param, err)
+		}
+
+		conditions, _ := query[f.path].(map[string]interface{})
+		if conditions == nil {
+			conditions = make(map[string]interface{})
+			query[f.path] = conditions
+		}
+		for key, val := range condition {
+			conditions[key] = val
+		}
+	}
+
+	return query, nil
+}
+
+func buildCondition(f field, operator string, raw string) (map[string]interface{}, error) {
+	switch operator {
+	case "in", "nin", "all":
+		list := make([]interface{}, 0)
+		for _, item := range strings.Split(raw, ",") {
+			value, err := convert(f.valueType, item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return map[string]interface{}{"$" + operator: list}, nil
+	case "prefix":
+		return map[string]interface{}{"$regex": "^" + regexp.QuoteMeta(raw)}, nil
+	default:
+		value, err := convert(f.valueType, raw)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"$" + operator: value}, nil
+	}
+}
+
+func convert(valueType valueType, raw string) (interface{}, error) {
+	switch valueType {
+	case intType:
+		return strconv.ParseInt(raw, 10, 64)
+	case boolType:
+		return strconv.ParseBool(raw)
+	case timeType:
+		return parseTime(raw)
+	case objectIDType:
+		return primitive.ObjectIDFromHex(raw)
+	case nullableObjectIDType:
+		if raw == "" || raw == "null" || raw == "root" {
+			return nil, nil
+		}
+		return primitive.ObjectIDFromHex(raw)
+	default:
+		return raw, nil
+	}
+}
+
+// parseTime accepts RFC 3339 timestamps as well as plain dates, which are taken as midnight UTC.
+func parseTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
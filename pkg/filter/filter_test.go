@@ -0,0 +1,149 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFilter_Parse_ShouldReturnEmptyQueryForNoParameters(t *testing.T) {
+	query, err := Parse(map[string][]string{})
+	require.Nil(t, err)
+	require.Empty(t, query)
+}
+
+func TestFilter_Parse_ShouldConvertValuesToFieldTypes(t *testing.T) {
+	query, err := Parse(map[string][]string{
+		"size":      {"1024"},
+		"hidden":    {"false"},
+		"timestamp": {"2026-01-02T03:04:05Z"},
+		"name":      {"report.pdf"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, map[string]interface{}{
+		"size":      map[string]interface{}{"$eq": int64(1024)},
+		"hidden":    map[string]interface{}{"$eq": false},
+		"timestamp": map[string]interface{}{"$eq": time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC)},
+		"name":      map[string]interface{}{"$eq": "report.pdf"},
+	}, query)
+}
+
+func TestFilter_Parse_ShouldCombineComparisonOperatorsOnTheSameField(t *testing.T) {
+	query, err := Parse(map[string][]string{
+		"size[gt]":      {"10"},
+		"size[lte]":     {"20"},
+		"timestamp[lt]": {"2026-03-01"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, map[string]interface{}{
+		"size":      map[string]interface{}{"$gt": int64(10), "$lte": int64(20)},
+		"timestamp": map[string]interface{}{"$lt": time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)},
+	}, query)
+}
+
+func TestFilter_Parse_ShouldSplitListOperators(t *testing.T) {
+	query, err := Parse(map[string][]string{
+		"extension[in]": {".pdf,.docx"},
+		"size[nin]":     {"1,2"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, map[string]interface{}{
+		"extension": map[string]interface{}{"$in": []interface{}{".pdf", ".docx"}},
+		"size":      map[string]interface{}{"$nin": []interface{}{int64(1), int64(2)}},
+	}, query)
+}
+
+func TestFilter_Parse_ShouldEscapePrefixSearches(t *testing.T) {
+	query, err := Parse(map[string][]string{"name[prefix]": {"q3.(draft)"}})
+	require.Nil(t, err)
+	require.Equal(t, map[string]interface{}{
+		"name": map[string]interface{}{"$regex": `^q3\.\(draft\)`},
+	}, query)
+}
+
+func TestFilter_Parse_ShouldRejectRegex(t *testing.T) {
+	_, err := Parse(map[string][]string{"name[regex]": {"^(a+)+$"}})
+	require.NotNil(t, err)
+}
+
+func TestFilter_Parse_ShouldTranslateTagsAndMetadata(t *testing.T) {
+	query, err := Parse(map[string][]string{
+		"tag":           {"invoice", "paid"},
+		"meta.customer": {"acme"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, map[string]interface{}{
+		"tags":              map[string]interface{}{"$all": []interface{}{"invoice", "paid"}},
+		"metadata.customer": map[string]interface{}{"$eq": "acme"},
+	}, query)
+}
+
+func TestFilter_Parse_ShouldParseObjectIDsAndRootParent(t *testing.T) {
+	id, err := primitive.ObjectIDFromHex("5df25cc42d811e3b6b945c08")
+	require.Nil(t, err)
+
+	query, err := Parse(map[string][]string{"id": {"5df25cc42d811e3b6b945c08"}, "parent": {"root"}})
+	require.Nil(t, err)
+	require.Equal(t, map[string]interface{}{
+		"_id":    map[string]interface{}{"$eq": id},
+		"parent": map[string]interface{}{"$eq": nil},
+	}, query)
+}
+
+func TestFilter_Parse_ShouldRejectUnknownFields(t *testing.T) {
+	_, err := Parse(map[string][]string{"fileBytes": {"test"}})
+	require.NotNil(t, err)
+	require.Equal(t, "unknown filter field 'fileBytes'", err.Error())
+}
+
+func TestFilter_Parse_ShouldRejectUnsupportedOperators(t *testing.T) {
+	_, err := Parse(map[string][]string{"hidden[gt]": {"true"}})
+	require.NotNil(t, err)
+
+	_, err = Parse(map[string][]string{"size[where]": {"1"}})
+	require.NotNil(t, err)
+}
+
+func TestFilter_Parse_ShouldRejectMongoOperatorsInParameterNames(t *testing.T) {
+	_, err := Parse(map[string][]string{"$where": {"1"}})
+	require.NotNil(t, err)
+
+	_, err = Parse(map[string][]string{"size[$gt]": {"1"}})
+	require.NotNil(t, err)
+
+	_, err = Parse(map[string][]string{"meta.$where": {"1"}})
+	require.NotNil(t, err)
+}
+
+func TestFilter_Parse_ShouldRejectInvalidValues(t *testing.T) {
+	_, err := Parse(map[string][]string{"size": {"big"}})
+	require.NotNil(t, err)
+
+	_, err = Parse(map[string][]string{"hidden": {"maybe"}})
+	require.NotNil(t, err)
+
+	_, err = Parse(map[string][]string{"timestamp[gt]": {"yesterday"}})
+	require.NotNil(t, err)
+}
+
+func TestFilter_Parse_ShouldRejectRepeatedParameters(t *testing.T) {
+	_, err := Parse(map[string][]string{"size": {"1", "2"}})
+	require.NotNil(t, err)
+}
+
+func TestFilter_Parse_ShouldSkipIgnoredParameters(t *testing.T) {
+	query, err := Parse(map[string][]string{"limit": {"10"}, "size": {"1"}}, "limit")
+	require.Nil(t, err)
+	require.Equal(t, map[string]interface{}{"size": map[string]interface{}{"$eq": int64(1)}}, query)
+}
+
+func TestFilter_ValidMetadataKey_ShouldOnlyAcceptFieldPathSafeKeys(t *testing.T) {
+	require.True(t, ValidMetadataKey("project_id-2"))
+	require.False(t, ValidMetadataKey(""))
+	require.False(t, ValidMetadataKey("a.b"))
+	require.False(t, ValidMetadataKey("$where"))
+	require.False(t, ValidMetadataKey(strings.Repeat("a", 65)))
+}
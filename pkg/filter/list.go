@@ -0,0 +1,96 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"content-service-api/models"
+)
+
+// ListParams are the query parameters read by ParseListOptions rather than Parse.
+var ListParams = []string{"limit", "next", "sort", "fields"}
+
+var sortable = map[string]bool{
+	"id":        true,
+	"name":      true,
+	"extension": true,
+	"size":      true,
+	"timestamp": true,
+}
+
+var projectable = map[string]bool{
+	"id":          true,
+	"name":        true,
+	"timestamp":   true,
+	"extension":   true,
+	"size":        true,
+	"contentType": true,
+	"fileBytes":   true,
+	"hash":        true,
+	"hidden":      true,
+	"parent":      true,
+	"tags":        true,
+	"metadata":    true,
+	"owner":       true,
+	"grants":      true,
+	"version":     true,
+}
+
+// ParseListOptions reads the paging parameters of a listing: limit, the opaque next token from a
+// previous page, sort as a comma separated list of fields each optionally prefixed with '-' for
+// descending order, and fields as a comma separated list of the fields to return.
+func ParseListOptions(params map[string][]string) (*models.ListOptions, error) {
+	for _, param := range ListParams {
+		if len(params[param]) > 1 {
+			return nil, fmt.Errorf("parameter '%v' given more than once", param)
+		}
+	}
+
+	listOptions := &models.ListOptions{Limit: models.DefaultPageSize}
+
+	if limit := first(params["limit"]); limit != "" {
+		value, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || value < 1 || value > models.MaxPageSize {
+			return nil, fmt.Errorf("limit must be between 1 and %v", models.MaxPageSize)
+		}
+		listOptions.Limit = value
+	}
+
+	listOptions.Next = first(params["next"])
+
+	if sort := first(params["sort"]); sort != "" {
+		seen := make(map[string]bool)
+		for _, item := range strings.Split(sort, ",") {
+			field := models.SortField{Field: strings.TrimPrefix(item, "-"), Descending: strings.HasPrefix(item, "-")}
+			if !sortable[field.Field] {
+				return nil, fmt.Errorf("cannot sort by '%v'", field.Field)
+			} else if seen[field.Field] {
+				return nil, fmt.Errorf("sort field '%v' given more than once", field.Field)
+			}
+			seen[field.Field] = true
+			listOptions.Sort = append(listOptions.Sort, field)
+		}
+	}
+
+	if fields := first(params["fields"]); fields != "" {
+		seen := make(map[string]bool)
+		for _, field := range strings.Split(fields, ",") {
+			if !projectable[field] {
+				return nil, fmt.Errorf("unknown field '%v'", field)
+			} else if !seen[field] {
+				seen[field] = true
+				listOptions.Fields = append(listOptions.Fields, field)
+			}
+		}
+	}
+
+	return listOptions, nil
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,51 @@
+package filter
+
+import (
+	"testing"
+
+	"content-service-api/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter_ParseListOptions_ShouldApplyDefaults(t *testing.T) {
+	listOptions, err := ParseListOptions(map[string][]string{})
+	require.Nil(t, err)
+	require.Equal(t, &models.ListOptions{Limit: models.DefaultPageSize}, listOptions)
+}
+
+func TestFilter_ParseListOptions_ShouldParseAllParameters(t *testing.T) {
+	listOptions, err := ParseListOptions(map[string][]string{
+		"limit":  {"25"},
+		"next":   {"token"},
+		"sort":   {"-timestamp,name"},
+		"fields": {"id,name,name,size"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, &models.ListOptions{
+		Limit:  25,
+		Next:   "token",
+		Sort:   []models.SortField{{Field: "timestamp", Descending: true}, {Field: "name"}},
+		Fields: []string{"id", "name", "size"},
+	}, listOptions)
+}
+
+func TestFilter_ParseListOptions_ShouldRejectInvalidLimits(t *testing.T) {
+	for _, limit := range []string{"0", "-1", "501", "ten"} {
+		_, err := ParseListOptions(map[string][]string{"limit": {limit}})
+		require.NotNil(t, err, limit)
+	}
+}
+
+func TestFilter_ParseListOptions_ShouldRejectUnsortableFields(t *testing.T) {
+	_, err := ParseListOptions(map[string][]string{"sort": {"tags"}})
+	require.NotNil(t, err)
+
+	_, err = ParseListOptions(map[string][]string{"sort": {"name,-name"}})
+	require.NotNil(t, err)
+}
+
+func TestFilter_ParseListOptions_ShouldRejectUnknownFields(t *testing.T) {
+	_, err := ParseListOptions(map[string][]string{"fields": {"id,versions"}})
+	require.NotNil(t, err)
+}
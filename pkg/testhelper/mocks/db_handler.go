@@ -5,6 +5,10 @@ package mocks
 import (
 	context "context"
 
+	dao "content-service-api/pkg/dao"
+
+	io "io"
+
 	mock "github.com/stretchr/testify/mock"
 
 	models "content-service-api/models"
@@ -17,6 +21,189 @@ type DBHandler struct {
 	mock.Mock
 }
 
+// AppendUpload provides a mock function with given fields: ctx, uploadID, offset, source
+func (_m *DBHandler) AppendUpload(ctx context.Context, uploadID primitive.ObjectID, offset int64, source io.Reader) (*models.Upload, error) {
+	ret := _m.Called(ctx, uploadID, offset, source)
+
+	var r0 *models.Upload
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, int64, io.Reader) *models.Upload); ok {
+		r0 = rf(ctx, uploadID, offset, source)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Upload)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID, int64, io.Reader) error); ok {
+		r1 = rf(ctx, uploadID, offset, source)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ClaimShareDownload provides a mock function with given fields: ctx, shareID
+func (_m *DBHandler) ClaimShareDownload(ctx context.Context, shareID primitive.ObjectID) (*models.Share, error) {
+	ret := _m.Called(ctx, shareID)
+
+	var r0 *models.Share
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) *models.Share); ok {
+		r0 = rf(ctx, shareID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Share)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID) error); ok {
+		r1 = rf(ctx, shareID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CompleteUpload provides a mock function with given fields: ctx, uploadID
+func (_m *DBHandler) CompleteUpload(ctx context.Context, uploadID primitive.ObjectID) (*models.Upload, error) {
+	ret := _m.Called(ctx, uploadID)
+
+	var r0 *models.Upload
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) *models.Upload); ok {
+		r0 = rf(ctx, uploadID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Upload)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID) error); ok {
+		r1 = rf(ctx, uploadID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateAPIKey provides a mock function with given fields: ctx, key
+func (_m *DBHandler) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	ret := _m.Called(ctx, key)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.APIKey) error); ok {
+		r0 = rf(ctx, key)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateFolder provides a mock function with given fields: ctx, folderRequest
+func (_m *DBHandler) CreateFolder(ctx context.Context, folderRequest *models.FolderRequest) (*models.FolderResponse, error) {
+	ret := _m.Called(ctx, folderRequest)
+
+	var r0 *models.FolderResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *models.FolderRequest) *models.FolderResponse); ok {
+		r0 = rf(ctx, folderRequest)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.FolderResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *models.FolderRequest) error); ok {
+		r1 = rf(ctx, folderRequest)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateShare provides a mock function with given fields: ctx, share
+func (_m *DBHandler) CreateShare(ctx context.Context, share *models.Share) error {
+	ret := _m.Called(ctx, share)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Share) error); ok {
+		r0 = rf(ctx, share)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateUpload provides a mock function with given fields: ctx, upload
+func (_m *DBHandler) CreateUpload(ctx context.Context, upload *models.Upload) error {
+	ret := _m.Called(ctx, upload)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Upload) error); ok {
+		r0 = rf(ctx, upload)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteAPIKey provides a mock function with given fields: ctx, keyID
+func (_m *DBHandler) DeleteAPIKey(ctx context.Context, keyID primitive.ObjectID) error {
+	ret := _m.Called(ctx, keyID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) error); ok {
+		r0 = rf(ctx, keyID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteDerived provides a mock function with given fields: ctx, fileID, keep
+func (_m *DBHandler) DeleteDerived(ctx context.Context, fileID primitive.ObjectID, keep string) error {
+	ret := _m.Called(ctx, fileID, keep)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, string) error); ok {
+		r0 = rf(ctx, fileID, keep)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteExpiredUploads provides a mock function with given fields: ctx
+func (_m *DBHandler) DeleteExpiredUploads(ctx context.Context) (int, error) {
+	ret := _m.Called(ctx)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context) int); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeleteFile provides a mock function with given fields: ctx, fileID
 func (_m *DBHandler) DeleteFile(ctx context.Context, fileID primitive.ObjectID) error {
 	ret := _m.Called(ctx, fileID)
@@ -31,16 +218,127 @@ func (_m *DBHandler) DeleteFile(ctx context.Context, fileID primitive.ObjectID)
 	return r0
 }
 
-// GetFile provides a mock function with given fields: ctx, fileID
-func (_m *DBHandler) GetFile(ctx context.Context, fileID primitive.ObjectID) ([]byte, error) {
+// DeleteFolder provides a mock function with given fields: ctx, folderID, recursive
+func (_m *DBHandler) DeleteFolder(ctx context.Context, folderID primitive.ObjectID, recursive bool) error {
+	ret := _m.Called(ctx, folderID, recursive)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, bool) error); ok {
+		r0 = rf(ctx, folderID, recursive)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteShare provides a mock function with given fields: ctx, fileID, shareID
+func (_m *DBHandler) DeleteShare(ctx context.Context, fileID primitive.ObjectID, shareID primitive.ObjectID) error {
+	ret := _m.Called(ctx, fileID, shareID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, primitive.ObjectID) error); ok {
+		r0 = rf(ctx, fileID, shareID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteUpload provides a mock function with given fields: ctx, uploadID
+func (_m *DBHandler) DeleteUpload(ctx context.Context, uploadID primitive.ObjectID) error {
+	ret := _m.Called(ctx, uploadID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) error); ok {
+		r0 = rf(ctx, uploadID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetAPIKeys provides a mock function with given fields: ctx
+func (_m *DBHandler) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []models.APIKey
+	if rf, ok := ret.Get(0).(func(context.Context) []models.APIKey); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.APIKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDerived provides a mock function with given fields: ctx, fileID, sourceHash, kind, variant
+func (_m *DBHandler) GetDerived(ctx context.Context, fileID primitive.ObjectID, sourceHash string, kind string, variant string) (*models.Derived, error) {
+	ret := _m.Called(ctx, fileID, sourceHash, kind, variant)
+
+	var r0 *models.Derived
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, string, string, string) *models.Derived); ok {
+		r0 = rf(ctx, fileID, sourceHash, kind, variant)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Derived)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID, string, string, string) error); ok {
+		r1 = rf(ctx, fileID, sourceHash, kind, variant)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFileByPath provides a mock function with given fields: ctx, path, owner, query
+func (_m *DBHandler) GetFileByPath(ctx context.Context, path []string, owner string, query map[string]interface{}) (*models.FileResponse, error) {
+	ret := _m.Called(ctx, path, owner, query)
+
+	var r0 *models.FileResponse
+	if rf, ok := ret.Get(0).(func(context.Context, []string, string, map[string]interface{}) *models.FileResponse); ok {
+		r0 = rf(ctx, path, owner, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.FileResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []string, string, map[string]interface{}) error); ok {
+		r1 = rf(ctx, path, owner, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFileInfo provides a mock function with given fields: ctx, fileID
+func (_m *DBHandler) GetFileInfo(ctx context.Context, fileID primitive.ObjectID) (*models.FileResponse, error) {
 	ret := _m.Called(ctx, fileID)
 
-	var r0 []byte
-	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) []byte); ok {
+	var r0 *models.FileResponse
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) *models.FileResponse); ok {
 		r0 = rf(ctx, fileID)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]byte)
+			r0 = ret.Get(0).(*models.FileResponse)
 		}
 	}
 
@@ -54,22 +352,303 @@ func (_m *DBHandler) GetFile(ctx context.Context, fileID primitive.ObjectID) ([]
 	return r0, r1
 }
 
-// GetFiles provides a mock function with given fields: ctx, query
-func (_m *DBHandler) GetFiles(ctx context.Context, query map[string]interface{}) ([]models.FileResponse, error) {
-	ret := _m.Called(ctx, query)
+// GetFileVersion provides a mock function with given fields: ctx, fileID, version
+func (_m *DBHandler) GetFileVersion(ctx context.Context, fileID primitive.ObjectID, version int) (*models.FileVersion, error) {
+	ret := _m.Called(ctx, fileID, version)
 
-	var r0 []models.FileResponse
-	if rf, ok := ret.Get(0).(func(context.Context, map[string]interface{}) []models.FileResponse); ok {
-		r0 = rf(ctx, query)
+	var r0 *models.FileVersion
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, int) *models.FileVersion); ok {
+		r0 = rf(ctx, fileID, version)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]models.FileResponse)
+			r0 = ret.Get(0).(*models.FileVersion)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, map[string]interface{}) error); ok {
-		r1 = rf(ctx, query)
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID, int) error); ok {
+		r1 = rf(ctx, fileID, version)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFileVersions provides a mock function with given fields: ctx, fileID
+func (_m *DBHandler) GetFileVersions(ctx context.Context, fileID primitive.ObjectID) ([]models.FileVersion, error) {
+	ret := _m.Called(ctx, fileID)
+
+	var r0 []models.FileVersion
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) []models.FileVersion); ok {
+		r0 = rf(ctx, fileID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.FileVersion)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID) error); ok {
+		r1 = rf(ctx, fileID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFiles provides a mock function with given fields: ctx, query, listOptions
+func (_m *DBHandler) GetFiles(ctx context.Context, query map[string]interface{}, listOptions *models.ListOptions) (*models.FilePage, error) {
+	ret := _m.Called(ctx, query, listOptions)
+
+	var r0 *models.FilePage
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]interface{}, *models.ListOptions) *models.FilePage); ok {
+		r0 = rf(ctx, query, listOptions)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.FilePage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, map[string]interface{}, *models.ListOptions) error); ok {
+		r1 = rf(ctx, query, listOptions)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFolder provides a mock function with given fields: ctx, folderID
+func (_m *DBHandler) GetFolder(ctx context.Context, folderID primitive.ObjectID) (*models.FolderResponse, error) {
+	ret := _m.Called(ctx, folderID)
+
+	var r0 *models.FolderResponse
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) *models.FolderResponse); ok {
+		r0 = rf(ctx, folderID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.FolderResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID) error); ok {
+		r1 = rf(ctx, folderID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFolderByPath provides a mock function with given fields: ctx, path, owner
+func (_m *DBHandler) GetFolderByPath(ctx context.Context, path []string, owner string) (*models.FolderResponse, error) {
+	ret := _m.Called(ctx, path, owner)
+
+	var r0 *models.FolderResponse
+	if rf, ok := ret.Get(0).(func(context.Context, []string, string) *models.FolderResponse); ok {
+		r0 = rf(ctx, path, owner)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.FolderResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []string, string) error); ok {
+		r1 = rf(ctx, path, owner)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFolderContents provides a mock function with given fields: ctx, folderID
+func (_m *DBHandler) GetFolderContents(ctx context.Context, folderID *primitive.ObjectID) (*models.FolderContents, error) {
+	ret := _m.Called(ctx, folderID)
+
+	var r0 *models.FolderContents
+	if rf, ok := ret.Get(0).(func(context.Context, *primitive.ObjectID) *models.FolderContents); ok {
+		r0 = rf(ctx, folderID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.FolderContents)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *primitive.ObjectID) error); ok {
+		r1 = rf(ctx, folderID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetShare provides a mock function with given fields: ctx, shareID
+func (_m *DBHandler) GetShare(ctx context.Context, shareID primitive.ObjectID) (*models.Share, error) {
+	ret := _m.Called(ctx, shareID)
+
+	var r0 *models.Share
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) *models.Share); ok {
+		r0 = rf(ctx, shareID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Share)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID) error); ok {
+		r1 = rf(ctx, shareID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetShares provides a mock function with given fields: ctx, fileID
+func (_m *DBHandler) GetShares(ctx context.Context, fileID primitive.ObjectID) ([]models.Share, error) {
+	ret := _m.Called(ctx, fileID)
+
+	var r0 []models.Share
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) []models.Share); ok {
+		r0 = rf(ctx, fileID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Share)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID) error); ok {
+		r1 = rf(ctx, fileID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUpload provides a mock function with given fields: ctx, uploadID
+func (_m *DBHandler) GetUpload(ctx context.Context, uploadID primitive.ObjectID) (*models.Upload, error) {
+	ret := _m.Called(ctx, uploadID)
+
+	var r0 *models.Upload
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) *models.Upload); ok {
+		r0 = rf(ctx, uploadID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Upload)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID) error); ok {
+		r1 = rf(ctx, uploadID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MoveFile provides a mock function with given fields: ctx, fileID, parent
+func (_m *DBHandler) MoveFile(ctx context.Context, fileID primitive.ObjectID, parent *primitive.ObjectID) error {
+	ret := _m.Called(ctx, fileID, parent)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, *primitive.ObjectID) error); ok {
+		r0 = rf(ctx, fileID, parent)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MoveFolder provides a mock function with given fields: ctx, folderID, parent
+func (_m *DBHandler) MoveFolder(ctx context.Context, folderID primitive.ObjectID, parent *primitive.ObjectID) error {
+	ret := _m.Called(ctx, folderID, parent)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, *primitive.ObjectID) error); ok {
+		r0 = rf(ctx, folderID, parent)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// OpenDerived provides a mock function with given fields: ctx, derived
+func (_m *DBHandler) OpenDerived(ctx context.Context, derived *models.Derived) (dao.FileStream, error) {
+	ret := _m.Called(ctx, derived)
+
+	var r0 dao.FileStream
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Derived) dao.FileStream); ok {
+		r0 = rf(ctx, derived)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(dao.FileStream)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *models.Derived) error); ok {
+		r1 = rf(ctx, derived)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// OpenFile provides a mock function with given fields: ctx, fileID
+func (_m *DBHandler) OpenFile(ctx context.Context, fileID primitive.ObjectID) (dao.FileStream, error) {
+	ret := _m.Called(ctx, fileID)
+
+	var r0 dao.FileStream
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) dao.FileStream); ok {
+		r0 = rf(ctx, fileID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(dao.FileStream)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID) error); ok {
+		r1 = rf(ctx, fileID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// OpenFileVersion provides a mock function with given fields: ctx, fileID, version
+func (_m *DBHandler) OpenFileVersion(ctx context.Context, fileID primitive.ObjectID, version int) (dao.FileStream, error) {
+	ret := _m.Called(ctx, fileID, version)
+
+	var r0 dao.FileStream
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, int) dao.FileStream); ok {
+		r0 = rf(ctx, fileID, version)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(dao.FileStream)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID, int) error); ok {
+		r1 = rf(ctx, fileID, version)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -91,6 +670,57 @@ func (_m *DBHandler) Ping(ctx context.Context) error {
 	return r0
 }
 
+// RenameFolder provides a mock function with given fields: ctx, folderID, name
+func (_m *DBHandler) RenameFolder(ctx context.Context, folderID primitive.ObjectID, name string) error {
+	ret := _m.Called(ctx, folderID, name)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, string) error); ok {
+		r0 = rf(ctx, folderID, name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RestoreFileVersion provides a mock function with given fields: ctx, fileID, version
+func (_m *DBHandler) RestoreFileVersion(ctx context.Context, fileID primitive.ObjectID, version int) (*models.FileVersion, error) {
+	ret := _m.Called(ctx, fileID, version)
+
+	var r0 *models.FileVersion
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, int) *models.FileVersion); ok {
+		r0 = rf(ctx, fileID, version)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.FileVersion)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID, int) error); ok {
+		r1 = rf(ctx, fileID, version)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// StoreDerived provides a mock function with given fields: ctx, derived, source
+func (_m *DBHandler) StoreDerived(ctx context.Context, derived *models.Derived, source io.Reader) error {
+	ret := _m.Called(ctx, derived, source)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Derived, io.Reader) error); ok {
+		r0 = rf(ctx, derived, source)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UpdateFileInfo provides a mock function with given fields: ctx, fileID, updateRequest
 func (_m *DBHandler) UpdateFileInfo(ctx context.Context, fileID primitive.ObjectID, updateRequest map[string]interface{}) error {
 	ret := _m.Called(ctx, fileID, updateRequest)
@@ -105,16 +735,62 @@ func (_m *DBHandler) UpdateFileInfo(ctx context.Context, fileID primitive.Object
 	return r0
 }
 
-// UploadFile provides a mock function with given fields: ctx, uploadRequest, fileBytes
-func (_m *DBHandler) UploadFile(ctx context.Context, uploadRequest *models.FileRequest, fileBytes []byte) error {
-	ret := _m.Called(ctx, uploadRequest, fileBytes)
+// UploadFile provides a mock function with given fields: ctx, uploadRequest, source
+func (_m *DBHandler) UploadFile(ctx context.Context, uploadRequest *models.FileRequest, source io.Reader) (*models.FileResponse, error) {
+	ret := _m.Called(ctx, uploadRequest, source)
+
+	var r0 *models.FileResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *models.FileRequest, io.Reader) *models.FileResponse); ok {
+		r0 = rf(ctx, uploadRequest, source)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.FileResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *models.FileRequest, io.Reader) error); ok {
+		r1 = rf(ctx, uploadRequest, source)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UploadFileVersion provides a mock function with given fields: ctx, fileID, versionRequest, source
+func (_m *DBHandler) UploadFileVersion(ctx context.Context, fileID primitive.ObjectID, versionRequest *models.FileVersion, source io.Reader) error {
+	ret := _m.Called(ctx, fileID, versionRequest, source)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, *models.FileRequest, []byte) error); ok {
-		r0 = rf(ctx, uploadRequest, fileBytes)
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, *models.FileVersion, io.Reader) error); ok {
+		r0 = rf(ctx, fileID, versionRequest, source)
 	} else {
 		r0 = ret.Error(0)
 	}
 
 	return r0
 }
+
+// UseAPIKey provides a mock function with given fields: ctx, hash
+func (_m *DBHandler) UseAPIKey(ctx context.Context, hash string) (*models.APIKey, error) {
+	ret := _m.Called(ctx, hash)
+
+	var r0 *models.APIKey
+	if rf, ok := ret.Get(0).(func(context.Context, string) *models.APIKey); ok {
+		r0 = rf(ctx, hash)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.APIKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, hash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -2,7 +2,11 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	models "content-service-api/models"
+
+	mock "github.com/stretchr/testify/mock"
+)
 
 // ExtHandler is an autogenerated mock type for the ExtHandler type
 type ExtHandler struct {
@@ -10,15 +14,24 @@ type ExtHandler struct {
 }
 
 // ValidateToken provides a mock function with given fields: token
-func (_m *ExtHandler) ValidateToken(token string) error {
+func (_m *ExtHandler) ValidateToken(token string) (*models.Principal, error) {
 	ret := _m.Called(token)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(string) error); ok {
+	var r0 *models.Principal
+	if rf, ok := ret.Get(0).(func(string) *models.Principal); ok {
 		r0 = rf(token)
 	} else {
-		r0 = ret.Error(0)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Principal)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(token)
+	} else {
+		r1 = ret.Error(1)
 	}
 
-	return r0
+	return r0, r1
 }
@@ -0,0 +1,207 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"strconv"
+
+	// Registered with image.Decode for the formats thumbnails can be made from.
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	FitContain = "contain"
+	FitCover   = "cover"
+	FitFill    = "fill"
+
+	DefaultSize = 256
+	MaxSize     = 1024
+
+	// maxPixels bounds the size of the source images that are decoded, since a small, highly compressed
+	// file can otherwise claim dimensions that take gigabytes to decode.
+	maxPixels = 50000000
+	// maxConcurrent bounds how many thumbnails are generated at once. A decoded image of maxPixels takes
+	// about 200MB, so without a bound a burst of requests for uncached thumbnails can exhaust memory.
+	maxConcurrent = 4
+	// jpegQuality is used for thumbnails of JPEG images.
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedImage = errors.New("thumbnails can only be generated for JPEG, PNG, GIF and WebP images")
+	ErrImageTooLarge    = fmt.Errorf("image has more than %v pixels", maxPixels)
+	ErrBusy             = errors.New("too many thumbnails are being generated, try again later")
+)
+
+// slots holds a value for every thumbnail being generated.
+var slots = make(chan struct{}, maxConcurrent)
+
+// Options describe the box a thumbnail is scaled into. A Width or Height of 0 leaves that side free to
+// follow the image's aspect ratio. Fit is one of contain, which scales the image to fit inside the box,
+// cover, which fills the box and crops what is left over, or fill, which stretches the image to the box.
+type Options struct {
+	Width  int
+	Height int
+	Fit    string
+}
+
+// ParseOptions reads the w, h and fit query parameters. Without either dimension the thumbnail fits a
+// DefaultSize square.
+func ParseOptions(query url.Values) (Options, error) {
+	options := Options{Fit: FitContain}
+
+	var err error
+	if options.Width, err = parseDimension(query.Get("w")); err != nil {
+		return Options{}, fmt.Errorf("invalid width: %v", err)
+	}
+	if options.Height, err = parseDimension(query.Get("h")); err != nil {
+		return Options{}, fmt.Errorf("invalid height: %v", err)
+	}
+	if options.Width == 0 && options.Height == 0 {
+		options.Width, options.Height = DefaultSize, DefaultSize
+	}
+
+	switch fit := query.Get("fit"); fit {
+	case "":
+	case FitContain, FitCover, FitFill:
+		options.Fit = fit
+	default:
+		return Options{}, fmt.Errorf("fit must be '%v', '%v' or '%v'", FitContain, FitCover, FitFill)
+	}
+
+	// Cover and fill need both sides of the box; with one missing they mean the same as contain.
+	if options.Width == 0 || options.Height == 0 {
+		options.Fit = FitContain
+	}
+
+	return options, nil
+}
+
+func parseDimension(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, err
+	} else if value < 1 || value > MaxSize {
+		return 0, fmt.Errorf("must be between 1 and %v", MaxSize)
+	}
+	return value, nil
+}
+
+// Variant identifies the thumbnail the options produce, for caching.
+func (o Options) Variant() string {
+	return fmt.Sprintf("%vx%v-%v", o.Width, o.Height, o.Fit)
+}
+
+// Generate decodes an image and scales it according to options. Images are never enlarged. Thumbnails
+// of JPEG images are encoded as JPEG and all others as PNG to keep any transparency; the content type
+// of the encoding is returned along with it. Generate fails with ErrBusy rather than waiting if
+// maxConcurrent thumbnails are already being generated.
+func Generate(source io.Reader, options Options) ([]byte, string, error) {
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	default:
+		return nil, "", ErrBusy
+	}
+
+	buffered := &bytes.Buffer{}
+	config, format, err := image.DecodeConfig(io.TeeReader(source, buffered))
+	if err != nil {
+		return nil, "", ErrUnsupportedImage
+	} else if int64(config.Width)*int64(config.Height) > maxPixels {
+		return nil, "", ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(io.MultiReader(buffered, source))
+	if err != nil {
+		return nil, "", err
+	}
+
+	thumbnail := scale(img, options)
+
+	out := &bytes.Buffer{}
+	if format == "jpeg" {
+		if err := jpeg.Encode(out, thumbnail, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, "", err
+		}
+		return out.Bytes(), "image/jpeg", nil
+	}
+
+	if err := png.Encode(out, thumbnail); err != nil {
+		return nil, "", err
+	}
+	return out.Bytes(), "image/png", nil
+}
+
+func scale(img image.Image, options Options) image.Image {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	if srcWidth == 0 || srcHeight == 0 {
+		return img
+	}
+
+	src := bounds
+	width, height := options.Width, options.Height
+	switch options.Fit {
+	case FitFill:
+		width, height = minInt(width, srcWidth), minInt(height, srcHeight)
+	case FitCover:
+		// Crop the source to the box's aspect ratio around its centre, then scale the crop down.
+		if srcWidth*height > srcHeight*width {
+			cropWidth := srcHeight * width / height
+			src.Min.X += (srcWidth - cropWidth) / 2
+			src.Max.X = src.Min.X + cropWidth
+		} else {
+			cropHeight := srcWidth * height / width
+			src.Min.Y += (srcHeight - cropHeight) / 2
+			src.Max.Y = src.Min.Y + cropHeight
+		}
+		if width > src.Dx() || height > src.Dy() {
+			width, height = src.Dx(), src.Dy()
+		}
+	default:
+		ratio := 1.0
+		if width > 0 {
+			ratio = float64(width) / float64(srcWidth)
+		}
+		if height > 0 && (width == 0 || float64(height)/float64(srcHeight) < ratio) {
+			ratio = float64(height) / float64(srcHeight)
+		}
+		if ratio > 1 {
+			ratio = 1
+		}
+		width = maxInt(1, int(float64(srcWidth)*ratio+0.5))
+		height = maxInt(1, int(float64(srcHeight)*ratio+0.5))
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	return dst
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
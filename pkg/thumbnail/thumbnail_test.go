@@ -0,0 +1,111 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newPNG(t *testing.T, width int, height int) *bytes.Reader {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 200})
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, png.Encode(buf, img))
+	return bytes.NewReader(buf.Bytes())
+}
+
+func decode(t *testing.T, content []byte) image.Image {
+	img, _, err := image.Decode(bytes.NewReader(content))
+	require.Nil(t, err)
+	return img
+}
+
+func TestThumbnail_ParseOptions_ShouldApplyDefaults(t *testing.T) {
+	options, err := ParseOptions(url.Values{})
+	require.Nil(t, err)
+	require.Equal(t, Options{Width: DefaultSize, Height: DefaultSize, Fit: FitContain}, options)
+
+	options, err = ParseOptions(url.Values{"w": {"100"}, "fit": {"cover"}})
+	require.Nil(t, err)
+	require.Equal(t, Options{Width: 100, Fit: FitContain}, options)
+	require.Equal(t, "100x0-contain", options.Variant())
+}
+
+func TestThumbnail_ParseOptions_ShouldRejectInvalidOptions(t *testing.T) {
+	for _, query := range []url.Values{
+		{"w": {"0"}},
+		{"h": {"2000"}},
+		{"w": {"big"}},
+		{"fit": {"stretch"}},
+	} {
+		_, err := ParseOptions(query)
+		require.NotNil(t, err, query.Encode())
+	}
+}
+
+func TestThumbnail_Generate_ShouldScaleToFit(t *testing.T) {
+	tests := []struct {
+		options       Options
+		width, height int
+	}{
+		{Options{Width: 50, Height: 50, Fit: FitContain}, 50, 25},
+		{Options{Height: 10, Fit: FitContain}, 20, 10},
+		{Options{Width: 50, Height: 50, Fit: FitCover}, 50, 50},
+		{Options{Width: 30, Height: 40, Fit: FitFill}, 30, 40},
+		{Options{Width: 500, Height: 500, Fit: FitContain}, 200, 100},
+	}
+
+	for _, test := range tests {
+		content, contentType, err := Generate(newPNG(t, 200, 100), test.options)
+		require.Nil(t, err)
+		require.Equal(t, "image/png", contentType)
+
+		bounds := decode(t, content).Bounds()
+		require.Equal(t, test.width, bounds.Dx(), test.options.Variant())
+		require.Equal(t, test.height, bounds.Dy(), test.options.Variant())
+	}
+}
+
+func TestThumbnail_Generate_ShouldKeepJPEGAsJPEG(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.Nil(t, jpeg.Encode(buf, image.NewRGBA(image.Rect(0, 0, 64, 64)), nil))
+
+	content, contentType, err := Generate(buf, Options{Width: 16, Height: 16, Fit: FitContain})
+	require.Nil(t, err)
+	require.Equal(t, "image/jpeg", contentType)
+	require.Equal(t, 16, decode(t, content).Bounds().Dx())
+}
+
+func TestThumbnail_Generate_ShouldRejectUnsupportedContent(t *testing.T) {
+	_, _, err := Generate(strings.NewReader("%PDF-1.4"), Options{Width: 16, Height: 16, Fit: FitContain})
+	require.Equal(t, ErrUnsupportedImage, err)
+}
+
+func TestThumbnail_Generate_ShouldFailWhenAllSlotsAreTaken(t *testing.T) {
+	for i := 0; i < maxConcurrent; i++ {
+		slots <- struct{}{}
+	}
+
+	_, _, err := Generate(newPNG(t, 64, 32), Options{Width: 16, Height: 16, Fit: FitContain})
+	require.Equal(t, ErrBusy, err)
+
+	<-slots
+	_, _, err = Generate(newPNG(t, 64, 32), Options{Width: 16, Height: 16, Fit: FitContain})
+	require.Nil(t, err)
+
+	for i := 1; i < maxConcurrent; i++ {
+		<-slots
+	}
+}
@@ -0,0 +1,323 @@
+package unpack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"content-service-api/models"
+)
+
+const (
+	FormatZip   = "zip"
+	FormatTar   = "tar"
+	FormatTarGz = "tar.gz"
+
+	// headerLength covers the tar magic at offset 257, the furthest any format is identified by.
+	headerLength = 512
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("file is not a zip, tar or tar.gz archive")
+	ErrUnsafePath        = errors.New("archive contains an entry whose path leads outside the archive")
+	ErrTooManyEntries    = errors.New("archive contains too many entries")
+	ErrTooLarge          = errors.New("archive expands beyond the allowed size")
+	ErrEntryNotFound     = errors.New("entry not found in archive")
+
+	errStop = errors.New("stop walking")
+)
+
+// Limits bound how much work reading an archive can cause, so that a small, highly compressed archive
+// cannot be used to exhaust the server.
+type Limits struct {
+	// MaxEntries is the most entries an archive may contain. Tar entries that are skipped, such as
+	// directories and links, count as well.
+	MaxEntries int
+	// MaxEntrySize is the largest a single file may be once extracted.
+	MaxEntrySize int64
+	// MaxTotalSize is the most all files together may add up to once extracted.
+	MaxTotalSize int64
+	// MaxRatio is the most the extracted files may add up to relative to the size of the archive.
+	MaxRatio int64
+}
+
+var DefaultLimits = Limits{
+	MaxEntries:   10000,
+	MaxEntrySize: 1 << 30,
+	MaxTotalSize: 4 << 30,
+	MaxRatio:     100,
+}
+
+// Reader reads the files of a zip, tar or gzipped tar archive. Directories, links and other special
+// entries are skipped, and every entry name is checked to stay within the archive when extracted.
+type Reader struct {
+	Format string
+	source io.ReadSeeker
+	size   int64
+	limits Limits
+}
+
+// Open identifies the format of an archive from its leading bytes.
+func Open(source io.ReadSeeker, limits Limits) (*Reader, error) {
+	size, err := source.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := source.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerLength)
+	n, err := io.ReadFull(source, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	header = header[:n]
+
+	reader := &Reader{source: source, size: size, limits: limits}
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		reader.Format = FormatZip
+	case bytes.HasPrefix(header, []byte("\x1f\x8b")):
+		reader.Format = FormatTarGz
+	case len(header) >= 262 && bytes.Equal(header[257:262], []byte("ustar")):
+		reader.Format = FormatTar
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	return reader, nil
+}
+
+// Entries lists the files in the archive. Since every entry is checked against the limits on the way,
+// a successful listing also means the whole archive can be walked without exceeding them.
+func (r *Reader) Entries() ([]models.ArchiveEntry, error) {
+	entries := []models.ArchiveEntry{}
+	err := r.Walk(func(entry models.ArchiveEntry, content io.Reader) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Find calls fn for the file with the given name, which is compared after cleaning it the same way
+// entry names are.
+func (r *Reader) Find(name string, fn func(entry models.ArchiveEntry, content io.Reader) error) error {
+	name, err := safePath(name)
+	if err != nil {
+		return ErrEntryNotFound
+	}
+
+	err = r.Walk(func(entry models.ArchiveEntry, content io.Reader) error {
+		if entry.Name != name {
+			return nil
+		}
+		if err := fn(entry, content); err != nil {
+			return err
+		}
+		return errStop
+	})
+	if err == errStop {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return ErrEntryNotFound
+}
+
+// Walk calls fn for every file in the archive in the order they are stored. content is only valid until
+// fn returns, and reading past the entry's declared size fails with ErrTooLarge. Walking stops at the
+// first error, either from fn or from an entry that breaks the limits.
+func (r *Reader) Walk(fn func(entry models.ArchiveEntry, content io.Reader) error) error {
+	if _, err := r.source.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	walker := &walker{limits: r.limits, size: r.size, fn: fn}
+	switch r.Format {
+	case FormatZip:
+		return walker.zip(r.source, r.size)
+	case FormatTarGz:
+		gz, err := gzip.NewReader(r.source)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return walker.tar(gz)
+	default:
+		return walker.tar(r.source)
+	}
+}
+
+// walker applies the limits while entries are handed to fn.
+type walker struct {
+	limits  Limits
+	size    int64
+	fn      func(entry models.ArchiveEntry, content io.Reader) error
+	entries int
+	total   int64
+}
+
+func (w *walker) zip(source io.ReadSeeker, size int64) error {
+	reader, err := zip.NewReader(&readerAt{source: source}, size)
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, ErrUnsupportedFormat)
+	}
+
+	for _, file := range reader.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		entry := models.ArchiveEntry{Name: file.Name, Size: int64(file.UncompressedSize64), Modified: file.Modified}
+		if err := w.check(&entry); err != nil {
+			return err
+		}
+
+		content, err := file.Open()
+		if err != nil {
+			return err
+		}
+
+		err = w.fn(entry, &limitedReader{r: content, remaining: entry.Size})
+		if closeErr := content.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *walker) tar(source io.Reader) error {
+	reader := tar.NewReader(source)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%v: %w", err, ErrUnsupportedFormat)
+		}
+
+		// Skipping an entry still reads through its body, decompressing it along the way, so skipped
+		// entries count against the limits as well.
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			if err := w.count(header.Size); err != nil {
+				return err
+			}
+			continue
+		}
+
+		entry := models.ArchiveEntry{Name: header.Name, Size: header.Size, Modified: header.ModTime}
+		if err := w.check(&entry); err != nil {
+			return err
+		}
+
+		if err := w.fn(entry, &limitedReader{r: reader, remaining: entry.Size}); err != nil {
+			return err
+		}
+	}
+}
+
+// check cleans an entry's name and counts it against the limits. Sizes are checked as declared; the
+// readers handed to fn make sure no entry yields more than it declared.
+func (w *walker) check(entry *models.ArchiveEntry) error {
+	name, err := safePath(entry.Name)
+	if err != nil {
+		return err
+	}
+	entry.Name = name
+
+	return w.count(entry.Size)
+}
+
+// count counts an entry of the given size against the limits.
+func (w *walker) count(size int64) error {
+	w.entries++
+	w.total += size
+	switch {
+	case w.entries > w.limits.MaxEntries:
+		return ErrTooManyEntries
+	case size < 0, size > w.limits.MaxEntrySize, w.total > w.limits.MaxTotalSize:
+		return ErrTooLarge
+	case w.total > w.size*w.limits.MaxRatio:
+		return ErrTooLarge
+	}
+
+	return nil
+}
+
+// safePath cleans an entry name into a relative, slash separated path, rejecting names that are absolute
+// or climb out of the directory the archive would be extracted into.
+func safePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", ErrUnsafePath
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrUnsafePath
+	}
+
+	return cleaned, nil
+}
+
+// limitedReader fails with ErrTooLarge rather than returning more than remaining bytes.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		var probe [1]byte
+		if n, _ := l.r.Read(probe[:]); n > 0 {
+			return 0, ErrTooLarge
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// readerAt adapts a seekable stream for archive/zip, which reads the central directory and each entry
+// from arbitrary offsets.
+type readerAt struct {
+	mu     sync.Mutex
+	source io.ReadSeeker
+}
+
+func (r *readerAt) ReadAt(p []byte, offset int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.source.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(r.source, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,176 @@
+package unpack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"content-service-api/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newZip(t *testing.T, files map[string]string) *bytes.Reader {
+	buf := &bytes.Buffer{}
+	writer := zip.NewWriter(buf)
+	for name, content := range files {
+		entry, err := writer.Create(name)
+		require.Nil(t, err)
+		_, err = entry.Write([]byte(content))
+		require.Nil(t, err)
+	}
+	require.Nil(t, writer.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func newTar(t *testing.T, gzipped bool, files ...string) *bytes.Reader {
+	buf := &bytes.Buffer{}
+	var w io.Writer = buf
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(buf)
+		w = gz
+	}
+
+	writer := tar.NewWriter(w)
+	require.Nil(t, writer.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "docs/", Mode: 0755}))
+	for i := 0; i < len(files); i += 2 {
+		require.Nil(t, writer.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: files[i], Size: int64(len(files[i+1])), Mode: 0644}))
+		_, err := writer.Write([]byte(files[i+1]))
+		require.Nil(t, err)
+	}
+	require.Nil(t, writer.Close())
+	if gz != nil {
+		require.Nil(t, gz.Close())
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestUnpack_Open_ShouldIdentifyFormats(t *testing.T) {
+	reader, err := Open(newZip(t, map[string]string{"a.txt": "a"}), DefaultLimits)
+	require.Nil(t, err)
+	require.Equal(t, FormatZip, reader.Format)
+
+	reader, err = Open(newTar(t, false, "a.txt", "a"), DefaultLimits)
+	require.Nil(t, err)
+	require.Equal(t, FormatTar, reader.Format)
+
+	reader, err = Open(newTar(t, true, "a.txt", "a"), DefaultLimits)
+	require.Nil(t, err)
+	require.Equal(t, FormatTarGz, reader.Format)
+
+	_, err = Open(strings.NewReader("just some text"), DefaultLimits)
+	require.Equal(t, ErrUnsupportedFormat, err)
+}
+
+func TestUnpack_Entries_ShouldListFilesAndSkipDirectories(t *testing.T) {
+	for _, gzipped := range []bool{false, true} {
+		reader, err := Open(newTar(t, gzipped, "docs/a.txt", "first", "./docs/b.txt", "second"), DefaultLimits)
+		require.Nil(t, err)
+
+		entries, err := reader.Entries()
+		require.Nil(t, err)
+		require.Len(t, entries, 2)
+		require.Equal(t, "docs/a.txt", entries[0].Name)
+		require.Equal(t, int64(5), entries[0].Size)
+		require.Equal(t, "docs/b.txt", entries[1].Name)
+	}
+}
+
+func TestUnpack_Find_ShouldStreamASingleEntry(t *testing.T) {
+	reader, err := Open(newZip(t, map[string]string{"docs/a.txt": "first", "docs/b.txt": "second"}), DefaultLimits)
+	require.Nil(t, err)
+
+	var content []byte
+	err = reader.Find("docs/b.txt", func(entry models.ArchiveEntry, r io.Reader) error {
+		content, err = ioutil.ReadAll(r)
+		return err
+	})
+	require.Nil(t, err)
+	require.Equal(t, "second", string(content))
+
+	err = reader.Find("docs/c.txt", func(entry models.ArchiveEntry, r io.Reader) error {
+		return nil
+	})
+	require.Equal(t, ErrEntryNotFound, err)
+}
+
+func TestUnpack_Entries_ShouldRejectPathsEscapingTheArchive(t *testing.T) {
+	for _, name := range []string{"../evil.sh", "docs/../../evil.sh", "/etc/passwd", "..\\evil.bat", "C:\\evil.bat"} {
+		reader, err := Open(newZip(t, map[string]string{name: "evil"}), DefaultLimits)
+		require.Nil(t, err)
+
+		_, err = reader.Entries()
+		require.Equal(t, ErrUnsafePath, err, name)
+
+		reader, err = Open(newTar(t, true, name, "evil"), DefaultLimits)
+		require.Nil(t, err)
+
+		_, err = reader.Entries()
+		require.Equal(t, ErrUnsafePath, err, name)
+	}
+}
+
+func TestUnpack_Entries_ShouldEnforceLimits(t *testing.T) {
+	bomb := strings.Repeat("0", 1<<20)
+
+	reader, err := Open(newZip(t, map[string]string{"bomb.txt": bomb}), DefaultLimits)
+	require.Nil(t, err)
+	_, err = reader.Entries()
+	require.Equal(t, ErrTooLarge, err)
+
+	reader, err = Open(newTar(t, true, "bomb.txt", bomb), DefaultLimits)
+	require.Nil(t, err)
+	_, err = reader.Entries()
+	require.Equal(t, ErrTooLarge, err)
+
+	limits := DefaultLimits
+	limits.MaxEntrySize = 4
+	reader, err = Open(newTar(t, false, "a.txt", "12345"), limits)
+	require.Nil(t, err)
+	_, err = reader.Entries()
+	require.Equal(t, ErrTooLarge, err)
+
+	limits = DefaultLimits
+	limits.MaxEntries = 1
+	reader, err = Open(newTar(t, false, "a.txt", "a", "b.txt", "b"), limits)
+	require.Nil(t, err)
+	_, err = reader.Entries()
+	require.Equal(t, ErrTooManyEntries, err)
+}
+
+func TestUnpack_Entries_ShouldCountSkippedTarEntriesAgainstLimits(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	writer := tar.NewWriter(gz)
+	bomb := strings.Repeat("0", 1<<20)
+	require.Nil(t, writer.WriteHeader(&tar.Header{Typeflag: 'Z', Name: "bomb", Size: int64(len(bomb)), Mode: 0644}))
+	_, err := writer.Write([]byte(bomb))
+	require.Nil(t, err)
+	require.Nil(t, writer.Close())
+	require.Nil(t, gz.Close())
+
+	reader, err := Open(bytes.NewReader(buf.Bytes()), DefaultLimits)
+	require.Nil(t, err)
+	_, err = reader.Entries()
+	require.Equal(t, ErrTooLarge, err)
+
+	limits := DefaultLimits
+	limits.MaxEntries = 2
+	reader, err = Open(newTar(t, false, "a.txt", "a", "b.txt", "b"), limits)
+	require.Nil(t, err)
+	_, err = reader.Entries()
+	require.Equal(t, ErrTooManyEntries, err)
+}
+
+func TestUnpack_LimitedReader_ShouldFailWhenContentExceedsDeclaredSize(t *testing.T) {
+	reader := &limitedReader{r: strings.NewReader("12345"), remaining: 3}
+
+	_, err := ioutil.ReadAll(reader)
+	require.Equal(t, ErrTooLarge, err)
+}